@@ -1,4 +1,6 @@
-const BASE = ''
+// Path prefix the app is served under (server.base_path), taken from the
+// <base href> the server writes into index.html. Empty at the root.
+export const BASE = new URL(document.baseURI).pathname.replace(/\/$/, '')
 
 // Serialize params supporting arrays: { Severity: [3,4] } → "Severity=3&Severity=4"
 function toQueryString(params) {
@@ -26,8 +28,8 @@ async function request(path, options = {}) {
   if (res.status === 401 && !path.startsWith('/api/admin/login')) {
     sessionStorage.removeItem('rsyslox_token')
     sessionStorage.removeItem('rsyslox_role')
-    const redirect = encodeURIComponent(window.location.pathname)
-    window.location.href = `/login?redirect=${redirect}`
+    const redirect = encodeURIComponent(window.location.pathname.slice(BASE.length) || '/')
+    window.location.href = `${BASE}/login?redirect=${redirect}`
     throw new Error('Session expired')
   }
 
@@ -45,8 +47,41 @@ async function request(path, options = {}) {
 }
 
 export const api = {
-  login:  (password) =>
-    request('/api/admin/login', { method: 'POST', body: JSON.stringify({ password }) }),
+  login:  (username, password) =>
+    request('/api/admin/login', { method: 'POST', body: JSON.stringify({ username, password }) }),
+
+  loginSecondFactor: (pendingToken, code) =>
+    request('/api/admin/login', { method: 'POST', body: JSON.stringify({ pending_token: pendingToken, code }) }),
+
+  getTwoFactor: () =>
+    request('/api/admin/2fa'),
+
+  enrollTwoFactor: () =>
+    request('/api/admin/2fa/enroll', { method: 'POST' }),
+
+  confirmTwoFactor: (code) =>
+    request('/api/admin/2fa/confirm', { method: 'POST', body: JSON.stringify({ code }) }),
+
+  regenerateRecoveryCodes: (code) =>
+    request('/api/admin/2fa/recovery-codes', { method: 'POST', body: JSON.stringify({ code }) }),
+
+  disableTwoFactor: (code) =>
+    request('/api/admin/2fa', { method: 'DELETE', body: JSON.stringify({ code }) }),
+
+  getSessions: () =>
+    request('/api/admin/sessions'),
+
+  revokeSession: (id) =>
+    request('/api/admin/sessions' + (id ? '/' + encodeURIComponent(id) : ''), { method: 'DELETE' }),
+
+  getAudit: (params) =>
+    request('/api/admin/audit?' + toQueryString(params)),
+
+  getLockouts: () =>
+    request('/api/admin/lockouts'),
+
+  clearLockout: (ip) =>
+    request('/api/admin/lockouts' + (ip ? '/' + encodeURIComponent(ip) : ''), { method: 'DELETE' }),
 
   logout: () =>
     request('/api/admin/logout', { method: 'POST' }),
@@ -54,6 +89,9 @@ export const api = {
   setup: (payload) =>
     request('/api/setup', { method: 'POST', body: JSON.stringify(payload) }),
 
+  setupTestDB: (payload) =>
+    request('/api/setup/test-db', { method: 'POST', body: JSON.stringify(payload) }),
+
   getLogs: (params) =>
     request('/api/logs?' + toQueryString(params)),
 
@@ -69,6 +107,15 @@ export const api = {
   updateConfig: (patch) =>
     request('/api/admin/config', { method: 'PATCH', body: JSON.stringify(patch) }),
 
+  testDB: (database) =>
+    request('/api/admin/config/test-db', { method: 'POST', body: JSON.stringify(database) }),
+
+  getSSLInfo: () =>
+    request('/api/admin/ssl'),
+
+  getMTLS: () =>
+    request('/api/admin/mtls'),
+
   generateSSL: () =>
     request('/api/admin/ssl/generate', { method: 'POST' }),
 
@@ -86,7 +133,7 @@ export const api = {
     const token = sessionStorage.getItem('rsyslox_token')
     const headers = {}
     if (token) headers['X-Session-Token'] = token
-    return fetch('/api/admin/ssl/upload', { method: 'POST', headers, body: form })
+    return fetch(BASE + '/api/admin/ssl/upload', { method: 'POST', headers, body: form })
       .then(async res => {
         if (!res.ok) {
           let msg = `HTTP ${res.status}`
@@ -100,8 +147,13 @@ export const api = {
   getKeys: () =>
     request('/api/admin/keys'),
 
-  createKey: (name) =>
-    request('/api/admin/keys', { method: 'POST', body: JSON.stringify({ name }) }),
+  createKey: (name, expiresAt) =>
+    request('/api/admin/keys', { method: 'POST', body: JSON.stringify({ name, expires_at: expiresAt || undefined }) }),
+
+  rotateKey: (name, overlapSeconds) =>
+    request('/api/admin/keys/' + encodeURIComponent(name) + '/rotate', {
+      method: 'POST', body: JSON.stringify({ overlap_seconds: overlapSeconds }),
+    }),
 
   deleteKey: (name) =>
     request('/api/admin/keys/' + encodeURIComponent(name), { method: 'DELETE' }),
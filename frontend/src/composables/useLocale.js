@@ -28,5 +28,12 @@ export function useLocale() {
     return Number(n).toLocaleString(lc)
   }
 
-  return { t, locale, fmtNumber }
+  // Format a count; estimates are shortened and marked, e.g. "~1.2M"
+  function fmtCount(n, exact = true) {
+    if (exact) return fmtNumber(n)
+    const lc = LOCALE_MAP[language.value] ?? 'en-US'
+    return '~' + new Intl.NumberFormat(lc, { notation: 'compact', maximumFractionDigits: 1 }).format(n)
+  }
+
+  return { t, locale, fmtNumber, fmtCount }
 }
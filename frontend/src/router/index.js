@@ -2,9 +2,10 @@ import { createRouter, createWebHistory } from 'vue-router'
 import { useAuthStore } from '@/stores/auth'
 import { appState } from '@/stores/appState'
 import { applyServerDefaults } from '@/stores/preferences'
+import { BASE } from '@/api/client'
 
 const router = createRouter({
-  history: createWebHistory(),
+  history: createWebHistory(BASE + '/'),
   routes: [{
       path: '/',
       name: 'home',
@@ -56,7 +57,7 @@ const router = createRouter({
 
 async function fetchHealthAndApplyDefaults() {
   try {
-    const res = await fetch('/health')
+    const res = await fetch(BASE + '/health')
     const data = await res.json()
     if (data.version)  appState.version  = data.version
       if (data.defaults) {
@@ -21,6 +21,8 @@ export const FACILITY_LABELS = {
 const logs        = ref([])
 const total       = ref(0)
 const dbTotal     = ref(0)    // total entries in SystemEvents (no filter)
+const totalExact   = ref(true) // false when the server returned an estimate
+const dbTotalExact = ref(true)
 const loading     = ref(false)
 const error       = ref(null)
 
@@ -156,6 +158,8 @@ async function fetchLogs(fromRefresh = false) {
     logs.value    = rows
     total.value   = res.total    ?? 0
     dbTotal.value = res.db_total ?? 0
+    totalExact.value   = res.total_exact    ?? true
+    dbTotalExact.value = res.db_total_exact ?? true
     firstLoad.value = false
   } catch (e) {
     error.value = e.message || 'Failed to load logs'
@@ -316,7 +320,7 @@ watch(page, () => fetchLogs())  // arrow wrapper: prevents page value being pass
 export function useLogsStore() {
   return {
     // state
-    logs, total, dbTotal, loading, error,
+    logs, total, dbTotal, totalExact, dbTotalExact, loading, error,
     page, pageSize, offset, totalPages, showAll,
     timeMode, relativeDur, startDate, endDate,
     severities, excludeSeverities, facilities, excludeFacilities,
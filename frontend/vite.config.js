@@ -15,6 +15,9 @@ export default defineConfig({
       '@': fileURLToPath(new URL('./src', import.meta.url))
     }
   },
+  // Relative asset URLs resolve against the <base href> the server sets
+  // from server.base_path.
+  base: './',
   build: {
     outDir: 'dist',
     emptyOutDir: true
@@ -0,0 +1,295 @@
+// Package audit records administrative actions — who did what, when and
+// from where — in an append-only JSON lines file, and optionally forwards
+// each entry to syslog.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"log/syslog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/phil-bot/rsyslox/internal/config"
+)
+
+// Actions recorded by the admin handlers.
+const (
+	ActionLogin             = "auth.login"
+	ActionLoginFailed       = "auth.login_failed"
+	ActionLogout            = "auth.logout"
+	ActionConfigUpdate      = "config.update"
+	ActionConfigReload      = "config.reload"
+	ActionConfigRollback    = "config.rollback"
+	ActionKeyCreate         = "key.create"
+	ActionKeyDelete         = "key.delete"
+	ActionKeyRotate         = "key.rotate"
+	ActionSSLGenerate       = "ssl.generate"
+	ActionSSLUpload         = "ssl.upload"
+	ActionRestart           = "server.restart"
+	ActionTwoFactorEnable   = "2fa.enable"
+	ActionTwoFactorDisable  = "2fa.disable"
+	ActionTwoFactorRecovery = "2fa.recovery_codes"
+	ActionSessionRevoke     = "session.revoke"
+	ActionLockoutClear      = "lockout.clear"
+)
+
+// Outcomes.
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Entry is one audit record.
+type Entry struct {
+	ID      int64     `json:"id"`
+	Time    time.Time `json:"time"`
+	Actor   string    `json:"actor"` // username; empty for anonymous requests
+	IP      string    `json:"ip"`
+	Action  string    `json:"action"`
+	Target  string    `json:"target,omitempty"` // e.g. key name, session ID
+	Outcome string    `json:"outcome"`
+	Changes []Change  `json:"changes,omitempty"`
+	Details string    `json:"details,omitempty"`
+}
+
+// Query selects entries for GET /api/admin/audit.
+// Zero values do not filter.
+type Query struct {
+	Action string // exact action, or a prefix ending in "." such as "key."
+	Actor  string
+	IP     string
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+	Offset int
+}
+
+// Page is a slice of matching entries, newest first.
+type Page struct {
+	Entries []Entry `json:"entries"`
+	Total   int     `json:"total"`
+	Limit   int     `json:"limit"`
+	Offset  int     `json:"offset"`
+}
+
+// Logger appends entries to the audit file. A nil *Logger is valid and
+// records nothing, so callers need no checks when auditing is unavailable.
+type Logger struct {
+	live *config.Live
+	cfg  config.AuditConfig // file and syslog settings, fixed at startup
+	path string             // audit file
+
+	mu     sync.Mutex
+	opened bool // file and syslog set up; done on the first entry if disabled at startup
+	file   *os.File
+	lastID int64
+	sys    *syslog.Writer
+}
+
+// Open prepares the audit file and the optional syslog connection.
+// Errors are returned so the caller can log them; the returned Logger is
+// usable (possibly without a file or syslog) even when err is non-nil.
+// When auditing is disabled, both are set up once a reload enables it.
+func Open(live *config.Live) (*Logger, error) {
+	cfg := live.Get().Audit
+	l := &Logger{live: live, cfg: cfg, path: cfg.File}
+	if !cfg.Enabled {
+		return l, nil
+	}
+	return l, l.open()
+}
+
+// open opens the audit file and connects to syslog as configured at
+// startup. It is only attempted once.
+func (l *Logger) open() error {
+	cfg := l.cfg
+	l.opened = true
+	var errs []error
+	if cfg.File != "" {
+		if err := l.openFile(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if cfg.Syslog {
+		tag := cfg.SyslogTag
+		if tag == "" {
+			tag = "rsyslox-audit"
+		}
+		network := cfg.SyslogNetwork
+		if cfg.SyslogAddress != "" && network == "" {
+			network = "udp"
+		}
+		if cfg.SyslogAddress == "" {
+			network = ""
+		}
+		w, err := syslog.Dial(network, cfg.SyslogAddress, syslog.LOG_AUTHPRIV|syslog.LOG_NOTICE, tag)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("audit: syslog: %w", err))
+		} else {
+			l.sys = w
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// openFile opens the audit file for appending and finds the last entry ID.
+func (l *Logger) openFile() error {
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return fmt.Errorf("audit: %w", err)
+	}
+	if err := l.scan(func(e Entry) { l.lastID = e.ID }); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("audit: %w", err)
+	}
+	l.file = f
+	return nil
+}
+
+// Record writes e, filling in ID, Time and Outcome when unset.
+// Write errors are logged; auditing never fails the audited action.
+func (l *Logger) Record(e Entry) {
+	if l == nil || !l.live.Get().Audit.Enabled {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.opened {
+		if err := l.open(); err != nil {
+			slog.Warn("Audit", "err", err)
+		}
+	}
+	l.lastID++
+	e.ID = l.lastID
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	if e.Outcome == "" {
+		e.Outcome = OutcomeSuccess
+	}
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		slog.Warn("Audit", "err", err)
+		return
+	}
+	if l.file != nil {
+		if _, err := l.file.Write(append(line, '\n')); err != nil {
+			slog.Error("Audit: failed to write", "path", l.path, "err", err)
+		}
+	}
+	if l.sys != nil {
+		if err := l.sys.Notice(string(line)); err != nil {
+			slog.Warn("Audit: failed to forward to syslog", "err", err)
+		}
+	}
+}
+
+// Query returns the entries matching q, newest first.
+func (l *Logger) Query(q Query) (Page, error) {
+	page := Page{Entries: []Entry{}, Limit: q.Limit, Offset: q.Offset}
+	if l == nil {
+		return page, nil
+	}
+
+	var matches []Entry
+	l.mu.Lock()
+	if l.file == nil {
+		l.mu.Unlock()
+		return page, nil
+	}
+	err := l.scan(func(e Entry) {
+		if q.matches(e) {
+			matches = append(matches, e)
+		}
+	})
+	l.mu.Unlock()
+	if err != nil {
+		return page, err
+	}
+
+	page.Total = len(matches)
+	// Newest first: walk backwards from the end, skipping Offset entries.
+	for i := len(matches) - 1 - q.Offset; i >= 0 && len(page.Entries) < q.Limit; i-- {
+		page.Entries = append(page.Entries, matches[i])
+	}
+	return page, nil
+}
+
+// Close flushes and closes the audit file and the syslog connection.
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var errs []error
+	if l.file != nil {
+		errs = append(errs, l.file.Close())
+		l.file = nil
+	}
+	if l.sys != nil {
+		errs = append(errs, l.sys.Close())
+		l.sys = nil
+	}
+	return errors.Join(errs...)
+}
+
+// scan calls fn for every parseable entry in the audit file, oldest first.
+func (l *Logger) scan(fn func(Entry)) error {
+	f, err := os.Open(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("audit: %w", err)
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for sc.Scan() {
+		var e Entry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			continue // skip a torn last line after a crash
+		}
+		fn(e)
+	}
+	return sc.Err()
+}
+
+func (q Query) matches(e Entry) bool {
+	if q.Action != "" {
+		if strings.HasSuffix(q.Action, ".") {
+			if !strings.HasPrefix(e.Action, q.Action) {
+				return false
+			}
+		} else if e.Action != q.Action {
+			return false
+		}
+	}
+	if q.Actor != "" && !strings.EqualFold(e.Actor, q.Actor) {
+		return false
+	}
+	if q.IP != "" && e.IP != q.IP {
+		return false
+	}
+	if !q.Since.IsZero() && e.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && e.Time.After(q.Until) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,35 @@
+package audit
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/phil-bot/rsyslox/internal/config"
+)
+
+func TestRecordAfterEnabledByReload(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Audit.File = filepath.Join(t.TempDir(), "audit.log")
+	live := config.NewLive(cfg)
+
+	l, err := Open(live)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer l.Close()
+	l.Record(Entry{Action: ActionLogin})
+
+	live.Update(func(next *config.Config) error { //nolint:errcheck
+		next.Audit.Enabled = true
+		return nil
+	})
+	l.Record(Entry{Action: ActionConfigReload})
+
+	page, err := l.Query(Query{Limit: 10})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if len(page.Entries) != 1 || page.Entries[0].Action != ActionConfigReload {
+		t.Fatalf("entries = %+v, want only the one recorded while enabled", page.Entries)
+	}
+}
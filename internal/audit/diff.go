@@ -0,0 +1,133 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/phil-bot/rsyslox/internal/config"
+)
+
+// redacted replaces secret values in diffs and redacted snapshots.
+const redacted = "[redacted]"
+
+// secretKeys are substrings of config keys whose values never appear in
+// the audit log or the config history. A change is still recorded, just
+// without the values.
+var secretKeys = []string{
+	"password",       // database.password, auth.ldap.bind_password, auth.admin_password_hash
+	"hash",           // auth.read_only_keys[].key_hash and previous_key_hash
+	"secret",         // auth.totp_secret
+	"recovery_codes", // auth.totp_recovery_codes (hashes)
+}
+
+// Change is one modified configuration value.
+type Change struct {
+	Field  string `json:"field"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// Snapshot flattens cfg into dotted TOML keys ("server.port",
+// "auth.read_only_keys[0].name") so two snapshots can be compared with Diff.
+// Values are kept verbatim; redaction happens in Diff and Redact.
+func Snapshot(cfg *config.Config) map[string]string {
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(cfg); err != nil {
+		return map[string]string{}
+	}
+	var tree map[string]any
+	if _, err := toml.Decode(buf.String(), &tree); err != nil {
+		return map[string]string{}
+	}
+	flat := make(map[string]string)
+	flatten("", tree, flat)
+	return flat
+}
+
+// Diff returns the fields that differ between two snapshots, sorted by
+// name. Values of secret fields are replaced with "[redacted]".
+func Diff(before, after map[string]string) []Change {
+	var changes []Change
+	seen := make(map[string]bool, len(after))
+	for k, a := range after {
+		seen[k] = true
+		if b, ok := before[k]; !ok || b != a {
+			changes = append(changes, change(k, before[k], a))
+		}
+	}
+	for k, b := range before {
+		if !seen[k] {
+			changes = append(changes, change(k, b, ""))
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes
+}
+
+// Redact returns a copy of a snapshot with the values of secret fields
+// replaced with "[redacted]", for showing a whole configuration. Empty
+// values stay empty, so it is still visible which secrets are set.
+func Redact(snapshot map[string]string) map[string]string {
+	out := make(map[string]string, len(snapshot))
+	for k, v := range snapshot {
+		out[k] = redact(k, v)
+	}
+	return out
+}
+
+func change(field, before, after string) Change {
+	return Change{Field: field, Before: redact(field, before), After: redact(field, after)}
+}
+
+// redact returns value, or "[redacted]" when field is a secret and set.
+func redact(field, value string) string {
+	if value != "" && IsSecret(field) {
+		return redacted
+	}
+	return value
+}
+
+// IsSecret reports whether the value of the config key field is a secret
+// (password, hash, TOTP secret, …) that must not be shown.
+func IsSecret(field string) bool {
+	if i := strings.LastIndex(field, "."); i >= 0 {
+		field = field[i+1:]
+	}
+	for _, s := range secretKeys {
+		if strings.Contains(field, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// flatten walks a decoded TOML tree. Tables become dotted keys, arrays of
+// tables become indexed keys, and plain arrays are rendered as JSON.
+func flatten(prefix string, v any, out map[string]string) {
+	join := func(k string) string {
+		if prefix == "" {
+			return k
+		}
+		return prefix + "." + k
+	}
+	switch t := v.(type) {
+	case map[string]any:
+		for k, sub := range t {
+			flatten(join(k), sub, out)
+		}
+	case []map[string]any:
+		for i, sub := range t {
+			flatten(fmt.Sprintf("%s[%d]", prefix, i), sub, out)
+		}
+	case []any:
+		b, _ := json.Marshal(t)
+		out[prefix] = string(b)
+	default:
+		out[prefix] = fmt.Sprint(t)
+	}
+}
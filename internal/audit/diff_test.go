@@ -0,0 +1,64 @@
+package audit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/phil-bot/rsyslox/internal/config"
+)
+
+func TestIsSecret(t *testing.T) {
+	tests := []struct {
+		field string
+		want  bool
+	}{
+		{"database.password", true},
+		{"auth.ldap.bind_password", true},
+		{"auth.admin_password_hash", true},
+		{"auth.read_only_keys[0].key_hash", true},
+		{"auth.read_only_keys[3].previous_key_hash", true},
+		{"auth.totp_secret", true},
+		{"auth.totp_recovery_codes", true},
+		{"auth.read_only_keys[0].name", false},
+		{"database.user", false},
+		{"server.port", false},
+	}
+	for _, tt := range tests {
+		if got := IsSecret(tt.field); got != tt.want {
+			t.Errorf("IsSecret(%q) = %v, want %v", tt.field, got, tt.want)
+		}
+	}
+}
+
+func TestRedactSnapshot(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Database.Password = "enc:db"
+	cfg.Auth.AdminPasswordHash = "$2a$10$admin"
+	cfg.Auth.TOTPSecret = "enc:totp"
+	cfg.Auth.TOTPRecoveryCodes = []string{"code1", "code2"}
+	cfg.Auth.LDAP.BindPassword = "enc:bind"
+	cfg.Auth.ReadOnlyKeys = []config.ReadOnlyKey{{
+		Name:              "grafana",
+		KeyHash:           "current",
+		PreviousKeyHash:   "previous",
+		PreviousExpiresAt: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+	}}
+
+	snap := Redact(Snapshot(cfg))
+	for _, field := range []string{
+		"database.password",
+		"auth.admin_password_hash",
+		"auth.totp_secret",
+		"auth.totp_recovery_codes",
+		"auth.ldap.bind_password",
+		"auth.read_only_keys[0].key_hash",
+		"auth.read_only_keys[0].previous_key_hash",
+	} {
+		if got := snap[field]; got != redacted {
+			t.Errorf("%s = %q, want %q", field, got, redacted)
+		}
+	}
+	if got := snap["auth.read_only_keys[0].name"]; got != "grafana" {
+		t.Errorf("auth.read_only_keys[0].name = %q, want %q", got, "grafana")
+	}
+}
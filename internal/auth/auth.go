@@ -5,7 +5,11 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"log/slog"
+	"sync"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 
@@ -14,6 +18,18 @@ import (
 
 const bcryptCost = 12
 
+// LocalAdminUser is the username of the built-in admin account whose
+// bcrypt hash is stored in config.Auth.AdminPasswordHash.
+const LocalAdminUser = "admin"
+
+// ErrInvalidCredentials is returned when a login attempt is rejected.
+// It deliberately does not say whether the user or the password was wrong.
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// ErrKeyExpired is returned for a read-only API key past its expiry date,
+// or for the old secret of a rotated key after the overlap window.
+var ErrKeyExpired = errors.New("api key expired")
+
 // Role represents the access level of an authenticated caller.
 type Role int
 
@@ -23,14 +39,89 @@ const (
 	RoleAdmin                // valid admin password (session token)
 )
 
+// String returns the role name used in API responses.
+func (r Role) String() string {
+	switch r {
+	case RoleReadOnly:
+		return "readonly"
+	case RoleAdmin:
+		return "admin"
+	default:
+		return "none"
+	}
+}
+
+// parseRole is the inverse of Role.String.
+func parseRole(s string) Role {
+	switch s {
+	case "readonly":
+		return RoleReadOnly
+	case "admin":
+		return RoleAdmin
+	default:
+		return RoleNone
+	}
+}
+
+// Identity describes an authenticated UI user.
+type Identity struct {
+	Username string
+	Role     Role
+	Source   string // "local" | "ldap"
+}
+
 // Manager handles password hashing and API key validation.
 type Manager struct {
-	cfg *config.Config
+	live *config.Live
+
+	usage *KeyUsage
+
+	mu           sync.Mutex
+	lastTOTPStep int64 // highest accepted TOTP time step (replay protection)
 }
 
-// New creates a new Manager.
-func New(cfg *config.Config) *Manager {
-	return &Manager{cfg: cfg}
+// New creates a new Manager reading the auth settings from live.
+func New(live *config.Live) *Manager {
+	return &Manager{
+		live:  live,
+		usage: NewKeyUsage(live.Get().Auth.KeyUsageFile),
+	}
+}
+
+// KeyUsage returns the last-used tracker for read-only keys.
+func (m *Manager) KeyUsage() *KeyUsage {
+	return m.usage
+}
+
+// Authenticate verifies a username/password pair.
+// When LDAP is enabled it is tried first; the local admin account is only
+// consulted afterwards if auth.ldap.local_fallback is set. An empty username
+// means the local admin account.
+func (m *Manager) Authenticate(username, password string) (*Identity, error) {
+	if username == "" {
+		username = LocalAdminUser
+	}
+
+	cfg := m.live.Get()
+	if cfg.Auth.LDAP.Enabled {
+		id, err := NewLDAPAuthenticator(&cfg.Auth.LDAP).Authenticate(username, password)
+		if err == nil {
+			return id, nil
+		}
+		// Plain ErrInvalidCredentials is the normal wrong-password case;
+		// anything else (including wrapped rejections) is worth a log line.
+		if err != ErrInvalidCredentials { //nolint:errorlint
+			slog.Info("LDAP: login failed", "user", username, "err", err)
+		}
+		if !cfg.Auth.LDAP.LocalFallback {
+			return nil, ErrInvalidCredentials
+		}
+	}
+
+	if username == LocalAdminUser && m.VerifyAdminPassword(password) {
+		return &Identity{Username: LocalAdminUser, Role: RoleAdmin, Source: "local"}, nil
+	}
+	return nil, ErrInvalidCredentials
 }
 
 // HashAdminPassword hashes a plaintext password using bcrypt.
@@ -46,7 +137,7 @@ func HashAdminPassword(plaintext string) (string, error) {
 // VerifyAdminPassword checks a plaintext password against the stored bcrypt hash.
 func (m *Manager) VerifyAdminPassword(plaintext string) bool {
 	err := bcrypt.CompareHashAndPassword(
-		[]byte(m.cfg.Auth.AdminPasswordHash),
+		[]byte(m.live.Get().Auth.AdminPasswordHash),
 		[]byte(plaintext),
 	)
 	return err == nil
@@ -65,15 +156,46 @@ func GenerateReadOnlyKey() (plaintext, hash string, err error) {
 }
 
 // VerifyReadOnlyKey checks whether the given API key matches any stored read-only key.
-// Returns the name of the matching key, or empty string if none matches.
-func (m *Manager) VerifyReadOnlyKey(key string) string {
+// Returns the name of the matching key. The previous secret of a rotated key
+// is accepted until its overlap window ends. Returns ErrKeyExpired for a
+// known key past its expiry date and ErrInvalidCredentials otherwise.
+func (m *Manager) VerifyReadOnlyKey(key string) (string, error) {
 	h := hashKey(key)
-	for _, k := range m.cfg.Auth.ReadOnlyKeys {
-		if k.KeyHash == h {
-			return k.Name
+	now := time.Now()
+	for _, k := range m.live.Get().Auth.ReadOnlyKeys {
+		current := k.KeyHash == h
+		previous := k.PreviousKeyHash != "" && k.PreviousKeyHash == h
+		if !current && !previous {
+			continue
+		}
+		if KeyExpired(k, now) || (previous && !now.Before(k.PreviousExpiresAt)) {
+			return k.Name, ErrKeyExpired
 		}
+		return k.Name, nil
 	}
-	return ""
+	return "", ErrInvalidCredentials
+}
+
+// KeyRateLimit returns the per-key request limit of the named key,
+// or 0 when the key uses the global default.
+func (m *Manager) KeyRateLimit(name string) int {
+	for _, k := range m.live.Get().Auth.ReadOnlyKeys {
+		if k.Name == name {
+			return k.RateLimit
+		}
+	}
+	return 0
+}
+
+// SessionID returns the public ID of the session behind token, as shown
+// in the session list. It does not check that the session exists.
+func SessionID(token string) string {
+	return hashKey(token)[:16]
+}
+
+// KeyExpired reports whether k has an expiry date that has passed.
+func KeyExpired(k config.ReadOnlyKey, now time.Time) bool {
+	return !k.ExpiresAt.IsZero() && !now.Before(k.ExpiresAt)
 }
 
 // hashKey returns the hex-encoded SHA-256 hash of a key.
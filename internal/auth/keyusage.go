@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/phil-bot/rsyslox/internal/fileutil"
+)
+
+// keyUsageFlushInterval bounds how often usage data is written to disk.
+// Between flushes it is only kept in memory, so a crash loses at most this
+// much history — acceptable for "last used" information.
+const keyUsageFlushInterval = 5 * time.Minute
+
+// KeyUsageInfo is the last recorded use of a read-only key.
+type KeyUsageInfo struct {
+	LastUsed time.Time `json:"last_used"`
+	LastIP   string    `json:"last_ip"`
+}
+
+// KeyUsage tracks when and from where each read-only key was last used.
+// Records are updated in memory on every request and written to a small
+// JSON file in the background, so API traffic never rewrites config.toml.
+type KeyUsage struct {
+	path string // empty: memory only
+
+	mu    sync.Mutex
+	usage map[string]KeyUsageInfo // keyed by key name
+	dirty bool
+}
+
+// NewKeyUsage loads previously recorded usage from path and starts the
+// background flush.
+func NewKeyUsage(path string) *KeyUsage {
+	u := &KeyUsage{path: path, usage: make(map[string]KeyUsageInfo)}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+		case err != nil:
+			slog.Warn("Could not read key usage", "path", path, "err", err)
+		default:
+			if err := json.Unmarshal(data, &u.usage); err != nil {
+				slog.Warn("Could not parse key usage", "path", path, "err", err)
+			}
+		}
+	}
+	go u.flushLoop()
+	return u
+}
+
+// Record notes a use of the named key from ip.
+func (u *KeyUsage) Record(name, ip string) {
+	u.mu.Lock()
+	u.usage[name] = KeyUsageInfo{LastUsed: time.Now().UTC(), LastIP: ip}
+	u.dirty = true
+	u.mu.Unlock()
+}
+
+// Get returns the last recorded use of the named key.
+func (u *KeyUsage) Get(name string) (KeyUsageInfo, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	info, ok := u.usage[name]
+	return info, ok
+}
+
+// Forget drops the record of a deleted key.
+func (u *KeyUsage) Forget(name string) {
+	u.mu.Lock()
+	if _, ok := u.usage[name]; ok {
+		delete(u.usage, name)
+		u.dirty = true
+	}
+	u.mu.Unlock()
+}
+
+// Flush writes pending changes to disk. Called periodically and on shutdown.
+func (u *KeyUsage) Flush() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if !u.dirty || u.path == "" {
+		return
+	}
+	data, err := json.MarshalIndent(u.usage, "", "  ")
+	if err == nil {
+		err = fileutil.WriteAtomic(u.path, data, 0600)
+	}
+	if err != nil {
+		slog.Warn("Failed to write key usage", "err", err)
+		return
+	}
+	u.dirty = false
+}
+
+func (u *KeyUsage) flushLoop() {
+	ticker := time.NewTicker(keyUsageFlushInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		u.Flush()
+	}
+}
@@ -0,0 +1,277 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+
+	"github.com/phil-bot/rsyslox/internal/config"
+)
+
+// LDAPConn is the subset of *ldap.Conn used by LDAPAuthenticator.
+// Tests can substitute an in-process fake via LDAPAuthenticator.Dial.
+type LDAPConn interface {
+	Bind(username, password string) error
+	Search(req *ldap.SearchRequest) (*ldap.SearchResult, error)
+	Close() error
+}
+
+// LDAPAuthenticator verifies logins against an LDAP or Active Directory server:
+//
+//  1. bind as the service account (bind_dn / bind_password)
+//  2. search user_base_dn for exactly one entry matching user_filter
+//  3. bind as that entry with the supplied password
+//  4. map the entry's groups to a Role via admin_groups / read_only_groups
+type LDAPAuthenticator struct {
+	cfg *config.LDAPConfig
+
+	// Dial opens a connection to the directory. Defaults to dialLDAP.
+	Dial func(cfg *config.LDAPConfig) (LDAPConn, error)
+}
+
+// NewLDAPAuthenticator creates an authenticator for the settings in cfg.
+// The Manager creates one per login, so config changes apply to the next one.
+func NewLDAPAuthenticator(cfg *config.LDAPConfig) *LDAPAuthenticator {
+	return &LDAPAuthenticator{cfg: cfg, Dial: dialLDAP}
+}
+
+// Authenticate performs the search-and-bind sequence for username.
+// Returns ErrInvalidCredentials when the user does not exist, the password
+// is wrong or the user is not a member of any mapped group; other errors
+// indicate a configuration or connectivity problem.
+func (a *LDAPAuthenticator) Authenticate(username, password string) (*Identity, error) {
+	// An empty password would be an unauthenticated bind, which many
+	// servers accept — never treat that as a successful login.
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := a.Dial(a.cfg)
+	if err != nil {
+		return nil, fmt.Errorf("ldap: connect: %w", err)
+	}
+	defer conn.Close()
+
+	if err := a.serviceBind(conn); err != nil {
+		return nil, err
+	}
+
+	entry, err := a.findUser(conn, username)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("ldap: user bind: %w", err)
+	}
+
+	// Group searches run with the service account's privileges, not the user's.
+	groups := entry.GetAttributeValues(a.cfg.GroupAttribute)
+	if a.cfg.GroupBaseDN != "" {
+		if err := a.serviceBind(conn); err != nil {
+			return nil, err
+		}
+		groups, err = a.searchGroups(conn, entry.DN, username)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	role := a.mapRole(groups)
+	if role == RoleNone {
+		return nil, fmt.Errorf("%w: %s is not a member of any mapped group", ErrInvalidCredentials, entry.DN)
+	}
+
+	return &Identity{Username: username, Role: role, Source: "ldap"}, nil
+}
+
+// Check connects to the directory and binds as the service account, to
+// verify the settings without a user login.
+func (a *LDAPAuthenticator) Check() error {
+	conn, err := a.Dial(a.cfg)
+	if err != nil {
+		return fmt.Errorf("ldap: %w", err)
+	}
+	defer conn.Close()
+	return a.serviceBind(conn)
+}
+
+// serviceBind binds as the configured service account.
+// Without a bind_dn the search runs anonymously.
+func (a *LDAPAuthenticator) serviceBind(conn LDAPConn) error {
+	if a.cfg.BindDN == "" {
+		return nil
+	}
+	pass, err := config.DecryptPassword(a.cfg.BindPassword)
+	if err != nil {
+		return fmt.Errorf("ldap: %w", err)
+	}
+	if err := conn.Bind(a.cfg.BindDN, pass); err != nil {
+		return fmt.Errorf("ldap: service bind as %s: %w", a.cfg.BindDN, err)
+	}
+	return nil
+}
+
+// findUser returns the single entry matching user_filter for username.
+func (a *LDAPAuthenticator) findUser(conn LDAPConn, username string) (*ldap.Entry, error) {
+	filter := a.cfg.UserFilter
+	if filter == "" {
+		filter = "(uid=%s)"
+	}
+	attrs := []string{"dn"}
+	if a.cfg.GroupAttribute != "" {
+		attrs = append(attrs, a.cfg.GroupAttribute)
+	}
+
+	res, err := conn.Search(ldap.NewSearchRequest(
+		a.cfg.UserBaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, a.timeLimit(), false,
+		strings.ReplaceAll(filter, "%s", ldap.EscapeFilter(username)),
+		attrs,
+		nil,
+	))
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+			return nil, fmt.Errorf("ldap: user filter matches more than one entry for %q", username)
+		}
+		return nil, fmt.Errorf("ldap: user search: %w", err)
+	}
+	switch len(res.Entries) {
+	case 0:
+		return nil, ErrInvalidCredentials
+	case 1:
+		return res.Entries[0], nil
+	default:
+		return nil, fmt.Errorf("ldap: user filter matches more than one entry for %q", username)
+	}
+}
+
+// searchGroups returns the DNs of all groups below group_base_dn that
+// match group_filter for the given user.
+func (a *LDAPAuthenticator) searchGroups(conn LDAPConn, userDN, username string) ([]string, error) {
+	filter := strings.NewReplacer(
+		"{dn}", ldap.EscapeFilter(userDN),
+		"{username}", ldap.EscapeFilter(username),
+	).Replace(a.cfg.GroupFilter)
+
+	res, err := conn.Search(ldap.NewSearchRequest(
+		a.cfg.GroupBaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		0, a.timeLimit(), false,
+		filter,
+		[]string{"dn"},
+		nil,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("ldap: group search: %w", err)
+	}
+	groups := make([]string, len(res.Entries))
+	for i, e := range res.Entries {
+		groups[i] = e.DN
+	}
+	return groups, nil
+}
+
+// mapRole returns the highest role granted by any of the given group DNs.
+func (a *LDAPAuthenticator) mapRole(groups []string) Role {
+	if matchesAnyDN(groups, a.cfg.AdminGroups) {
+		return RoleAdmin
+	}
+	if matchesAnyDN(groups, a.cfg.ReadOnlyGroups) {
+		return RoleReadOnly
+	}
+	return RoleNone
+}
+
+func (a *LDAPAuthenticator) timeLimit() int {
+	if a.cfg.Timeout <= 0 {
+		return 0
+	}
+	return int(a.cfg.Timeout.Seconds())
+}
+
+// matchesAnyDN reports whether any DN in have equals any DN in want.
+// DNs are compared after normalisation so that case and spacing differences
+// between the directory and config.toml do not matter.
+func matchesAnyDN(have, want []string) bool {
+	for _, w := range want {
+		wdn, err := ldap.ParseDN(w)
+		if err != nil {
+			continue
+		}
+		for _, h := range have {
+			hdn, err := ldap.ParseDN(h)
+			if err != nil {
+				continue
+			}
+			if wdn.EqualFold(hdn) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// dialLDAP connects to cfg.URL, honouring ldaps://, StartTLS and the
+// configured CA bundle.
+func dialLDAP(cfg *config.LDAPConfig) (LDAPConn, error) {
+	tlsCfg, err := ldapTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+
+	conn, err := ldap.DialURL(cfg.URL, ldap.DialWithTLSConfig(tlsCfg))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(timeout)
+
+	if cfg.StartTLS && !strings.HasPrefix(strings.ToLower(cfg.URL), "ldaps://") {
+		if err := conn.StartTLS(tlsCfg); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("StartTLS: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// ldapTLSConfig builds the TLS settings for LDAPS and StartTLS.
+func ldapTLSConfig(cfg *config.LDAPConfig) (*tls.Config, error) {
+	tlsCfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.InsecureSkipVerify, //nolint:gosec // explicit opt-in for test directories
+	}
+	// StartTLS upgrades an existing connection, so crypto/tls cannot infer
+	// the server name from the dial address.
+	if u, err := url.Parse(cfg.URL); err == nil {
+		tlsCfg.ServerName = u.Hostname()
+	}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ca_file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("ca_file contains no PEM certificates")
+		}
+		tlsCfg.RootCAs = pool
+	}
+	return tlsCfg, nil
+}
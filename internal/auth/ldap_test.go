@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+
+	"github.com/phil-bot/rsyslox/internal/config"
+)
+
+// fakeDirectory is an in-process LDAPConn. Binds succeed for the DNs in
+// passwords; searches return the entries stored under their base DN.
+type fakeDirectory struct {
+	passwords map[string]string
+	entries   map[string][]*ldap.Entry
+	searches  []string // filters of all searches, in order
+}
+
+func (d *fakeDirectory) Bind(username, password string) error {
+	if pw, ok := d.passwords[username]; ok && pw == password {
+		return nil
+	}
+	return ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("invalid credentials"))
+}
+
+func (d *fakeDirectory) Search(req *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	d.searches = append(d.searches, req.Filter)
+	return &ldap.SearchResult{Entries: d.entries[req.BaseDN]}, nil
+}
+
+func (d *fakeDirectory) Close() error { return nil }
+
+func TestLDAPAuthenticate(t *testing.T) {
+	const (
+		users  = "ou=people,dc=example,dc=org"
+		groups = "ou=groups,dc=example,dc=org"
+		alice  = "uid=alice,ou=people,dc=example,dc=org"
+		admins = "cn=admins,ou=groups,dc=example,dc=org"
+		ops    = "cn=ops,ou=groups,dc=example,dc=org"
+	)
+	entry := func(dn string, memberOf ...string) *ldap.Entry {
+		return ldap.NewEntry(dn, map[string][]string{"memberOf": memberOf})
+	}
+
+	tests := []struct {
+		name     string
+		cfg      config.LDAPConfig
+		entries  map[string][]*ldap.Entry
+		password string
+		want     Role
+		wantErr  error // nil: any error is accepted when want is RoleNone
+	}{
+		{
+			name:     "empty password",
+			entries:  map[string][]*ldap.Entry{users: {entry(alice, admins)}},
+			password: "",
+			wantErr:  ErrInvalidCredentials,
+		},
+		{
+			name:     "no matching entry",
+			password: "secret",
+			wantErr:  ErrInvalidCredentials,
+		},
+		{
+			name:     "several matching entries",
+			entries:  map[string][]*ldap.Entry{users: {entry(alice, admins), entry("uid=alice,ou=other,dc=example,dc=org", admins)}},
+			password: "secret",
+		},
+		{
+			name:     "wrong password",
+			entries:  map[string][]*ldap.Entry{users: {entry(alice, admins)}},
+			password: "wrong",
+			wantErr:  ErrInvalidCredentials,
+		},
+		{
+			name:     "admin group from attribute",
+			entries:  map[string][]*ldap.Entry{users: {entry(alice, admins)}},
+			password: "secret",
+			want:     RoleAdmin,
+		},
+		{
+			name:     "read-only group from attribute",
+			entries:  map[string][]*ldap.Entry{users: {entry(alice, ops)}},
+			password: "secret",
+			want:     RoleReadOnly,
+		},
+		{
+			name:     "no mapped group",
+			entries:  map[string][]*ldap.Entry{users: {entry(alice, "cn=other,ou=groups,dc=example,dc=org")}},
+			password: "secret",
+			wantErr:  ErrInvalidCredentials,
+		},
+		{
+			name: "groups from group_base_dn",
+			cfg:  config.LDAPConfig{GroupBaseDN: groups, GroupFilter: "(member={dn})"},
+			entries: map[string][]*ldap.Entry{
+				users:  {entry(alice)},
+				groups: {entry(ops)},
+			},
+			password: "secret",
+			want:     RoleReadOnly,
+		},
+		{
+			name:     "DNs compared case-insensitively",
+			entries:  map[string][]*ldap.Entry{users: {entry(alice, "CN=Admins, OU=Groups, DC=Example, DC=Org")}},
+			password: "secret",
+			want:     RoleAdmin,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			cfg.UserBaseDN = users
+			cfg.GroupAttribute = "memberOf"
+			cfg.AdminGroups = []string{admins}
+			cfg.ReadOnlyGroups = []string{ops}
+			dir := &fakeDirectory{
+				passwords: map[string]string{alice: "secret"},
+				entries:   tt.entries,
+			}
+			a := NewLDAPAuthenticator(&cfg)
+			a.Dial = func(*config.LDAPConfig) (LDAPConn, error) { return dir, nil }
+
+			id, err := a.Authenticate("alice", tt.password)
+			if tt.want == RoleNone {
+				if err == nil {
+					t.Fatalf("Authenticate succeeded with role %s, want error", id.Role)
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Authenticate error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authenticate: %v", err)
+			}
+			if id.Role != tt.want || id.Username != "alice" || id.Source != "ldap" {
+				t.Errorf("Authenticate = %+v, want role %s", id, tt.want)
+			}
+		})
+	}
+}
+
+func TestLDAPGroupFilterEscapesDN(t *testing.T) {
+	const dn = "uid=a(b),ou=people,dc=example,dc=org"
+	dir := &fakeDirectory{
+		passwords: map[string]string{dn: "secret"},
+		entries:   map[string][]*ldap.Entry{"ou=people,dc=example,dc=org": {ldap.NewEntry(dn, nil)}},
+	}
+	a := NewLDAPAuthenticator(&config.LDAPConfig{
+		UserBaseDN:  "ou=people,dc=example,dc=org",
+		GroupBaseDN: "ou=groups,dc=example,dc=org",
+		GroupFilter: "(member={dn})",
+	})
+	a.Dial = func(*config.LDAPConfig) (LDAPConn, error) { return dir, nil }
+
+	a.Authenticate("a(b)", "secret") //nolint:errcheck // no groups, fails by design
+	if len(dir.searches) != 2 {
+		t.Fatalf("got %d searches, want user and group search", len(dir.searches))
+	}
+	if want := `(member=uid=a\28b\29,ou=people,dc=example,dc=org)`; dir.searches[1] != want {
+		t.Errorf("group filter = %q, want %q", dir.searches[1], want)
+	}
+}
@@ -0,0 +1,232 @@
+package auth
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/phil-bot/rsyslox/internal/config"
+)
+
+// maxLockoutShift caps the exponent so the backoff cannot overflow.
+const maxLockoutShift = 20
+
+// clientFailures tracks failed logins from one IP address.
+type clientFailures struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// LoginLimiter slows down password guessing on the admin login.
+// Failures are tracked per client IP and globally; see config.LockoutConfig
+// for the thresholds. State is in memory and resets on restart.
+type LoginLimiter struct {
+	live *config.Live
+
+	mu          sync.Mutex
+	clients     map[string]*clientFailures
+	global      []time.Time // failure times within the window, oldest first
+	globalUntil time.Time
+}
+
+// NewLoginLimiter creates a limiter reading its thresholds from the
+// auth.lockout settings of live, so changes apply immediately.
+func NewLoginLimiter(live *config.Live) *LoginLimiter {
+	l := &LoginLimiter{
+		live:    live,
+		clients: make(map[string]*clientFailures),
+	}
+	go l.cleanupLoop()
+	return l
+}
+
+// ClientLockout describes the failure state of one client IP.
+type ClientLockout struct {
+	IP          string     `json:"ip"`
+	Failures    int        `json:"failures"`
+	LastFailure time.Time  `json:"last_failure"`
+	LockedUntil *time.Time `json:"locked_until,omitempty"`
+}
+
+// LockoutStatus is a snapshot of the limiter state for the admin UI.
+type LockoutStatus struct {
+	GlobalLockedUntil *time.Time      `json:"global_locked_until,omitempty"`
+	RecentFailures    int             `json:"recent_failures"` // all IPs, within the window
+	Clients           []ClientLockout `json:"clients"`
+}
+
+// Check returns how long ip has to wait before the next attempt,
+// or zero when a login attempt is allowed now.
+func (l *LoginLimiter) Check(ip string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	wait := l.globalUntil.Sub(now)
+	if c, ok := l.clients[ip]; ok {
+		if d := c.lockedUntil.Sub(now); d > wait {
+			wait = d
+		}
+	}
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+// Fail records a failed attempt from ip. It returns the number of
+// consecutive failures and the lockout now in effect for ip (zero if none).
+func (l *LoginLimiter) Fail(ip string) (int, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cfg := l.cfg()
+	now := time.Now()
+	window := cfg.Window
+
+	c, ok := l.clients[ip]
+	if !ok || (window > 0 && now.Sub(c.lastFailure) > window) {
+		c = &clientFailures{}
+		l.clients[ip] = c
+	}
+	c.failures++
+	c.lastFailure = now
+
+	var lockout time.Duration
+	if c.failures >= cfg.MaxAttempts {
+		lockout = backoff(cfg, c.failures-cfg.MaxAttempts)
+		c.lockedUntil = now.Add(lockout)
+	}
+
+	if cfg.GlobalMaxAttempts > 0 {
+		l.global = append(l.pruneGlobal(cfg, now), now)
+		if len(l.global) >= cfg.GlobalMaxAttempts {
+			l.globalUntil = now.Add(cfg.GlobalLockout)
+			l.global = l.global[:0]
+		}
+	}
+
+	return c.failures, lockout
+}
+
+// GlobalLocked reports whether the global lockout is in effect.
+func (l *LoginLimiter) GlobalLocked() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return time.Now().Before(l.globalUntil)
+}
+
+// Succeed forgets the failures of ip after a successful login.
+func (l *LoginLimiter) Succeed(ip string) {
+	l.mu.Lock()
+	delete(l.clients, ip)
+	l.mu.Unlock()
+}
+
+// Clear lifts the lockout of a single IP. Returns false if ip is unknown.
+func (l *LoginLimiter) Clear(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.clients[ip]; !ok {
+		return false
+	}
+	delete(l.clients, ip)
+	return true
+}
+
+// ClearAll lifts every per-IP lockout and the global lockout.
+func (l *LoginLimiter) ClearAll() {
+	l.mu.Lock()
+	l.clients = make(map[string]*clientFailures)
+	l.global = nil
+	l.globalUntil = time.Time{}
+	l.mu.Unlock()
+}
+
+// Status returns the current state, most recent failures first.
+func (l *LoginLimiter) Status() LockoutStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cfg := l.cfg()
+	now := time.Now()
+	l.global = l.pruneGlobal(cfg, now)
+
+	st := LockoutStatus{
+		RecentFailures: len(l.global),
+		Clients:        make([]ClientLockout, 0, len(l.clients)),
+	}
+	if now.Before(l.globalUntil) {
+		until := l.globalUntil
+		st.GlobalLockedUntil = &until
+	}
+	for ip, c := range l.clients {
+		if expired(cfg, c, now) {
+			continue
+		}
+		entry := ClientLockout{IP: ip, Failures: c.failures, LastFailure: c.lastFailure}
+		if now.Before(c.lockedUntil) {
+			until := c.lockedUntil
+			entry.LockedUntil = &until
+		}
+		st.Clients = append(st.Clients, entry)
+	}
+	sort.Slice(st.Clients, func(i, j int) bool {
+		return st.Clients[i].LastFailure.After(st.Clients[j].LastFailure)
+	})
+	return st
+}
+
+// cfg returns the current lockout settings.
+func (l *LoginLimiter) cfg() *config.LockoutConfig {
+	return &l.live.Get().Auth.Lockout
+}
+
+// backoff returns BaseLockout doubled n times, capped at MaxLockout.
+func backoff(cfg *config.LockoutConfig, n int) time.Duration {
+	if n > maxLockoutShift {
+		n = maxLockoutShift
+	}
+	d := cfg.BaseLockout << uint(n)
+	if cfg.MaxLockout > 0 && d > cfg.MaxLockout {
+		d = cfg.MaxLockout
+	}
+	return d
+}
+
+// pruneGlobal drops global failure times older than the window.
+func (l *LoginLimiter) pruneGlobal(cfg *config.LockoutConfig, now time.Time) []time.Time {
+	if cfg.Window <= 0 {
+		return l.global
+	}
+	i := 0
+	for i < len(l.global) && now.Sub(l.global[i]) > cfg.Window {
+		i++
+	}
+	return l.global[i:]
+}
+
+// expired reports whether a client record can be forgotten.
+func expired(cfg *config.LockoutConfig, c *clientFailures, now time.Time) bool {
+	return now.After(c.lockedUntil) &&
+		cfg.Window > 0 && now.Sub(c.lastFailure) > cfg.Window
+}
+
+// cleanupLoop periodically removes records that no longer matter.
+func (l *LoginLimiter) cleanupLoop() {
+	ticker := time.NewTicker(5 * time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		l.mu.Lock()
+		cfg := l.cfg()
+		now := time.Now()
+		for ip, c := range l.clients {
+			if expired(cfg, c, now) {
+				delete(l.clients, ip)
+			}
+		}
+		l.global = l.pruneGlobal(cfg, now)
+		l.mu.Unlock()
+	}
+}
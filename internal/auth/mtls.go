@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"crypto/x509"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/phil-bot/rsyslox/internal/config"
+)
+
+// VerifyClientCert maps a client certificate that was already verified
+// against auth.mtls.client_ca to its access rights. A mapping with a role
+// yields an Identity named after the mapping; a mapping to a read-only key
+// yields the key name instead, so the key's expiry, rate limit and usage
+// tracking apply. Returns ErrKeyExpired when the mapped key has expired and
+// ErrInvalidCredentials when no mapping matches.
+func (m *Manager) VerifyClientCert(cert *x509.Certificate) (*Identity, string, error) {
+	cfg := m.live.Get()
+	mapping, ok := MatchCertMapping(cfg.Auth.MTLS.Mappings, cert)
+	if !ok {
+		return nil, "", ErrInvalidCredentials
+	}
+	if mapping.Key == "" {
+		return &Identity{Username: mapping.Name, Role: parseRole(mapping.Role), Source: "mtls"}, "", nil
+	}
+	for _, k := range cfg.Auth.ReadOnlyKeys {
+		if k.Name != mapping.Key {
+			continue
+		}
+		if KeyExpired(k, time.Now()) {
+			return nil, k.Name, ErrKeyExpired
+		}
+		return nil, k.Name, nil
+	}
+	slog.Warn("mTLS: mapping refers to an unknown key", "mapping", mapping.Name, "key", mapping.Key)
+	return nil, "", ErrInvalidCredentials
+}
+
+// MatchCertMapping returns the first mapping whose subject and SAN
+// conditions both hold for cert. Subjects are compared in the RFC 2253
+// form produced by pkix.Name.String, ignoring case.
+func MatchCertMapping(mappings []config.CertMapping, cert *x509.Certificate) (config.CertMapping, bool) {
+	subject := cert.Subject.String()
+	sans := CertSANs(cert)
+	for _, mp := range mappings {
+		if mp.Subject != "" && !strings.EqualFold(mp.Subject, subject) {
+			continue
+		}
+		if mp.SAN != "" && !containsFold(sans, mp.SAN) {
+			continue
+		}
+		return mp, true
+	}
+	return config.CertMapping{}, false
+}
+
+// CertSANs returns all subject alternative names of cert as strings.
+func CertSANs(cert *x509.Certificate) []string {
+	sans := make([]string, 0, len(cert.DNSNames)+len(cert.EmailAddresses)+len(cert.IPAddresses)+len(cert.URIs))
+	sans = append(sans, cert.DNSNames...)
+	sans = append(sans, cert.EmailAddresses...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	for _, u := range cert.URIs {
+		sans = append(sans, u.String())
+	}
+	return sans
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
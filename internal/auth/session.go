@@ -3,86 +3,411 @@ package auth
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
 	"sync"
 	"time"
+
+	"github.com/phil-bot/rsyslox/internal/config"
+	"github.com/phil-bot/rsyslox/internal/fileutil"
 )
 
-const sessionTTL = 8 * time.Hour
+const (
+	sessionTTL = 8 * time.Hour
+
+	// sessionFlushInterval bounds how often last-used times are written
+	// to the session file; creating and revoking sessions writes at once.
+	sessionFlushInterval = time.Minute
+
+	// pendingTTL bounds the time between password and TOTP step.
+	pendingTTL         = 5 * time.Minute
+	pendingMaxAttempts = 5
+)
 
+// session is one admin UI login. Only the SHA-256 hash of the token is
+// kept, so a leaked session file cannot be used to log in.
 type session struct {
-	token     string
+	ID        string    `json:"id"`
+	TokenHash string    `json:"token_hash"`
+	Username  string    `json:"username"`
+	Role      string    `json:"role"`
+	Source    string    `json:"source"`
+	CreatedAt time.Time `json:"created_at"`
+	LastUsed  time.Time `json:"last_used"`
+	ExpiresAt time.Time `json:"expires_at"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+}
+
+func (s *session) identity() Identity {
+	return Identity{Username: s.Username, Role: parseRole(s.Role), Source: s.Source}
+}
+
+// pendingLogin is a login that passed the password check and still
+// needs a second factor.
+type pendingLogin struct {
+	identity  Identity
 	expiresAt time.Time
+	attempts  int
+}
+
+// SessionInfo describes an active session for GET /api/admin/sessions.
+type SessionInfo struct {
+	ID        string    `json:"id"`
+	Username  string    `json:"username"`
+	Role      string    `json:"role"`
+	Source    string    `json:"source"`
+	CreatedAt time.Time `json:"created_at"`
+	LastUsed  time.Time `json:"last_used"`
+	ExpiresAt time.Time `json:"expires_at"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Current   bool      `json:"current"` // the session making the request
 }
 
-// SessionStore is a simple in-memory store for admin session tokens.
-// Tokens are invalidated on restart, which is acceptable for an admin UI.
+// SessionStore holds admin session tokens.
+//
+// With store = "memory" (the default) sessions are lost on restart. With
+// store = "file" they are written to auth.sessions.file so that restarts and
+// config changes do not log everybody out. Pending second-factor logins are
+// always kept in memory only.
 type SessionStore struct {
+	live *config.Live
+	file string // session file of the file store, "" for memory; fixed at startup
+
 	mu       sync.Mutex
-	sessions map[string]session
+	sessions map[string]*session // keyed by token hash
+	pending  map[string]*pendingLogin
+	dirty    bool // last-used times changed since the last write
 }
 
-// NewSessionStore creates an empty SessionStore.
-func NewSessionStore() *SessionStore {
+// NewSessionStore creates a SessionStore and, for the file store, loads
+// the sessions that were active before the last restart. The
+// auth.sessions settings are read from live, so changes to the lifetime
+// apply immediately; the store and file only change on restart.
+func NewSessionStore(live *config.Live) *SessionStore {
 	s := &SessionStore{
-		sessions: make(map[string]session),
+		live:     live,
+		sessions: make(map[string]*session),
+		pending:  make(map[string]*pendingLogin),
+	}
+	if cfg := live.Get().Auth.Sessions; cfg.Store == "file" {
+		s.file = cfg.File
+	}
+	if s.persistent() {
+		if err := s.load(); err != nil {
+			slog.Warn("Could not load sessions", "path", s.file, "err", err)
+		} else if len(s.sessions) > 0 {
+			slog.Info("Restored sessions", "sessions", len(s.sessions), "path", s.file)
+		}
 	}
 	go s.cleanupLoop()
 	return s
 }
 
-// Create generates a new session token and stores it.
-func (s *SessionStore) Create() (string, error) {
+// newToken returns 32 random bytes, hex encoded.
+func newToken() (string, error) {
 	raw := make([]byte, 32)
 	if _, err := rand.Read(raw); err != nil {
 		return "", err
 	}
-	token := hex.EncodeToString(raw)
+	return hex.EncodeToString(raw), nil
+}
+
+// Create generates a new session token for id and stores it.
+// ip and userAgent are shown in the session list.
+func (s *SessionStore) Create(id Identity, ip, userAgent string) (string, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
 
+	now := time.Now()
+	h := hashKey(token)
 	s.mu.Lock()
-	s.sessions[token] = session{
-		token:     token,
-		expiresAt: time.Now().Add(sessionTTL),
+	defer s.mu.Unlock()
+	s.sessions[h] = &session{
+		ID:        SessionID(token),
+		TokenHash: h,
+		Username:  id.Username,
+		Role:      id.Role.String(),
+		Source:    id.Source,
+		CreatedAt: now,
+		LastUsed:  now,
+		ExpiresAt: now.Add(sessionTTL),
+		IP:        ip,
+		UserAgent: userAgent,
 	}
-	s.mu.Unlock()
+	s.saveLocked()
 
 	return token, nil
 }
 
 // Validate checks whether a token is valid and not expired.
 func (s *SessionStore) Validate(token string) bool {
+	_, ok := s.Lookup(token)
+	return ok
+}
+
+// Lookup returns the identity behind a valid, unexpired token and records
+// the use. Sessions idle for longer than idle_timeout are ended here.
+func (s *SessionStore) Lookup(token string) (Identity, bool) {
+	if token == "" {
+		return Identity{}, false
+	}
+	h := hashKey(token)
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	sess, ok := s.sessions[token]
+	sess, ok := s.sessions[h]
 	if !ok {
-		return false
+		return Identity{}, false
 	}
-	if time.Now().After(sess.expiresAt) {
-		delete(s.sessions, token)
-		return false
+	now := time.Now()
+	if s.expired(sess, now) {
+		delete(s.sessions, h)
+		s.saveLocked()
+		return Identity{}, false
 	}
-	return true
+
+	sess.LastUsed = now
+	if s.live.Get().Auth.Sessions.Sliding {
+		sess.ExpiresAt = now.Add(sessionTTL)
+	}
+	s.dirty = true
+	return sess.identity(), true
+}
+
+// List returns all active sessions, most recently used first.
+// The session belonging to currentToken is flagged as Current.
+func (s *SessionStore) List(currentToken string) []SessionInfo {
+	current := ""
+	if currentToken != "" {
+		current = hashKey(currentToken)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	list := make([]SessionInfo, 0, len(s.sessions))
+	for h, sess := range s.sessions {
+		if s.expired(sess, now) {
+			continue
+		}
+		list = append(list, SessionInfo{
+			ID:        sess.ID,
+			Username:  sess.Username,
+			Role:      sess.Role,
+			Source:    sess.Source,
+			CreatedAt: sess.CreatedAt,
+			LastUsed:  sess.LastUsed,
+			ExpiresAt: s.effectiveExpiry(sess),
+			IP:        sess.IP,
+			UserAgent: sess.UserAgent,
+			Current:   h == current,
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].LastUsed.After(list[j].LastUsed) })
+	return list
+}
+
+// RevokeID ends the session with the given ID. Returns false if unknown.
+func (s *SessionStore) RevokeID(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for h, sess := range s.sessions {
+		if sess.ID == id {
+			delete(s.sessions, h)
+			s.saveLocked()
+			return true
+		}
+	}
+	return false
+}
+
+// RevokeOthers ends every session except the one for keepToken and
+// returns the number of sessions ended.
+func (s *SessionStore) RevokeOthers(keepToken string) int {
+	keep := hashKey(keepToken)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for h := range s.sessions {
+		if h != keep {
+			delete(s.sessions, h)
+			n++
+		}
+	}
+	if n > 0 {
+		s.saveLocked()
+	}
+	return n
+}
+
+// CreatePending stores a half-finished login and returns the token the
+// client must present together with its TOTP code.
+func (s *SessionStore) CreatePending(id Identity) (string, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	s.pending[token] = &pendingLogin{identity: id, expiresAt: time.Now().Add(pendingTTL)}
+	s.mu.Unlock()
+
+	return token, nil
+}
+
+// PendingIdentity returns the identity behind a pending login token.
+// Every call counts as an attempt; after pendingMaxAttempts the token is
+// discarded so the second factor cannot be brute-forced.
+func (s *SessionStore) PendingIdentity(token string) (Identity, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.pending[token]
+	if !ok {
+		return Identity{}, false
+	}
+	p.attempts++
+	if time.Now().After(p.expiresAt) || p.attempts > pendingMaxAttempts {
+		delete(s.pending, token)
+		return Identity{}, false
+	}
+	return p.identity, true
+}
+
+// CompletePending discards a pending login once the second factor succeeded.
+func (s *SessionStore) CompletePending(token string) {
+	s.mu.Lock()
+	delete(s.pending, token)
+	s.mu.Unlock()
 }
 
 // Revoke deletes a session token (logout).
 func (s *SessionStore) Revoke(token string) {
 	s.mu.Lock()
-	delete(s.sessions, token)
-	s.mu.Unlock()
+	defer s.mu.Unlock()
+	if _, ok := s.sessions[hashKey(token)]; ok {
+		delete(s.sessions, hashKey(token))
+		s.saveLocked()
+	}
+}
+
+// Flush writes pending last-used updates to the session file.
+// Called on shutdown; a no-op for the memory store.
+func (s *SessionStore) Flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dirty {
+		s.saveLocked()
+	}
+}
+
+// expired reports whether sess has passed its lifetime or idle timeout.
+func (s *SessionStore) expired(sess *session, now time.Time) bool {
+	return now.After(s.effectiveExpiry(sess))
 }
 
-// cleanupLoop periodically removes expired sessions.
+// effectiveExpiry is the earliest of the expiry, the idle deadline and
+// max_lifetime after login, which sliding renewal cannot extend.
+func (s *SessionStore) effectiveExpiry(sess *session) time.Time {
+	cfg := s.live.Get().Auth.Sessions
+	exp := sess.ExpiresAt
+	if idle := cfg.IdleTimeout; idle > 0 {
+		if d := sess.LastUsed.Add(idle); d.Before(exp) {
+			exp = d
+		}
+	}
+	if lifetime := cfg.MaxLifetime; lifetime > 0 {
+		if d := sess.CreatedAt.Add(lifetime); d.Before(exp) {
+			exp = d
+		}
+	}
+	return exp
+}
+
+func (s *SessionStore) persistent() bool {
+	return s.file != ""
+}
+
+// saveLocked writes all sessions to the session file. The caller must hold
+// s.mu. Errors are logged; the in-memory state stays authoritative.
+func (s *SessionStore) saveLocked() {
+	s.dirty = false
+	if !s.persistent() {
+		return
+	}
+	list := make([]*session, 0, len(s.sessions))
+	for _, sess := range s.sessions {
+		list = append(list, sess)
+	}
+	if err := writeSessionFile(s.file, list); err != nil {
+		slog.Warn("Failed to write session file", "err", err)
+	}
+}
+
+// load reads the session file, skipping sessions that have expired.
+func (s *SessionStore) load() error {
+	data, err := os.ReadFile(s.file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var list []*session
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("parse: %w", err)
+	}
+	now := time.Now()
+	for _, sess := range list {
+		if sess.TokenHash == "" || s.expired(sess, now) {
+			continue
+		}
+		s.sessions[sess.TokenHash] = sess
+	}
+	return nil
+}
+
+// writeSessionFile replaces path atomically with the JSON encoded sessions.
+func writeSessionFile(path string, list []*session) error {
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fileutil.WriteAtomic(path, data, 0600)
+}
+
+// cleanupLoop periodically removes expired sessions and flushes last-used
+// times to the session file.
 func (s *SessionStore) cleanupLoop() {
-	ticker := time.NewTicker(15 * time.Minute)
+	ticker := time.NewTicker(sessionFlushInterval)
 	defer ticker.Stop()
 	for range ticker.C {
 		s.mu.Lock()
 		now := time.Now()
-		for token, sess := range s.sessions {
-			if now.After(sess.expiresAt) {
-				delete(s.sessions, token)
+		for h, sess := range s.sessions {
+			if s.expired(sess, now) {
+				delete(s.sessions, h)
+				s.dirty = true
 			}
 		}
+		for token, p := range s.pending {
+			if now.After(p.expiresAt) {
+				delete(s.pending, token)
+			}
+		}
+		if s.dirty {
+			s.saveLocked()
+		}
 		s.mu.Unlock()
 	}
 }
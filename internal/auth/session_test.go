@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/phil-bot/rsyslox/internal/config"
+)
+
+func TestSessionMaxLifetime(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Auth.Sessions.Sliding = true
+	cfg.Auth.Sessions.MaxLifetime = 24 * time.Hour
+	s := NewSessionStore(config.NewLive(cfg))
+
+	token, err := s.Create(Identity{Username: "admin", Role: RoleAdmin, Source: "local"}, "127.0.0.1", "test")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if !s.Validate(token) {
+		t.Fatal("new session is not valid")
+	}
+
+	// Used an hour ago, renewed by sliding, but logged in two days ago.
+	sess := s.sessions[hashKey(token)]
+	sess.CreatedAt = time.Now().Add(-48 * time.Hour)
+	sess.LastUsed = time.Now().Add(-time.Hour)
+	sess.ExpiresAt = time.Now().Add(7 * time.Hour)
+
+	if s.Validate(token) {
+		t.Error("session past max_lifetime is still valid")
+	}
+	if _, ok := s.sessions[hashKey(token)]; ok {
+		t.Error("expired session was not removed")
+	}
+}
@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1" //nolint:gosec // RFC 6238 default; supported by every authenticator app
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/phil-bot/rsyslox/internal/config"
+)
+
+// TOTP parameters (RFC 6238 defaults, understood by all common apps).
+const (
+	totpPeriod = 30 * time.Second
+	totpDigits = 6
+	totpSkew   = 1 // accept one step before/after to tolerate clock drift
+
+	totpIssuer         = "rsyslox"
+	recoveryCodeCount  = 10
+	recoveryCodeLength = 10
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret returns a new random 160-bit secret, base32 encoded.
+func GenerateTOTPSecret() (string, error) {
+	raw := make([]byte, 20)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate TOTP secret: %w", err)
+	}
+	return totpEncoding.EncodeToString(raw), nil
+}
+
+// TOTPURI returns the otpauth:// URI that authenticator apps import,
+// usually by scanning it as a QR code.
+func TOTPURI(secret, account string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", totpIssuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(totpDigits))
+	v.Set("period", fmt.Sprint(int(totpPeriod.Seconds())))
+	label := url.PathEscape(totpIssuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + v.Encode()
+}
+
+// VerifyTOTP checks code against secret at time now.
+// On success it returns the matched time step so callers can reject replays.
+func VerifyTOTP(secret, code string, now time.Time) (int64, bool) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(strings.TrimSpace(secret)))
+	if err != nil {
+		return 0, false
+	}
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != totpDigits {
+		return 0, false
+	}
+
+	step := now.Unix() / int64(totpPeriod.Seconds())
+	for i := -totpSkew; i <= totpSkew; i++ {
+		s := step + int64(i)
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, s)), []byte(code)) == 1 {
+			return s, true
+		}
+	}
+	return 0, false
+}
+
+// totpCode computes the HOTP value (RFC 4226) for the given counter.
+func totpCode(key []byte, counter int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	bin := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, bin%mod)
+}
+
+// GenerateRecoveryCodes returns recoveryCodeCount one-time codes and their
+// SHA-256 hashes. Only the hashes are stored; the plaintext is shown once.
+func GenerateRecoveryCodes() (plaintext, hashes []string, err error) {
+	const alphabet = "abcdefghjkmnpqrstuvwxyz23456789" // no 0/o, 1/l/i
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, recoveryCodeLength)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		b := make([]byte, recoveryCodeLength)
+		for j, r := range raw {
+			b[j] = alphabet[int(r)%len(alphabet)]
+		}
+		code := string(b[:5]) + "-" + string(b[5:])
+		plaintext = append(plaintext, code)
+		hashes = append(hashes, hashKey(code))
+	}
+	return plaintext, hashes, nil
+}
+
+// TOTPEnabled reports whether the local admin account has a second factor.
+func (m *Manager) TOTPEnabled() bool {
+	return m.live.Get().Auth.TOTPSecret != ""
+}
+
+// VerifySecondFactor checks a TOTP code or, failing that, a recovery code
+// for the local admin account. A matched recovery code is removed from the
+// configuration, and save is called with the changed configuration within
+// the same update so the removal is persisted before the code counts; if
+// save fails, the code stays valid and its error is returned. usedRecovery
+// reports that a recovery code was used. TOTP codes are single-use: a step
+// that has already been accepted is rejected to prevent replay within the
+// validity window.
+func (m *Manager) VerifySecondFactor(code string, save func(next *config.Config) error) (usedRecovery bool, err error) {
+	cfg := m.live.Get()
+	if cfg.Auth.TOTPSecret == "" {
+		return false, ErrInvalidCredentials
+	}
+
+	secret, err := config.DecryptPassword(cfg.Auth.TOTPSecret)
+	if err != nil {
+		return false, fmt.Errorf("failed to decrypt TOTP secret: %w", err)
+	}
+
+	if step, ok := VerifyTOTP(secret, code, time.Now()); ok {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if step <= m.lastTOTPStep {
+			return false, ErrInvalidCredentials
+		}
+		m.lastTOTPStep = step
+		return false, nil
+	}
+
+	// Matching, removing and saving happen in one update, so a code cannot
+	// be used by two concurrent logins.
+	h := hashKey(strings.ToLower(strings.TrimSpace(code)))
+	err = m.live.Update(func(next *config.Config) error {
+		codes := next.Auth.TOTPRecoveryCodes
+		for i, c := range codes {
+			if subtle.ConstantTimeCompare([]byte(c), []byte(h)) == 1 {
+				next.Auth.TOTPRecoveryCodes = append(codes[:i:i], codes[i+1:]...)
+				return save(next)
+			}
+		}
+		return ErrInvalidCredentials
+	})
+	return err == nil, err
+}
@@ -2,7 +2,8 @@ package cleanup
 
 import (
 	"database/sql"
-	"log"
+	"errors"
+	"log/slog"
 	"sync"
 	"syscall"
 	"time"
@@ -15,7 +16,29 @@ type Cleaner struct {
 	cfg     Config
 	mu      sync.RWMutex
 	stopCh  chan struct{}
+	doneCh  chan struct{} // closed when the run loop has returned
 	resetCh chan struct{} // signals the run loop to re-read config
+
+	last Run // guarded by mu
+}
+
+// Run describes the outcome of the last cleanup check.
+type Run struct {
+	At          time.Time `json:"at"`
+	UsedPercent float64   `json:"used_percent"`
+	Deleted     int64     `json:"deleted"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// Status is the state of the cleaner reported by the diagnostics endpoint.
+type Status struct {
+	Enabled          bool    `json:"enabled"`
+	DiskPath         string  `json:"disk_path"`
+	ThresholdPercent float64 `json:"threshold_percent"`
+	BatchSize        int     `json:"batch_size"`
+	Interval         string  `json:"interval"`
+	DBConnected      bool    `json:"db_connected"`
+	LastRun          *Run    `json:"last_run,omitempty"` // nil before the first check
 }
 
 // Config holds the cleanup configuration.
@@ -37,12 +60,14 @@ type Config struct {
 	Interval time.Duration
 }
 
-// New creates a new Cleaner instance.
+// New creates a new Cleaner instance. db may be nil while the database is
+// not connected yet; see UpdateDB.
 func New(db *sql.DB, cfg Config) *Cleaner {
 	return &Cleaner{
 		db:      db,
 		cfg:     cfg,
 		stopCh:  make(chan struct{}),
+		doneCh:  make(chan struct{}),
 		resetCh: make(chan struct{}, 1),
 	}
 }
@@ -54,17 +79,27 @@ func (c *Cleaner) Start() {
 	c.mu.RUnlock()
 
 	if !cfg.Enabled {
-		log.Println("⏭  Cleanup service disabled (can be enabled in admin without restart)")
+		slog.Info("Cleanup service disabled (can be enabled in admin without restart)")
 	} else {
-		log.Printf("✓ Cleanup service started (threshold: %.1f%%, interval: %s, batch: %d)",
-			cfg.ThresholdPercent, cfg.Interval, cfg.BatchSize)
+		slog.Info("Cleanup service started",
+			"threshold_percent", cfg.ThresholdPercent, "interval", cfg.Interval.String(), "batch_size", cfg.BatchSize)
 	}
 	go c.run()
 }
 
-// Stop signals the cleanup loop to stop.
+// Stop signals the cleanup loop to stop and waits for a running cleanup
+// batch to finish, so the database can be closed safely afterwards.
 func (c *Cleaner) Stop() {
 	close(c.stopCh)
+	<-c.doneCh
+}
+
+// UpdateDB switches the cleaner to a new connection pool after the
+// database connection was re-established.
+func (c *Cleaner) UpdateDB(db *sql.DB) {
+	c.mu.Lock()
+	c.db = db
+	c.mu.Unlock()
 }
 
 // UpdateConfig updates the cleanup configuration at runtime.
@@ -81,6 +116,35 @@ func (c *Cleaner) UpdateConfig(cfg Config) {
 	}
 }
 
+// Status returns the current configuration and the result of the last check.
+func (c *Cleaner) Status() Status {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	st := Status{
+		Enabled:          c.cfg.Enabled,
+		DiskPath:         c.cfg.DiskPath,
+		ThresholdPercent: c.cfg.ThresholdPercent,
+		BatchSize:        c.cfg.BatchSize,
+		Interval:         c.cfg.Interval.String(),
+		DBConnected:      c.db != nil,
+	}
+	if !c.last.At.IsZero() {
+		last := c.last
+		st.LastRun = &last
+	}
+	return st
+}
+
+// record stores the outcome of a check for Status.
+func (c *Cleaner) record(run Run, err error) {
+	if err != nil {
+		run.Error = err.Error()
+	}
+	c.mu.Lock()
+	c.last = run
+	c.mu.Unlock()
+}
+
 // run is the main cleanup loop.
 func (c *Cleaner) run() {
 	var ticker *time.Ticker
@@ -90,7 +154,8 @@ func (c *Cleaner) run() {
 		if ticker != nil {
 			ticker.Stop()
 		}
-		log.Println("Cleanup service stopped")
+		slog.Info("Cleanup service stopped")
+		close(c.doneCh)
 	}()
 
 	for {
@@ -144,28 +209,35 @@ func (c *Cleaner) check() {
 	cfg := c.cfg
 	c.mu.RUnlock()
 
+	run := Run{At: time.Now()}
 	usedPercent, err := diskUsagePercent(cfg.DiskPath)
 	if err != nil {
-		log.Printf("⚠️  Cleanup: failed to get disk usage for %s: %v", cfg.DiskPath, err)
+		slog.Warn("Cleanup: failed to get disk usage", "path", cfg.DiskPath, "err", err)
+		c.record(run, err)
 		return
 	}
+	run.UsedPercent = usedPercent
 
-	log.Printf("Cleanup: disk usage at %.1f%% (threshold: %.1f%%)", usedPercent, cfg.ThresholdPercent)
+	slog.Debug("Cleanup: disk usage", "used_percent", usedPercent, "threshold_percent", cfg.ThresholdPercent)
 
 	if usedPercent < cfg.ThresholdPercent {
+		c.record(run, nil)
 		return
 	}
 
-	log.Printf("⚠️  Cleanup: disk usage %.1f%% exceeds threshold %.1f%% — deleting %d old records",
-		usedPercent, cfg.ThresholdPercent, cfg.BatchSize)
+	slog.Warn("Cleanup: disk usage exceeds threshold, deleting old records",
+		"used_percent", usedPercent, "threshold_percent", cfg.ThresholdPercent, "batch_size", cfg.BatchSize)
 
 	deleted, err := c.deleteOldestRecords(cfg.BatchSize)
 	if err != nil {
-		log.Printf("❌ Cleanup: failed to delete records: %v", err)
+		slog.Error("Cleanup: failed to delete records", "err", err)
+		c.record(run, err)
 		return
 	}
+	run.Deleted = deleted
+	c.record(run, nil)
 
-	log.Printf("✓ Cleanup: deleted %d records", deleted)
+	slog.Info("Cleanup: deleted records", "deleted", deleted)
 }
 
 // deleteOldestRecords removes the oldest N records from SystemEvents.
@@ -180,7 +252,13 @@ func (c *Cleaner) deleteOldestRecords(n int) (int64, error) {
 			) AS oldest
 		)
 	`
-	result, err := c.db.Exec(query, n)
+	c.mu.RLock()
+	db := c.db
+	c.mu.RUnlock()
+	if db == nil {
+		return 0, errors.New("database not connected")
+	}
+	result, err := db.Exec(query, n)
 	if err != nil {
 		return 0, err
 	}
@@ -0,0 +1,202 @@
+// Package cli implements the rsyslox subcommands (rsyslox query, tail, …).
+//
+// The log commands run either directly against the database of the local
+// config.toml or, with -server, against a running instance using a
+// read-only API key. Both go through the same handlers as /api/logs and
+// /api/meta, so filters behave exactly like in the web UI.
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/phil-bot/rsyslox/internal/models"
+)
+
+// Version is reported in the User-Agent of remote requests. Set by main.
+var Version = "dev"
+
+// Exit codes, for scripts and configuration management.
+const (
+	ExitOK          = 0
+	ExitError       = 1 // the command failed
+	ExitUsage       = 2 // invalid arguments
+	ExitConfig      = 3 // config.toml is missing or invalid
+	ExitUnavailable = 4 // the database, server or another dependency is unreachable
+	ExitNotFound    = 5 // the named key does not exist
+	ExitExists      = 6 // a key with that name already exists
+	ExitCheckFailed = 7 // a check ran and found problems
+)
+
+// exitError carries the exit code for err.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+
+// withCode returns err with the given exit code; nil stays nil.
+func withCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &exitError{code, err}
+}
+
+// command is one subcommand.
+type command struct {
+	usage   string // arguments, shown after the name
+	summary string
+	run     func(args []string) error
+}
+
+// commands is filled in init: the commands look up their own usage.
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"hash-password": {"<plaintext>", "Print the bcrypt hash of an admin password", runHashPassword},
+		"query":         {"[flags]", "Search logs with the filters of /api/logs", runQuery},
+		"tail":          {"[-f] [flags]", "Print the newest logs, and with -f follow new ones", runTail},
+		"stats":         {"[flags]", "Summarise the logs of a time range", runStats},
+		"meta":          {"[column] [flags]", "List columns, or the distinct values of a column", runMeta},
+		"config":        {"validate|show|rekey|history|rollback [flags]", "Validate config.toml, print it without secrets, re-encrypt its secrets, or restore a saved version", runConfig},
+		"keys":          {"list|create|delete [name] [flags]", "Manage read-only API keys", runKeys},
+		"admin":         {"reset-password [flags]", "Set a new password for the local admin account", runAdmin},
+		"db":            {"check [flags]", "Check the SystemEvents schema, indexes and priority mode", runDB},
+	}
+}
+
+// usageError is returned for invalid arguments; Run prints the command's
+// usage, unless the flag package already did, and exits with ExitUsage.
+type usageError struct {
+	msg     string
+	printed bool
+}
+
+func (e *usageError) Error() string { return e.msg }
+
+func usagef(format string, args ...interface{}) error {
+	return &usageError{msg: fmt.Sprintf(format, args...)}
+}
+
+// Run executes the subcommand named by args[0]. ok is false when args do
+// not name a subcommand, in which case the caller starts the server.
+func Run(args []string) (code int, ok bool) {
+	if len(args) == 0 || len(args[0]) == 0 || args[0][0] == '-' {
+		return 0, false
+	}
+	name := args[0]
+	if name == "help" {
+		printUsage(os.Stdout)
+		return ExitOK, true
+	}
+	cmd, found := commands[name]
+	if !found {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", name)
+		printUsage(os.Stderr)
+		return ExitUsage, true
+	}
+
+	err := cmd.run(args[1:])
+	code = ExitError
+	var xerr *exitError
+	if errors.As(err, &xerr) {
+		code = xerr.code
+	}
+	var uerr *usageError
+	var apiErr *models.APIError
+	switch {
+	case err == nil:
+		return ExitOK, true
+	case errors.Is(err, flag.ErrHelp):
+		return ExitOK, true
+	case errors.As(err, &uerr) && uerr.printed:
+		return ExitUsage, true
+	case errors.As(err, &uerr):
+		fmt.Fprintf(os.Stderr, "Error: %v\nUsage: rsyslox %s %s\n", err, name, cmd.usage)
+		return ExitUsage, true
+	case errors.As(err, &apiErr):
+		fmt.Fprintf(os.Stderr, "Error: %s\n", formatAPIError(apiErr))
+		return code, true
+	default:
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return code, true
+	}
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: rsyslox [command] [flags]")
+	fmt.Fprintln(w, "\nWithout a command, rsyslox starts the server.\n\nCommands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-14s %s\n", name, commands[name].summary)
+	}
+	fmt.Fprintln(w, "\nRun 'rsyslox <command> -h' for the flags of a command.")
+}
+
+// runSub runs the subcommand named by args[0] from subs.
+func runSub(args []string, subs map[string]func([]string) error) error {
+	if len(args) == 0 {
+		return usagef("missing subcommand")
+	}
+	switch args[0] {
+	case "-h", "-help", "--help", "help":
+		names := make([]string, 0, len(subs))
+		for name := range subs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Printf("Subcommands: %s\n", strings.Join(names, ", "))
+		return flag.ErrHelp
+	}
+	run, ok := subs[args[0]]
+	if !ok {
+		return usagef("unknown subcommand %q", args[0])
+	}
+	return run(args[1:])
+}
+
+// newFlagSet returns a FlagSet whose errors are reported by Run.
+func newFlagSet(name, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: rsyslox %s %s\n\nFlags:\n", name, usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags parses args, turning flag errors into usage errors. The flag
+// package has already printed the message and the defaults.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return &usageError{msg: err.Error(), printed: true}
+	}
+	return nil
+}
+
+func formatAPIError(e *models.APIError) string {
+	msg := e.Message
+	if e.Field != "" {
+		msg = e.Field + ": " + msg
+	}
+	if e.Details != "" {
+		msg += " (" + e.Details + ")"
+	}
+	return msg + " [" + e.Code + "]"
+}
@@ -0,0 +1,222 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/phil-bot/rsyslox/internal/config"
+	"github.com/phil-bot/rsyslox/internal/database"
+	"github.com/phil-bot/rsyslox/internal/handlers"
+	"github.com/phil-bot/rsyslox/internal/models"
+	"github.com/phil-bot/rsyslox/internal/tlscert"
+)
+
+// Environment variables for the remote connection, so the API key does
+// not have to appear on the command line.
+const (
+	envServer = "RSYSLOX_SERVER"
+	envAPIKey = "RSYSLOX_API_KEY"
+)
+
+// connFlags selects where the log commands read from.
+type connFlags struct {
+	server   string
+	apiKey   string
+	config   string
+	ca       string
+	insecure bool
+}
+
+func (c *connFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&c.server, "server", os.Getenv(envServer), "URL of an rsyslox server, e.g. https://logs.example.com:8443 (env "+envServer+"); default: query the database directly")
+	fs.StringVar(&c.apiKey, "api-key", os.Getenv(envAPIKey), "read-only API key for -server (env "+envAPIKey+")")
+	fs.StringVar(&c.config, "config", "", "config.toml for direct database access (default "+config.ActiveConfigPath()+")")
+	fs.StringVar(&c.ca, "ca", "", "PEM file with the CA of the server certificate")
+	fs.BoolVar(&c.insecure, "insecure", false, "do not verify the server certificate")
+}
+
+// client fetches JSON from the rsyslox API, either over HTTP or by calling
+// the handlers in-process.
+type client interface {
+	get(ctx context.Context, path string, q url.Values) (status int, body []byte, err error)
+	close()
+}
+
+// connect returns the client selected by the flags.
+func (c *connFlags) connect() (client, error) {
+	if c.server != "" {
+		return c.remote()
+	}
+	return c.local()
+}
+
+// remoteClient talks to a running server.
+type remoteClient struct {
+	base   string
+	apiKey string
+	http   *http.Client
+}
+
+func (c *connFlags) remote() (client, error) {
+	u, err := url.Parse(c.server)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, usagef("-server must be an http:// or https:// URL")
+	}
+	if c.apiKey == "" {
+		return nil, usagef("-server requires -api-key or %s", envAPIKey)
+	}
+	tlsCfg := &tls.Config{InsecureSkipVerify: c.insecure} //nolint:gosec // explicitly requested
+	if c.ca != "" {
+		pool, err := tlscert.CAPool(c.ca)
+		if err != nil {
+			return nil, err
+		}
+		tlsCfg.RootCAs = pool
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsCfg
+	return &remoteClient{
+		base:   strings.TrimSuffix(u.String(), "/"),
+		apiKey: c.apiKey,
+		http:   &http.Client{Transport: transport, Timeout: 5 * time.Minute},
+	}, nil
+}
+
+func (r *remoteClient) get(ctx context.Context, path string, q url.Values) (int, []byte, error) {
+	target := r.base + path
+	if len(q) > 0 {
+		target += "?" + q.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("X-API-Key", r.apiKey)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "rsyslox-cli/"+Version)
+	resp, err := r.http.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return 0, nil, ctx.Err()
+		}
+		return 0, nil, withCode(ExitUnavailable, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return resp.StatusCode, body, err
+}
+
+func (r *remoteClient) close() {}
+
+// localClient queries the database of the local configuration through
+// the same handlers the server uses.
+type localClient struct {
+	db   *database.DB
+	logs http.Handler
+	meta http.Handler
+}
+
+func (c *connFlags) local() (client, error) {
+	cfg, err := loadConfig(c.config)
+	if err != nil {
+		return nil, err
+	}
+	db, err := connectDB(cfg)
+	if err != nil {
+		return nil, err
+	}
+	live := config.NewLive(cfg)
+	return &localClient{
+		db:   db,
+		logs: handlers.NewLogsHandler(db, live, nil),
+		meta: handlers.NewMetaHandler(db, live, nil),
+	}, nil
+}
+
+// loadConfig loads config.toml from path, or from the default location
+// when path is empty. A missing file is an error: commands never run the
+// setup wizard.
+func loadConfig(path string) (*config.Config, error) {
+	if path != "" {
+		os.Setenv(config.EnvConfigPath, path)
+	}
+	cfg, setupMode, err := config.Load()
+	if err != nil {
+		return nil, withCode(ExitConfig, err)
+	}
+	if setupMode {
+		return nil, withCode(ExitConfig, fmt.Errorf("no configuration at %s (use -config)", config.ActiveConfigPath()))
+	}
+	return cfg, nil
+}
+
+// connectDB opens a read-only connection to the database of cfg.
+func connectDB(cfg *config.Config) (*database.DB, error) {
+	// The database and handlers log for the server's journal; a command
+	// reports errors itself.
+	log.SetOutput(io.Discard)
+	db, err := database.ConnectReadOnly(cfg)
+	return db, withCode(ExitUnavailable, err)
+}
+
+func (l *localClient) get(ctx context.Context, path string, q url.Values) (int, []byte, error) {
+	h := l.logs
+	if strings.HasPrefix(path, "/api/meta") {
+		h = l.meta
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, path+"?"+q.Encode(), nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	rec := &response{header: make(http.Header), status: http.StatusOK}
+	h.ServeHTTP(rec, req)
+	if err := ctx.Err(); err != nil {
+		// Handlers write nothing for canceled queries.
+		return 0, nil, err
+	}
+	return rec.status, rec.body.Bytes(), nil
+}
+
+func (l *localClient) close() { l.db.Close() }
+
+// response collects what a handler writes.
+type response struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *response) Header() http.Header         { return r.header }
+func (r *response) Write(b []byte) (int, error) { return r.body.Write(b) }
+func (r *response) WriteHeader(status int)      { r.status = status }
+
+// fetch GETs path and decodes the JSON response into v. Error responses
+// are returned as *models.APIError.
+func fetch(ctx context.Context, c client, path string, q url.Values, v interface{}) error {
+	status, body, err := c.get(ctx, path, q)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		apiErr := &models.APIError{}
+		if json.Unmarshal(body, apiErr) != nil || apiErr.Code == "" {
+			return fmt.Errorf("%s: HTTP %d: %s", path, status, strings.TrimSpace(string(body)))
+		}
+		return apiErr
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("%s: invalid response: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/phil-bot/rsyslox/internal/audit"
+	"github.com/phil-bot/rsyslox/internal/auth"
+	"github.com/phil-bot/rsyslox/internal/config"
+	"github.com/phil-bot/rsyslox/internal/tlscert"
+)
+
+// runConfig implements rsyslox config <subcommand>.
+func runConfig(args []string) error {
+	return runSub(args, map[string]func([]string) error{
+		"validate": runConfigValidate,
+		"show":     runConfigShow,
+		"rekey":    runConfigRekey,
+		"history":  runConfigHistory,
+		"rollback": runConfigRollback,
+	})
+}
+
+// check is the result of one check of config validate or db check.
+type check struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail"`
+}
+
+// runConfigValidate loads and validates config.toml, then checks that the
+// database, certificates and LDAP server it refers to are usable.
+func runConfigValidate(args []string) error {
+	var (
+		cfgPath string
+		offline bool
+		quiet   bool
+	)
+	fs := newFlagSet("config validate", "[flags]")
+	fs.StringVar(&cfgPath, "config", "", "config.toml to check (default "+config.ActiveConfigPath()+")")
+	fs.BoolVar(&offline, "offline", false, "only check the file, skip connecting to the database and LDAP")
+	fs.BoolVar(&quiet, "q", false, "print nothing; report through the exit code only")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return usagef("unexpected argument %q", fs.Arg(0))
+	}
+
+	cfg, err := loadConfig(cfgPath)
+	if err != nil {
+		return err
+	}
+	checks := []check{{"config", true, cfg.ConfigPath + " is valid"}}
+	if !offline {
+		checks = append(checks, checkDatabase(cfg), checkTLS(cfg))
+		if cfg.Auth.MTLS.Enabled {
+			checks = append(checks, checkClientCA(cfg))
+		}
+		if cfg.Auth.LDAP.Enabled {
+			checks = append(checks, checkLDAP(cfg))
+		}
+	}
+
+	failed := 0
+	for _, c := range checks {
+		if !c.OK {
+			failed++
+		}
+		if !quiet {
+			printCheck(c)
+		}
+	}
+	if failed > 0 {
+		return withCode(ExitUnavailable, fmt.Errorf("%d of %d checks failed", failed, len(checks)))
+	}
+	return nil
+}
+
+func printCheck(c check) {
+	mark := "✓"
+	if !c.OK {
+		mark = "✗"
+	}
+	fmt.Printf("%s %-10s %s\n", mark, c.Name, c.Detail)
+}
+
+func checkDatabase(cfg *config.Config) check {
+	db, err := connectDB(cfg)
+	if err != nil {
+		return check{"database", false, err.Error()}
+	}
+	defer db.Close()
+	return check{"database", true, fmt.Sprintf("connected to %s:%d/%s (%s)", cfg.Database.Host, cfg.Database.Port, cfg.Database.Name, db.Pool().Version)}
+}
+
+// checkTLS loads the certificate of HTTPS listeners. ACME certificates
+// are obtained by the server and cannot be checked here.
+func checkTLS(cfg *config.Config) check {
+	switch {
+	case !cfg.Server.TLSEnabled():
+		return check{"tls", true, "HTTPS is not enabled"}
+	case cfg.Server.ACME.Enabled:
+		return check{"tls", true, "certificates are managed by ACME"}
+	}
+	if _, err := tlscert.LoadPair(cfg.Server.SSLCertFile, cfg.Server.SSLKeyFile); err != nil {
+		return check{"tls", false, err.Error()}
+	}
+	info, err := tlscert.ReadInfo(cfg.Server.SSLCertFile)
+	if err != nil {
+		return check{"tls", false, err.Error()}
+	}
+	if time.Now().After(info.NotAfter) {
+		return check{"tls", false, fmt.Sprintf("%s expired on %s", cfg.Server.SSLCertFile, info.NotAfter.Format(time.RFC3339))}
+	}
+	return check{"tls", true, fmt.Sprintf("%s valid until %s", cfg.Server.SSLCertFile, info.NotAfter.Format(time.RFC3339))}
+}
+
+func checkClientCA(cfg *config.Config) check {
+	cas, err := tlscert.ReadCAs(cfg.Auth.MTLS.ClientCA)
+	if err != nil {
+		return check{"mtls", false, err.Error()}
+	}
+	return check{"mtls", true, fmt.Sprintf("%d CA certificate(s) in %s", len(cas), cfg.Auth.MTLS.ClientCA)}
+}
+
+func checkLDAP(cfg *config.Config) check {
+	if err := auth.NewLDAPAuthenticator(&cfg.Auth.LDAP).Check(); err != nil {
+		return check{"ldap", false, err.Error()}
+	}
+	detail := "connected to " + cfg.Auth.LDAP.URL
+	if cfg.Auth.LDAP.BindDN != "" {
+		detail += " as " + cfg.Auth.LDAP.BindDN
+	}
+	return check{"ldap", true, detail}
+}
+
+// runConfigShow prints the effective configuration with secrets redacted.
+func runConfigShow(args []string) error {
+	var cfgPath, format string
+	fs := newFlagSet("config show", "[flags]")
+	fs.StringVar(&cfgPath, "config", "", "config.toml (default "+config.ActiveConfigPath()+")")
+	fs.StringVar(&format, "o", "toml", "output format: toml or json")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return usagef("unexpected argument %q", fs.Arg(0))
+	}
+	if format != "toml" && format != formatJSON {
+		return usagef("-o must be toml or json")
+	}
+	cfg, err := loadConfig(cfgPath)
+	if err != nil {
+		return err
+	}
+
+	// Round-trip through TOML to get the keys as they appear in the file.
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(cfg); err != nil {
+		return err
+	}
+	var tree map[string]interface{}
+	if _, err := toml.Decode(buf.String(), &tree); err != nil {
+		return err
+	}
+	redact(tree)
+
+	if format == formatJSON {
+		return writeJSON(os.Stdout, tree)
+	}
+	return toml.NewEncoder(os.Stdout).Encode(tree)
+}
+
+// redact replaces the values of secret keys (see audit.IsSecret) in a
+// decoded TOML tree. Empty values stay empty, so unset secrets are visible.
+func redact(tree map[string]interface{}) {
+	for k, v := range tree {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			redact(t)
+		case []map[string]interface{}:
+			for _, sub := range t {
+				redact(sub)
+			}
+		default:
+			if audit.IsSecret(k) && !isEmpty(v) {
+				tree[k] = "[redacted]"
+			}
+		}
+	}
+}
+
+func isEmpty(v interface{}) bool {
+	switch t := v.(type) {
+	case string:
+		return t == ""
+	case []interface{}:
+		return len(t) == 0
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/phil-bot/rsyslox/internal/config"
+	"github.com/phil-bot/rsyslox/internal/database"
+)
+
+// runDB implements rsyslox db <subcommand>.
+func runDB(args []string) error {
+	return runSub(args, map[string]func([]string) error{
+		"check": runDBCheck,
+	})
+}
+
+// DBReport is the output of rsyslox db check -o json.
+type DBReport struct {
+	Version        string                 `json:"version"`
+	MissingColumns []string               `json:"missing_columns"`
+	Indexes        []database.IndexStatus `json:"indexes"`
+	PriorityMode   string                 `json:"priority_mode"`
+	Checks         []check                `json:"checks"`
+}
+
+// runDBCheck verifies that SystemEvents has the columns and indexes
+// rsyslox relies on and reports how Priority is stored.
+func runDBCheck(args []string) error {
+	var cfgPath, format string
+	fs := newFlagSet("db check", "[flags]")
+	fs.StringVar(&cfgPath, "config", "", "config.toml (default "+config.ActiveConfigPath()+")")
+	fs.StringVar(&format, "o", formatTable, "output format: table or json")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return usagef("unexpected argument %q", fs.Arg(0))
+	}
+	if format != formatTable && format != formatJSON {
+		return usagef("-o must be table or json")
+	}
+	cfg, err := loadConfig(cfgPath)
+	if err != nil {
+		return err
+	}
+	db, err := connectDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	pool := db.Pool()
+	report := DBReport{
+		Version:        pool.Version,
+		MissingColumns: pool.MissingColumns(),
+		PriorityMode:   pool.PriorityMode.String(),
+	}
+	if report.MissingColumns == nil {
+		report.MissingColumns = []string{}
+	}
+	ictx, icancel := context.WithTimeout(ctx, 30*time.Second)
+	defer icancel()
+	if report.Indexes, err = pool.IndexStatus(ictx); err != nil {
+		return withCode(ExitUnavailable, fmt.Errorf("reading indexes: %w", err))
+	}
+
+	report.Checks = append(report.Checks, check{"server", true, pool.Version})
+	if n := len(report.MissingColumns); n > 0 {
+		report.Checks = append(report.Checks, check{"columns", false, fmt.Sprintf("SystemEvents lacks %s", strings.Join(report.MissingColumns, ", "))})
+	} else {
+		report.Checks = append(report.Checks, check{"columns", true, "SystemEvents has all columns rsyslox reads"})
+	}
+	for _, idx := range report.Indexes {
+		detail := idx.Name + " (" + idx.Columns + ")"
+		if !idx.Present {
+			detail += " is missing; the server creates it on startup"
+		}
+		report.Checks = append(report.Checks, check{"index", idx.Present, detail})
+	}
+	// Mixed is a valid state after an rsyslog upgrade: entries are
+	// normalised per row.
+	report.Checks = append(report.Checks, check{"priority", true, report.PriorityMode})
+
+	if format == formatJSON {
+		if err := writeJSON(os.Stdout, report); err != nil {
+			return err
+		}
+	} else {
+		for _, c := range report.Checks {
+			printCheck(c)
+		}
+	}
+	for _, c := range report.Checks {
+		if !c.OK {
+			return withCode(ExitCheckFailed, fmt.Errorf("the database needs attention"))
+		}
+	}
+	return nil
+}
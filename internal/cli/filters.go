@@ -0,0 +1,114 @@
+package cli
+
+import (
+	"flag"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/phil-bot/rsyslox/internal/models"
+)
+
+// multiFlag is a flag that may be given several times.
+type multiFlag []string
+
+func (m *multiFlag) String() string     { return strings.Join(*m, ",") }
+func (m *multiFlag) Set(v string) error { *m = append(*m, v); return nil }
+
+// filterFlags are the filters of /api/logs and /api/meta/{column}.
+type filterFlags struct {
+	since      time.Duration
+	start, end string
+
+	hosts, excludeHosts           multiFlag
+	severities, excludeSeverities multiFlag
+	facilities, excludeFacilities multiFlag
+	tags, excludeTags             multiFlag
+	messages                      multiFlag
+}
+
+func (f *filterFlags) register(fs *flag.FlagSet) {
+	fs.DurationVar(&f.since, "since", 0, "only entries of the last `duration`, e.g. 15m or 2h (default 24h)")
+	fs.StringVar(&f.start, "start", "", "start of the time range, RFC 3339 (overrides -since)")
+	fs.StringVar(&f.end, "end", "", "end of the time range, RFC 3339 (default now)")
+	fs.Var(&f.hosts, "host", "FromHost; repeat for several")
+	fs.Var(&f.excludeHosts, "exclude-host", "exclude a FromHost; repeat for several")
+	fs.Var(&f.severities, "severity", "severity as 0-7 or name (err, warning, …); repeat for several")
+	fs.Var(&f.excludeSeverities, "exclude-severity", "exclude a severity; repeat for several")
+	fs.Var(&f.facilities, "facility", "facility as 0-23 or name (auth, local0, …); repeat for several")
+	fs.Var(&f.excludeFacilities, "exclude-facility", "exclude a facility; repeat for several")
+	fs.Var(&f.tags, "tag", "SysLogTag; repeat for several")
+	fs.Var(&f.excludeTags, "exclude-tag", "exclude a SysLogTag; repeat for several")
+	fs.Var(&f.messages, "message", "text the message contains; repeat to match any of several")
+}
+
+// values returns the filters as query parameters.
+func (f *filterFlags) values() (url.Values, error) {
+	q := url.Values{}
+	switch {
+	case f.start != "":
+		q.Set("start_date", f.start)
+	case f.since < 0:
+		return nil, usagef("-since must be positive")
+	case f.since > 0:
+		q.Set("start_date", time.Now().Add(-f.since).UTC().Format(time.RFC3339))
+	}
+	if f.end != "" {
+		q.Set("end_date", f.end)
+	}
+
+	for _, p := range []struct {
+		param  string
+		values []string
+		names  [][]string // accepted instead of the number
+	}{
+		{"Severity", f.severities, [][]string{severityNames[:], models.SeverityLabels[:]}},
+		{"ExcludeSeverity", f.excludeSeverities, [][]string{severityNames[:], models.SeverityLabels[:]}},
+		{"Facility", f.facilities, [][]string{models.FacilityLabels[:]}},
+		{"ExcludeFacility", f.excludeFacilities, [][]string{models.FacilityLabels[:]}},
+	} {
+		for _, v := range p.values {
+			n, err := code(p.param, v, p.names)
+			if err != nil {
+				return nil, err
+			}
+			q.Add(p.param, n)
+		}
+	}
+
+	q["FromHost"] = f.hosts
+	q["ExcludeFromHost"] = f.excludeHosts
+	q["SysLogTag"] = f.tags
+	q["ExcludeSysLogTag"] = f.excludeTags
+	q["Message"] = f.messages
+	for k, v := range q {
+		if len(v) == 0 {
+			delete(q, k)
+		}
+	}
+	return q, nil
+}
+
+// severityNames are the keywords of syslog.conf(5), by severity.
+var severityNames = [8]string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+// code translates a severity or facility name of param to its number.
+// Numbers are passed through for the server to validate.
+func code(param, v string, names [][]string) (string, error) {
+	if _, err := strconv.Atoi(v); err == nil {
+		return v, nil
+	}
+	for _, list := range names {
+		for i, name := range list {
+			if strings.EqualFold(v, name) {
+				return strconv.Itoa(i), nil
+			}
+		}
+	}
+	kind := "facility"
+	if strings.HasSuffix(param, "Severity") {
+		kind = "severity"
+	}
+	return "", usagef("unknown %s %q", kind, v)
+}
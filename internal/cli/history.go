@@ -0,0 +1,116 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/phil-bot/rsyslox/internal/audit"
+	"github.com/phil-bot/rsyslox/internal/config"
+)
+
+// runConfigHistory lists the saved versions of config.toml.
+func runConfigHistory(args []string) error {
+	var cfgPath, format string
+	fs := newFlagSet("config history", "[flags]")
+	fs.StringVar(&cfgPath, "config", "", "config.toml (default "+config.ActiveConfigPath()+")")
+	fs.StringVar(&format, "o", formatTable, "output format: table or json")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return usagef("unexpected argument %q", fs.Arg(0))
+	}
+	if format != formatTable && format != formatJSON {
+		return usagef("-o must be table or json")
+	}
+	path := configFile(cfgPath)
+	versions, err := config.History(path)
+	if err != nil {
+		return err
+	}
+	if format == formatJSON {
+		return writeJSON(os.Stdout, versions)
+	}
+	if len(versions) == 0 {
+		fmt.Fprintf(os.Stderr, "No saved versions of %s\n", path)
+		return nil
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tSAVED\tBY\tACTION\t")
+	for _, v := range versions {
+		current := ""
+		if v.Current {
+			current = "(current)"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", v.Version, v.SavedAt.Local().Format(timeLayout),
+			dash(v.SavedBy), dash(v.Action), current)
+	}
+	return tw.Flush()
+}
+
+// runConfigRollback restores a saved version of config.toml. It works on
+// the files only, so it also helps when the server no longer starts.
+func runConfigRollback(args []string) error {
+	var cfgPath string
+	var dryRun bool
+	fs := newFlagSet("config rollback", "[flags] <version>")
+	fs.StringVar(&cfgPath, "config", "", "config.toml to restore (default "+config.ActiveConfigPath()+")")
+	fs.BoolVar(&dryRun, "n", false, "only print what would change")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return usagef("expected a version number (see rsyslox config history)")
+	}
+	n, err := strconv.Atoi(fs.Arg(0))
+	if err != nil || n < 1 {
+		return usagef("invalid version %q", fs.Arg(0))
+	}
+
+	path := configFile(cfgPath)
+	current, err := config.ReadFile(path)
+	broken := err != nil
+	if broken {
+		// A broken config.toml is a reason to roll back; the credentials
+		// then come from the version itself.
+		fmt.Fprintf(os.Stderr, "⚠️  %v\n  The version is restored including its credentials.\n", err)
+		if current, _, err = config.ReadVersion(path, n); err != nil {
+			return withCode(ExitNotFound, err)
+		}
+	}
+	next, err := config.Restore(current, n)
+	if err == config.ErrVersionNotFound {
+		return withCode(ExitNotFound, fmt.Errorf("version %d is not in the history of %s", n, path))
+	}
+	if err != nil {
+		return withCode(ExitConfig, err)
+	}
+
+	changes := audit.Diff(audit.Snapshot(current), audit.Snapshot(next))
+	for _, c := range changes {
+		fmt.Fprintf(os.Stderr, "  %s: %s → %s\n", c.Field, c.Before, c.After)
+	}
+	if dryRun {
+		return nil
+	}
+	if len(changes) == 0 && !broken {
+		fmt.Fprintf(os.Stderr, "✓ %s already matches version %d\n", path, n)
+		return nil
+	}
+	if err := config.Save(next, config.Origin{User: actor(), Action: audit.ActionConfigRollback}); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "✓ Restored version %d of %s\n", n, path)
+	reloadHint(next)
+	return nil
+}
+
+// configFile returns the config.toml selected by -config.
+func configFile(path string) string {
+	if path != "" {
+		os.Setenv(config.EnvConfigPath, path)
+	}
+	return config.ActiveConfigPath()
+}
@@ -0,0 +1,243 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/phil-bot/rsyslox/internal/audit"
+	"github.com/phil-bot/rsyslox/internal/auth"
+	"github.com/phil-bot/rsyslox/internal/config"
+	"github.com/phil-bot/rsyslox/internal/handlers/admin"
+)
+
+// runKeys implements rsyslox keys <subcommand>. The keys are edited in
+// config.toml, like from the Admin panel.
+func runKeys(args []string) error {
+	return runSub(args, map[string]func([]string) error{
+		"list":   runKeysList,
+		"create": runKeysCreate,
+		"delete": runKeysDelete,
+	})
+}
+
+func runKeysList(args []string) error {
+	var cfgPath, format string
+	fs := newFlagSet("keys list", "[flags]")
+	fs.StringVar(&cfgPath, "config", "", "config.toml (default "+config.ActiveConfigPath()+")")
+	fs.StringVar(&format, "o", formatTable, "output format: table or json")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return usagef("unexpected argument %q", fs.Arg(0))
+	}
+	if format != formatTable && format != formatJSON {
+		return usagef("-o must be table or json")
+	}
+	cfg, err := loadConfig(cfgPath)
+	if err != nil {
+		return err
+	}
+
+	// Last use as of the server's latest flush of auth.key_usage_file.
+	usage := auth.NewKeyUsage(cfg.Auth.KeyUsageFile)
+	now := time.Now()
+	keys := make([]admin.KeyResponse, len(cfg.Auth.ReadOnlyKeys))
+	for i, k := range cfg.Auth.ReadOnlyKeys {
+		kr := admin.KeyResponse{
+			Name:      k.Name,
+			CreatedAt: timeOrNil(k.CreatedAt),
+			CreatedBy: k.CreatedBy,
+			ExpiresAt: timeOrNil(k.ExpiresAt),
+			Expired:   auth.KeyExpired(k, now),
+		}
+		if k.PreviousKeyHash != "" && now.Before(k.PreviousExpiresAt) {
+			kr.PreviousValidUntil = timeOrNil(k.PreviousExpiresAt)
+		}
+		if u, ok := usage.Get(k.Name); ok {
+			kr.LastUsed = timeOrNil(u.LastUsed)
+			kr.LastIP = u.LastIP
+		}
+		keys[i] = kr
+	}
+
+	if format == formatJSON {
+		return writeJSON(os.Stdout, keys)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tSTATUS\tCREATED\tCREATED BY\tEXPIRES\tLAST USED")
+	for _, k := range keys {
+		status := "active"
+		switch {
+		case k.Expired:
+			status = "expired"
+		case k.PreviousValidUntil != nil:
+			status = "rotating"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", k.Name, status,
+			formatTime(k.CreatedAt, "-"), dash(k.CreatedBy),
+			formatTime(k.ExpiresAt, "never"), formatTime(k.LastUsed, "never"))
+	}
+	return tw.Flush()
+}
+
+func runKeysCreate(args []string) error {
+	var cfgPath, expires string
+	fs := newFlagSet("keys create", "<name> [flags]")
+	fs.StringVar(&cfgPath, "config", "", "config.toml (default "+config.ActiveConfigPath()+")")
+	fs.StringVar(&expires, "expires", "", "expiry as RFC 3339 time or duration from now, e.g. 2160h (default never)")
+	name, err := parseNamed(fs, args)
+	if err != nil {
+		return err
+	}
+
+	var expiresAt time.Time
+	if expires != "" {
+		if d, err := time.ParseDuration(expires); err == nil {
+			expiresAt = time.Now().Add(d)
+		} else if expiresAt, err = time.Parse(time.RFC3339, expires); err != nil {
+			return usagef("-expires must be an RFC 3339 time or a duration")
+		}
+		if !expiresAt.After(time.Now()) {
+			return usagef("-expires must be in the future")
+		}
+	}
+
+	cfg, err := loadConfig(cfgPath)
+	if err != nil {
+		return err
+	}
+	for _, k := range cfg.Auth.ReadOnlyKeys {
+		if k.Name == name {
+			return withCode(ExitExists, fmt.Errorf("a key named %q already exists", name))
+		}
+	}
+
+	plaintext, hash, err := auth.GenerateReadOnlyKey()
+	if err != nil {
+		return err
+	}
+	key := config.ReadOnlyKey{
+		Name:      name,
+		KeyHash:   hash,
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+		CreatedBy: actor(),
+	}
+	if !expiresAt.IsZero() {
+		key.ExpiresAt = expiresAt.UTC().Truncate(time.Second)
+	}
+	cfg.Auth.ReadOnlyKeys = append(cfg.Auth.ReadOnlyKeys, key)
+	if err := config.Save(cfg, config.Origin{User: actor(), Action: audit.ActionKeyCreate}); err != nil {
+		return err
+	}
+
+	// Only the key goes to stdout, so KEY=$(rsyslox keys create ci) works.
+	fmt.Println(plaintext)
+	fmt.Fprintf(os.Stderr, "✓ Created read-only key %q. Store it securely — it will not be shown again.\n", name)
+	reloadHint(cfg)
+	return nil
+}
+
+func runKeysDelete(args []string) error {
+	var cfgPath string
+	fs := newFlagSet("keys delete", "<name> [flags]")
+	fs.StringVar(&cfgPath, "config", "", "config.toml (default "+config.ActiveConfigPath()+")")
+	name, err := parseNamed(fs, args)
+	if err != nil {
+		return err
+	}
+	cfg, err := loadConfig(cfgPath)
+	if err != nil {
+		return err
+	}
+
+	found := false
+	filtered := cfg.Auth.ReadOnlyKeys[:0]
+	for _, k := range cfg.Auth.ReadOnlyKeys {
+		if k.Name == name {
+			found = true
+			continue
+		}
+		filtered = append(filtered, k)
+	}
+	if !found {
+		return withCode(ExitNotFound, fmt.Errorf("no key named %q", name))
+	}
+	cfg.Auth.ReadOnlyKeys = filtered
+	if err := config.Save(cfg, config.Origin{User: actor(), Action: audit.ActionKeyDelete}); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "✓ Deleted read-only key %q\n", name)
+	reloadHint(cfg)
+	return nil
+}
+
+// parseNamed parses "<name> [flags]" as well as "[flags] <name>".
+func parseNamed(fs *flag.FlagSet, args []string) (string, error) {
+	var name string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return "", err
+	}
+	if name == "" && fs.NArg() > 0 {
+		name = fs.Arg(0)
+		fs.Parse(fs.Args()[1:]) //nolint:errcheck // only positional arguments remain
+	}
+	if fs.NArg() > 0 {
+		return "", usagef("unexpected argument %q", fs.Arg(0))
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", usagef("a key name is required")
+	}
+	return name, nil
+}
+
+// actor names the user running the command, for created_by.
+func actor() string {
+	if u := os.Getenv("SUDO_USER"); u != "" {
+		return "cli:" + u
+	}
+	if u, err := user.Current(); err == nil {
+		return "cli:" + u.Username
+	}
+	return "cli"
+}
+
+// reloadHint tells how the running server picks up a changed config.toml.
+func reloadHint(cfg *config.Config) {
+	if cfg.Server.WatchConfig {
+		fmt.Fprintln(os.Stderr, "  A running server applies the change within a few seconds.")
+		return
+	}
+	fmt.Fprintln(os.Stderr, "  Apply it to a running server with: systemctl reload rsyslox")
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func formatTime(t *time.Time, none string) string {
+	if t == nil {
+		return none
+	}
+	return t.Local().Format(timeLayout)
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,484 @@
+package cli
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/phil-bot/rsyslox/internal/models"
+)
+
+// signalContext is canceled on Ctrl-C, which stops tail -f and aborts a
+// running query.
+func signalContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+// runQuery implements rsyslox query: one page of /api/logs, newest first.
+func runQuery(args []string) error {
+	var (
+		conn   connFlags
+		filter filterFlags
+		format string
+		limit  int
+		offset int
+		count  string
+	)
+	fs := newFlagSet("query", commands["query"].usage)
+	conn.register(fs)
+	filter.register(fs)
+	registerFormat(fs, &format)
+	fs.IntVar(&limit, "limit", 100, "maximum number of entries (up to 50000)")
+	fs.IntVar(&offset, "offset", 0, "number of entries to skip")
+	fs.StringVar(&count, "count", "estimate", "how to count the matches: exact, estimate or none")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return usagef("unexpected argument %q", fs.Arg(0))
+	}
+	if err := checkFormat(format); err != nil {
+		return err
+	}
+	q, err := filter.values()
+	if err != nil {
+		return err
+	}
+	q.Set("limit", strconv.Itoa(limit))
+	q.Set("offset", strconv.Itoa(offset))
+	q.Set("count", count)
+
+	c, err := conn.connect()
+	if err != nil {
+		return err
+	}
+	defer c.close()
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	var res models.LogsResponse
+	if err := fetch(ctx, c, "/api/logs", q, &res); err != nil {
+		return err
+	}
+	if err := writeEntries(os.Stdout, format, res.Rows, true); err != nil {
+		return err
+	}
+	if format == formatTable {
+		total := strconv.Itoa(res.Total)
+		if !res.TotalExact {
+			total = "~" + total
+		}
+		first := res.Offset
+		if len(res.Rows) > 0 {
+			first++
+		}
+		fmt.Fprintf(os.Stderr, "%d–%d of %s matching entries\n", first, res.Offset+len(res.Rows), total)
+	}
+	return nil
+}
+
+// tailBatch is the page size of tail -f. Larger bursts take several pages.
+const tailBatch = 1000
+
+// runTail implements rsyslox tail: the newest entries in chronological
+// order, then, with -f, new entries as they are written.
+func runTail(args []string) error {
+	var (
+		conn     connFlags
+		filter   filterFlags
+		format   string
+		lines    int
+		follow   bool
+		interval time.Duration
+	)
+	fs := newFlagSet("tail", commands["tail"].usage)
+	conn.register(fs)
+	filter.register(fs)
+	registerFormat(fs, &format)
+	fs.IntVar(&lines, "n", 10, "number of entries to print first")
+	fs.BoolVar(&follow, "f", false, "keep printing new entries until interrupted")
+	fs.DurationVar(&interval, "interval", 2*time.Second, "how often -f polls for new entries")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return usagef("unexpected argument %q", fs.Arg(0))
+	}
+	if err := checkFormat(format); err != nil {
+		return err
+	}
+	if lines < 0 || lines > 50000 {
+		return usagef("-n must be between 0 and 50000")
+	}
+	if interval < 100*time.Millisecond {
+		return usagef("-interval must be at least 100ms")
+	}
+	q, err := filter.values()
+	if err != nil {
+		return err
+	}
+	if follow && q.Get("end_date") != "" {
+		return usagef("-f cannot be combined with -end")
+	}
+
+	c, err := conn.connect()
+	if err != nil {
+		return err
+	}
+	defer c.close()
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	// Where -f continues: the time of the newest entry printed, and its ID
+	// to skip the entries of that second that were already printed.
+	var lastID int
+	since := time.Now().UTC()
+	if s := q.Get("start_date"); s != "" {
+		since, _ = time.Parse(time.RFC3339, s)
+	}
+
+	if lines > 0 {
+		first := cloneValues(q)
+		first.Set("limit", strconv.Itoa(lines))
+		first.Set("count", "none")
+		var res models.LogsResponse
+		if err := fetch(ctx, c, "/api/logs", first, &res); err != nil {
+			return err
+		}
+		reverse(res.Rows)
+		if err := writeStream(os.Stdout, format, res.Rows, true); err != nil {
+			return err
+		}
+		if n := len(res.Rows); n > 0 {
+			since, lastID = res.Rows[n-1].ReceivedAt, res.Rows[n-1].ID
+		}
+	}
+	if !follow {
+		return nil
+	}
+
+	header := lines == 0
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		// Entries are returned newest first; collect every page since the
+		// last poll and print them oldest first.
+		var fresh []models.LogEntry
+		next := cloneValues(q)
+		next.Set("start_date", since.Format(time.RFC3339))
+		next.Set("limit", strconv.Itoa(tailBatch))
+		next.Set("count", "none")
+		for offset := 0; ; offset += tailBatch {
+			next.Set("offset", strconv.Itoa(offset))
+			var res models.LogsResponse
+			if err := fetch(ctx, c, "/api/logs", next, &res); err != nil {
+				if errors.Is(err, context.Canceled) {
+					return nil
+				}
+				return err
+			}
+			for _, e := range res.Rows {
+				if e.ID > lastID {
+					fresh = append(fresh, e)
+				}
+			}
+			if !res.HasMore {
+				break
+			}
+		}
+		if len(fresh) == 0 {
+			continue
+		}
+		reverse(fresh)
+		if err := writeStream(os.Stdout, format, fresh, header); err != nil {
+			return err
+		}
+		header = false
+		since, lastID = fresh[len(fresh)-1].ReceivedAt, fresh[len(fresh)-1].ID
+	}
+}
+
+// Stats is the output of rsyslox stats.
+type Stats struct {
+	DBTotal     int             `json:"db_total"`
+	OldestEntry *time.Time      `json:"oldest_entry"`
+	Matching    int             `json:"matching"` // entries matching the filters
+	Hosts       int             `json:"hosts"`    // distinct FromHost among them
+	Tags        int             `json:"tags"`     // distinct SysLogTag among them
+	BySeverity  []SeverityCount `json:"by_severity"`
+}
+
+// SeverityCount is the number of matching entries of one severity.
+type SeverityCount struct {
+	Severity int    `json:"severity"`
+	Label    string `json:"label"`
+	Count    int    `json:"count"`
+}
+
+// runStats implements rsyslox stats, built from /api/meta and exact
+// counts of /api/logs.
+func runStats(args []string) error {
+	var (
+		conn   connFlags
+		filter filterFlags
+		format string
+	)
+	fs := newFlagSet("stats", commands["stats"].usage)
+	conn.register(fs)
+	filter.register(fs)
+	registerFormat(fs, &format)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return usagef("unexpected argument %q", fs.Arg(0))
+	}
+	if err := checkFormat(format); err != nil {
+		return err
+	}
+	q, err := filter.values()
+	if err != nil {
+		return err
+	}
+
+	c, err := conn.connect()
+	if err != nil {
+		return err
+	}
+	defer c.close()
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	var meta models.MetaResponse
+	if err := fetch(ctx, c, "/api/meta", nil, &meta); err != nil {
+		return err
+	}
+	stats := Stats{DBTotal: meta.DBTotal, OldestEntry: meta.OldestEntry, BySeverity: []SeverityCount{}}
+
+	countOf := func(q url.Values) (int, error) {
+		q = cloneValues(q)
+		q.Set("limit", "1")
+		q.Set("count", "exact")
+		var res models.LogsResponse
+		err := fetch(ctx, c, "/api/logs", q, &res)
+		return res.Total, err
+	}
+	if stats.Matching, err = countOf(q); err != nil {
+		return err
+	}
+
+	// The meta endpoints default to all time; pin them to the range of
+	// the counts.
+	mq := cloneValues(q)
+	if mq.Get("start_date") == "" {
+		mq.Set("start_date", time.Now().Add(-24*time.Hour).UTC().Format(time.RFC3339))
+	}
+	var hosts, tags []string
+	if err := fetch(ctx, c, "/api/meta/FromHost", mq, &hosts); err != nil {
+		return err
+	}
+	if err := fetch(ctx, c, "/api/meta/SysLogTag", mq, &tags); err != nil {
+		return err
+	}
+	stats.Hosts, stats.Tags = len(hosts), len(tags)
+
+	var severities []models.MetaValue
+	if err := fetch(ctx, c, "/api/meta/Severity", mq, &severities); err != nil {
+		return err
+	}
+	for _, s := range severities {
+		sq := cloneValues(q)
+		sq.Del("ExcludeSeverity")
+		sq.Set("Severity", strconv.Itoa(s.Val))
+		n, err := countOf(sq)
+		if err != nil {
+			return err
+		}
+		stats.BySeverity = append(stats.BySeverity, SeverityCount{s.Val, s.Label, n})
+	}
+
+	switch format {
+	case formatJSON:
+		return writeJSON(os.Stdout, stats)
+	case formatCSV:
+		cw := csv.NewWriter(os.Stdout)
+		cw.Write([]string{"metric", "value"}) //nolint:errcheck // reported by Flush
+		oldest := ""
+		if stats.OldestEntry != nil {
+			oldest = stats.OldestEntry.Format(time.RFC3339)
+		}
+		cw.Write([]string{"db_total", strconv.Itoa(stats.DBTotal)})  //nolint:errcheck
+		cw.Write([]string{"oldest_entry", oldest})                   //nolint:errcheck
+		cw.Write([]string{"matching", strconv.Itoa(stats.Matching)}) //nolint:errcheck
+		cw.Write([]string{"hosts", strconv.Itoa(stats.Hosts)})       //nolint:errcheck
+		cw.Write([]string{"tags", strconv.Itoa(stats.Tags)})         //nolint:errcheck
+		for _, s := range stats.BySeverity {
+			cw.Write([]string{"severity_" + severityNames[s.Severity], strconv.Itoa(s.Count)}) //nolint:errcheck
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(tw, "Entries in database:\t%d\n", stats.DBTotal)
+		if stats.OldestEntry != nil {
+			fmt.Fprintf(tw, "Oldest entry:\t%s\n", stats.OldestEntry.Format(timeLayout))
+		}
+		fmt.Fprintf(tw, "Matching entries:\t%d\n", stats.Matching)
+		fmt.Fprintf(tw, "Hosts:\t%d\n", stats.Hosts)
+		fmt.Fprintf(tw, "Tags:\t%d\n", stats.Tags)
+		for _, s := range stats.BySeverity {
+			fmt.Fprintf(tw, "  %s\t%d\n", s.Label, s.Count)
+		}
+		return tw.Flush()
+	}
+}
+
+// runMeta implements rsyslox meta: the columns of SystemEvents, or the
+// distinct values of one column.
+func runMeta(args []string) error {
+	var (
+		conn   connFlags
+		filter filterFlags
+		format string
+	)
+	fs := newFlagSet("meta", commands["meta"].usage)
+	conn.register(fs)
+	filter.register(fs)
+	registerFormat(fs, &format)
+
+	// Allow flags after the column: rsyslox meta FromHost -since 1h
+	var column string
+	if len(args) > 0 && len(args[0]) > 0 && args[0][0] != '-' {
+		column, args = args[0], args[1:]
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		if column != "" || fs.NArg() > 1 {
+			return usagef("expected at most one column")
+		}
+		column = fs.Arg(0)
+	}
+	if err := checkFormat(format); err != nil {
+		return err
+	}
+	q, err := filter.values()
+	if err != nil {
+		return err
+	}
+
+	c, err := conn.connect()
+	if err != nil {
+		return err
+	}
+	defer c.close()
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	if column == "" {
+		var meta models.MetaResponse
+		if err := fetch(ctx, c, "/api/meta", nil, &meta); err != nil {
+			return err
+		}
+		if format == formatJSON {
+			return writeJSON(os.Stdout, meta)
+		}
+		return writeValues(format, "column", toValues(meta.AvailableColumns))
+	}
+
+	var raw json.RawMessage
+	if err := fetch(ctx, c, "/api/meta/"+url.PathEscape(column), q, &raw); err != nil {
+		return err
+	}
+	if format == formatJSON {
+		return writeJSON(os.Stdout, raw)
+	}
+	// Severity and Facility come with labels; other columns are plain
+	// strings or numbers.
+	var labeled []models.MetaValue
+	if err := json.Unmarshal(raw, &labeled); err == nil {
+		values := make([][2]string, len(labeled))
+		for i, v := range labeled {
+			values[i] = [2]string{strconv.Itoa(v.Val), v.Label}
+		}
+		return writeValues(format, column, values)
+	}
+	var plain []interface{}
+	if err := json.Unmarshal(raw, &plain); err != nil {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+	values := make([]string, len(plain))
+	for i, v := range plain {
+		values[i] = fmt.Sprint(v)
+	}
+	return writeValues(format, column, toValues(values))
+}
+
+// writeValues prints one value per line, with an optional label.
+func writeValues(format, name string, values [][2]string) error {
+	if format == formatCSV {
+		labeled := len(values) > 0 && values[0][1] != ""
+		cw := csv.NewWriter(os.Stdout)
+		if labeled {
+			cw.Write([]string{name, "label"}) //nolint:errcheck // reported by Flush
+		} else {
+			cw.Write([]string{name}) //nolint:errcheck
+		}
+		for _, v := range values {
+			if labeled {
+				cw.Write(v[:]) //nolint:errcheck
+			} else {
+				cw.Write(v[:1]) //nolint:errcheck
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, v := range values {
+		if v[1] == "" {
+			fmt.Fprintln(tw, v[0])
+		} else {
+			fmt.Fprintf(tw, "%s\t%s\n", v[0], v[1])
+		}
+	}
+	return tw.Flush()
+}
+
+func toValues(list []string) [][2]string {
+	values := make([][2]string, len(list))
+	for i, v := range list {
+		values[i] = [2]string{v}
+	}
+	return values
+}
+
+func cloneValues(q url.Values) url.Values {
+	c := make(url.Values, len(q))
+	for k, v := range q {
+		c[k] = append([]string(nil), v...)
+	}
+	return c
+}
+
+func reverse(entries []models.LogEntry) {
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+}
@@ -0,0 +1,127 @@
+package cli
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/phil-bot/rsyslox/internal/models"
+)
+
+// Output formats.
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatCSV   = "csv"
+)
+
+func registerFormat(fs *flag.FlagSet, format *string) {
+	fs.StringVar(format, "o", formatTable, "output format: table, json or csv")
+}
+
+func checkFormat(format string) error {
+	switch format {
+	case formatTable, formatJSON, formatCSV:
+		return nil
+	}
+	return usagef("-o must be table, json or csv")
+}
+
+// timeLayout is used for ReceivedAt in table output.
+const timeLayout = "2006-01-02 15:04:05"
+
+// csvHeader are the columns of CSV output.
+var csvHeader = []string{"ID", "ReceivedAt", "FromHost", "Facility", "Facility_Label", "Severity", "Severity_Label", "SysLogTag", "Message"}
+
+// writeEntries prints entries in format, in the given order. header
+// controls the table and CSV header lines.
+func writeEntries(w io.Writer, format string, entries []models.LogEntry, header bool) error {
+	switch format {
+	case formatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+	case formatCSV:
+		cw := csv.NewWriter(w)
+		if header {
+			cw.Write(csvHeader) //nolint:errcheck // reported by Flush
+		}
+		for _, e := range entries {
+			cw.Write([]string{ //nolint:errcheck
+				strconv.Itoa(e.ID), e.ReceivedAt.Format(time.RFC3339), e.FromHost,
+				strconv.Itoa(e.Facility), e.FacilityLabel,
+				strconv.Itoa(e.Severity), e.SeverityLabel,
+				deref(e.SysLogTag), e.Message,
+			})
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		if header {
+			fmt.Fprintln(tw, "TIME\tHOST\tFACILITY\tSEVERITY\tTAG\tMESSAGE")
+		}
+		for _, e := range entries {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+				e.ReceivedAt.Format(timeLayout), e.FromHost, e.FacilityLabel,
+				e.SeverityLabel, deref(e.SysLogTag), oneLine(e.Message))
+		}
+		return tw.Flush()
+	}
+}
+
+// writeStream prints entries as they arrive for tail: one JSON object or
+// CSV record per line, and syslog-style lines for the table format, whose
+// columns could not stay aligned across batches.
+func writeStream(w io.Writer, format string, entries []models.LogEntry, header bool) error {
+	switch format {
+	case formatJSON:
+		enc := json.NewEncoder(w)
+		for _, e := range entries {
+			if err := enc.Encode(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	case formatCSV:
+		return writeEntries(w, format, entries, header)
+	default:
+		for _, e := range entries {
+			tag := strings.TrimSpace(deref(e.SysLogTag))
+			if tag != "" {
+				tag += " "
+			}
+			if _, err := fmt.Fprintf(w, "%s %s %s.%s %s%s\n",
+				e.ReceivedAt.Format(timeLayout), e.FromHost, e.FacilityLabel,
+				strings.ToLower(e.SeverityLabel), tag, oneLine(e.Message)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// writeJSON prints v as indented JSON.
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// oneLine keeps multi-line messages on one table row.
+func oneLine(s string) string {
+	return strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ", "\t", " ").Replace(strings.TrimSpace(s))
+}
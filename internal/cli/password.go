@@ -0,0 +1,114 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/phil-bot/rsyslox/internal/auth"
+	"github.com/phil-bot/rsyslox/internal/config"
+)
+
+// minPasswordLength matches the setup wizard.
+const minPasswordLength = 12
+
+// errNotTerminal is returned by readPassword when stdin is no terminal.
+var errNotTerminal = errors.New("stdin is not a terminal; pass the password with -password-stdin")
+
+// runHashPassword prints the bcrypt hash of the given password, for
+// setting auth.admin_password_hash in config.toml by hand.
+func runHashPassword(args []string) error {
+	if len(args) != 1 {
+		return usagef("expected exactly one password")
+	}
+	hash, err := auth.HashAdminPassword(args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Println(hash)
+	return nil
+}
+
+// runAdmin implements rsyslox admin <subcommand>.
+func runAdmin(args []string) error {
+	return runSub(args, map[string]func([]string) error{
+		"reset-password": runResetPassword,
+	})
+}
+
+// runResetPassword sets a new password for the local admin account in
+// config.toml, optionally removing its two-factor authentication.
+func runResetPassword(args []string) error {
+	var (
+		cfgPath    string
+		fromStdin  bool
+		disable2FA bool
+	)
+	fs := newFlagSet("admin reset-password", "[flags]")
+	fs.StringVar(&cfgPath, "config", "", "config.toml to change (default "+config.ActiveConfigPath()+")")
+	fs.BoolVar(&fromStdin, "password-stdin", false, "read the new password from the first line of stdin instead of prompting")
+	fs.BoolVar(&disable2FA, "disable-2fa", false, "also remove two-factor authentication, e.g. after losing the authenticator")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return usagef("unexpected argument %q", fs.Arg(0))
+	}
+
+	cfg, err := loadConfig(cfgPath)
+	if err != nil {
+		return err
+	}
+
+	var password string
+	if fromStdin {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return fmt.Errorf("reading password from stdin: %w", err)
+		}
+		password = strings.TrimRight(line, "\r\n")
+	} else {
+		fmt.Fprint(os.Stderr, "New admin password: ")
+		first, err := readPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(os.Stderr, "Repeat password: ")
+		second, err := readPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(first, second) {
+			return usagef("the passwords do not match")
+		}
+		password = string(first)
+	}
+	if len(password) < minPasswordLength {
+		return usagef("the password must be at least %d characters long", minPasswordLength)
+	}
+
+	hash, err := auth.HashAdminPassword(password)
+	if err != nil {
+		return err
+	}
+	cfg.Auth.AdminPasswordHash = hash
+	if disable2FA {
+		cfg.Auth.TOTPSecret = ""
+		cfg.Auth.TOTPRecoveryCodes = nil
+	}
+	if err := config.Save(cfg, config.Origin{User: actor(), Action: "admin.reset_password"}); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(os.Stderr, "✓ Admin password changed")
+	if disable2FA {
+		fmt.Fprintln(os.Stderr, "✓ Two-factor authentication removed")
+	}
+	reloadHint(cfg)
+	return nil
+}
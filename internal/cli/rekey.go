@@ -0,0 +1,141 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+
+	"github.com/phil-bot/rsyslox/internal/config"
+)
+
+// runConfigRekey re-encrypts the secrets in config.toml with a new master
+// key, stored in a key file.
+func runConfigRekey(args []string) error {
+	var (
+		cfgPath       string
+		keyFile       string
+		reuse         bool
+		fromKeyFile   string
+		fromMachineID string
+	)
+	fs := newFlagSet("config rekey", "[flags]")
+	fs.StringVar(&cfgPath, "config", "", "config.toml to change (default "+config.ActiveConfigPath()+")")
+	fs.StringVar(&keyFile, "key-file", "", "where to write the new master key (default master.key next to config.toml)")
+	fs.BoolVar(&reuse, "reuse", false, "use the key already in -key-file instead of generating one, e.g. a key shared by replicas")
+	fs.StringVar(&fromKeyFile, "from-key-file", "", "decrypt with the key in this file instead of the current key")
+	fs.StringVar(&fromMachineID, "from-machine-id", "", "decrypt with the key of the host with this machine ID, e.g. after moving config.toml")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return usagef("unexpected argument %q", fs.Arg(0))
+	}
+	if fromKeyFile != "" && fromMachineID != "" {
+		return usagef("-from-key-file and -from-machine-id cannot be combined")
+	}
+
+	path := configFile(cfgPath)
+	if keyFile == "" {
+		keyFile = config.MasterKeyPath()
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return withCode(ExitConfig, err)
+	}
+	// The file without environment overrides: those secrets are not ours
+	// to rewrite.
+	cfg, err := config.ReadFile(path)
+	if err != nil {
+		return withCode(ExitConfig, err)
+	}
+
+	var from *config.MasterKey
+	switch {
+	case fromKeyFile != "":
+		from, err = config.MasterKeyFromFile(fromKeyFile)
+	case fromMachineID != "":
+		from = config.MasterKeyFromMachineID(fromMachineID)
+	default:
+		from, err = config.LoadMasterKey()
+	}
+	if err != nil {
+		return withCode(ExitConfig, err)
+	}
+
+	var to *config.MasterKey
+	secret := ""
+	if reuse {
+		if to, err = config.MasterKeyFromFile(keyFile); err != nil {
+			return withCode(ExitConfig, err)
+		}
+	} else {
+		if secret, err = config.GenerateMasterKey(); err != nil {
+			return err
+		}
+		if to, err = config.NewMasterKey(secret, keyFile); err != nil {
+			return err
+		}
+	}
+
+	n, err := cfg.Rekey(from, to)
+	if err != nil {
+		return withCode(ExitConfig, fmt.Errorf("%w\n  pass the key the secrets were encrypted with via -from-key-file or -from-machine-id", err))
+	}
+
+	// The new key goes next to its final place first and replaces the old
+	// one only once config.toml has been written, so a failed save leaves
+	// both files as they were.
+	tmp := keyFile + ".new"
+	if !reuse {
+		if err := writeKeyFile(tmp, secret, fi); err != nil {
+			return err
+		}
+	}
+	if err := config.Save(cfg, config.Origin{User: actor(), Action: "config.rekey"}); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if !reuse {
+		if err := os.Rename(tmp, keyFile); err != nil {
+			return fmt.Errorf("%s is encrypted with the key in %s, but it could not be moved into place: %w", path, tmp, err)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "✓ Re-encrypted %d secret(s) in %s with the master key in %s\n", n, path, keyFile)
+	// Saved versions would otherwise become unusable for rollbacks.
+	rekeyed, skipped, err := config.RekeyHistory(path, from, to)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️  Configuration history: %v\n", err)
+	} else if rekeyed+skipped > 0 {
+		fmt.Fprintf(os.Stderr, "  Re-encrypted %d saved version(s)", rekeyed)
+		if skipped > 0 {
+			fmt.Fprintf(os.Stderr, "; %d encrypted with another key were left as they are", skipped)
+		}
+		fmt.Fprintln(os.Stderr)
+	}
+	if current, err := config.LoadMasterKey(); err == nil && current.Source != keyFile {
+		if keyFile == config.MasterKeyPath() {
+			fmt.Fprintf(os.Stderr, "  Note: here the master key is read from %s, which takes precedence over %s.\n", current.Source, keyFile)
+		} else {
+			fmt.Fprintf(os.Stderr, "  Note: %s is not read by default.\n", keyFile)
+		}
+		fmt.Fprintf(os.Stderr, "  Point %s or the systemd credential %s at the new key.\n", config.EnvMasterKeyFile, config.MasterKeyCredential)
+	}
+	reloadHint(cfg)
+	return nil
+}
+
+// writeKeyFile writes a master key readable by the owner and group of
+// config.toml (fi), which the server runs as.
+func writeKeyFile(path, secret string, fi os.FileInfo) error {
+	if err := os.WriteFile(path, []byte(secret+"\n"), 0640); err != nil {
+		return fmt.Errorf("failed to write master key: %w", err)
+	}
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok && os.Geteuid() == 0 {
+		if err := os.Chown(path, int(st.Uid), int(st.Gid)); err != nil {
+			os.Remove(path)
+			return fmt.Errorf("failed to set owner of master key: %w", err)
+		}
+	}
+	return nil
+}
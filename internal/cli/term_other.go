@@ -0,0 +1,9 @@
+//go:build !linux
+
+package cli
+
+// readPassword is only implemented on Linux; elsewhere the password has
+// to come from -password-stdin.
+func readPassword(fd int) ([]byte, error) {
+	return nil, errNotTerminal
+}
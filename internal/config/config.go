@@ -5,12 +5,21 @@
 package config
 
 import (
+	"bytes"
 	"fmt"
+	"log/slog"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/BurntSushi/toml"
+
+	"github.com/phil-bot/rsyslox/internal/fileutil"
+
+	"github.com/phil-bot/rsyslox/internal/logging"
 )
 
 const (
@@ -21,11 +30,16 @@ const (
 	EnvConfigPath = "RSYSLOX_CONFIG"
 )
 
-// Load reads the configuration from disk.
+// Load reads the configuration from disk and applies RSYSLOX_* environment
+// overrides (see envPrefix).
 // Returns (cfg, false, nil)  when the config file exists and is valid.
 // Returns (defaults, true, nil) when the config file does not exist yet
 // (first-run / setup-wizard mode).
 // Returns (nil, false, err) on any other error.
+//
+// Without a config file but with overrides in the environment, the
+// configuration is built from the defaults and the environment alone, so
+// containers can run without writing config.toml.
 func Load() (*Config, bool, error) {
 	path := configPath()
 
@@ -33,7 +47,7 @@ func Load() (*Config, bool, error) {
 	cfg.ConfigPath = path
 	cfg.InstallPath = installPath()
 
-	if _, err := os.Stat(path); os.IsNotExist(err) {
+	if _, err := os.Stat(path); os.IsNotExist(err) && !hasEnvOverrides() {
 		// No config file → setup wizard needed.
 		// Allow the port to be overridden via RSYSLOX_PORT so the installer
 		// can pass a user-chosen port before any config.toml exists.
@@ -46,8 +60,14 @@ func Load() (*Config, bool, error) {
 		return cfg, true, nil
 	}
 
-	if _, err := toml.DecodeFile(path, cfg); err != nil {
-		return nil, false, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		if _, err := toml.DecodeFile(path, cfg); err != nil {
+			return nil, false, fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return nil, false, err
 	}
 
 	if err := cfg.Validate(); err != nil {
@@ -57,9 +77,24 @@ func Load() (*Config, bool, error) {
 	return cfg, false, nil
 }
 
-// Save writes the configuration to disk.
-// The file is written with mode 0640 (root:rsyslox readable).
-func Save(cfg *Config) error {
+// ReadFile reads config.toml at path over the defaults, without
+// environment overrides and validation, for tools that rewrite the file.
+func ReadFile(path string) (*Config, error) {
+	cfg := defaults()
+	cfg.ConfigPath = path
+	cfg.InstallPath = installPath()
+	if _, err := toml.DecodeFile(path, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Save writes the configuration to disk and records it in the history
+// (see History) as saved by origin.
+// The file is replaced atomically with mode 0640 (root:rsyslox readable),
+// so a crash never leaves a truncated config.toml behind.
+// Settings overridden from the environment keep their value in the file.
+func Save(cfg *Config, origin Origin) error {
 	path := cfg.ConfigPath
 	if path == "" {
 		path = configPath()
@@ -70,22 +105,74 @@ func Save(cfg *Config) error {
 		return fmt.Errorf("failed to create config directory: %w", err)
 	}
 
-	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0640)
+	data, err := encode(cfg.forFile())
 	if err != nil {
-		return fmt.Errorf("failed to open config file for writing: %w", err)
+		return err
 	}
-	defer f.Close()
 
-	enc := toml.NewEncoder(f)
-	if err := enc.Encode(cfg); err != nil {
-		return fmt.Errorf("failed to encode config: %w", err)
-	}
+	saveMu.Lock()
+	defer saveMu.Unlock()
 
+	keep := cfg.Server.ConfigHistory
+	if keep > 0 {
+		// Changes made to the file by hand since the last save become a
+		// version of their own, so they can be restored too.
+		recordEdits(path)
+	}
+	if err := fileutil.WriteAtomic(path, data, 0640); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	if keep > 0 {
+		if err := recordVersion(path, data, origin, time.Now(), keep); err != nil {
+			slog.Warn("Config history", "err", err)
+		}
+	}
 	return nil
 }
 
+// encode returns cfg in TOML.
+func encode(cfg *Config) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(cfg); err != nil {
+		return nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
 // Validate checks that all required fields are set and values are in range.
 func (c *Config) Validate() error {
+	if s := c.Server; s.ReadTimeout < 0 || s.WriteTimeout < 0 || s.IdleTimeout < 0 || s.ShutdownTimeout < 0 {
+		return fmt.Errorf("server timeouts must not be negative")
+	}
+	if p := c.Server.Prefix(); p != "" && (path.Clean(p) != p || strings.ContainsAny(p, "?#% ")) {
+		return fmt.Errorf("server.base_path must be a plain URL path such as \"/syslog\"")
+	}
+	if c.Server.ConfigHistory < 0 {
+		return fmt.Errorf("server.config_history must not be negative")
+	}
+	if _, err := c.Server.Listeners(); err != nil {
+		return err
+	}
+	if _, err := c.Server.UnixSocketMode(); err != nil {
+		return err
+	}
+	if a := c.Server.ACME; a.Enabled {
+		if !c.Server.TLSEnabled() {
+			return fmt.Errorf("server.acme requires HTTPS (server.use_ssl = true or an https:// listener)")
+		}
+		if len(a.Domains) == 0 {
+			return fmt.Errorf("server.acme.domains must list at least one domain")
+		}
+		if a.DirectoryURL == "" || a.CacheDir == "" {
+			return fmt.Errorf("server.acme.directory_url and cache_dir are required")
+		}
+		if a.HTTPPort < 0 || a.HTTPPort > 65535 {
+			return fmt.Errorf("server.acme.http_port must be between 0 and 65535")
+		}
+		if a.RenewBefore < 0 {
+			return fmt.Errorf("server.acme.renew_before must not be negative")
+		}
+	}
 	if c.Database.Host == "" {
 		return fmt.Errorf("database.host is required")
 	}
@@ -98,9 +185,93 @@ func (c *Config) Validate() error {
 	if c.Database.Password == "" {
 		return fmt.Errorf("database.password is required")
 	}
+	if c.Database.QueryTimeouts.Logs < 0 || c.Database.QueryTimeouts.Meta < 0 {
+		return fmt.Errorf("database.query_timeouts must not be negative")
+	}
+	if c.Database.TotalRefresh < time.Second {
+		return fmt.Errorf("database.total_refresh must be at least 1s")
+	}
 	if c.Auth.AdminPasswordHash == "" {
 		return fmt.Errorf("auth.admin_password_hash is required")
 	}
+	if l := c.Auth.LDAP; l.Enabled {
+		if l.URL == "" {
+			return fmt.Errorf("auth.ldap.url is required when LDAP is enabled")
+		}
+		if l.UserBaseDN == "" {
+			return fmt.Errorf("auth.ldap.user_base_dn is required when LDAP is enabled")
+		}
+		if len(l.AdminGroups) == 0 && len(l.ReadOnlyGroups) == 0 {
+			return fmt.Errorf("auth.ldap needs at least one of admin_groups or read_only_groups")
+		}
+	}
+	if c.Auth.Lockout.MaxAttempts < 1 {
+		return fmt.Errorf("auth.lockout.max_attempts must be at least 1")
+	}
+	if c.Auth.Lockout.GlobalMaxAttempts < 0 {
+		return fmt.Errorf("auth.lockout.global_max_attempts must not be negative")
+	}
+	if m := c.Auth.MTLS; m.Enabled {
+		if !c.Server.TLSEnabled() {
+			return fmt.Errorf("auth.mtls requires HTTPS (server.use_ssl = true or an https:// listener)")
+		}
+		if m.ClientCA == "" {
+			return fmt.Errorf("auth.mtls.client_ca is required when mTLS is enabled")
+		}
+	}
+	for _, m := range c.Auth.MTLS.Mappings {
+		if m.Name == "" {
+			return fmt.Errorf("auth.mtls.mappings: name is required")
+		}
+		if m.Subject == "" && m.SAN == "" {
+			return fmt.Errorf("auth.mtls.mappings %q: subject or san is required", m.Name)
+		}
+		switch {
+		case m.Key != "" && m.Role != "":
+			return fmt.Errorf("auth.mtls.mappings %q: set either role or key, not both", m.Name)
+		case m.Key == "" && m.Role != "readonly" && m.Role != "admin":
+			return fmt.Errorf("auth.mtls.mappings %q: role must be \"readonly\" or \"admin\"", m.Name)
+		}
+	}
+	switch c.Auth.Sessions.Store {
+	case "", "memory":
+	case "file":
+		if c.Auth.Sessions.File == "" {
+			return fmt.Errorf("auth.sessions.file is required when store = \"file\"")
+		}
+	default:
+		return fmt.Errorf("auth.sessions.store must be \"memory\" or \"file\"")
+	}
+	if s := c.Auth.Sessions; s.IdleTimeout < 0 || s.MaxLifetime < 0 {
+		return fmt.Errorf("auth.sessions timeouts must not be negative")
+	}
+	if rl := c.RateLimit; rl.Enabled {
+		if rl.RequestsPerMinute < 1 {
+			return fmt.Errorf("rate_limit.requests_per_minute must be at least 1")
+		}
+		if rl.IPRequestsPerMinute < 0 {
+			return fmt.Errorf("rate_limit.ip_requests_per_minute must not be negative")
+		}
+		if rl.Burst < 1 {
+			return fmt.Errorf("rate_limit.burst must be at least 1")
+		}
+		if rl.HeavyQuerySlots < 1 {
+			return fmt.Errorf("rate_limit.heavy_query_slots must be at least 1")
+		}
+	}
+	for _, k := range c.Auth.ReadOnlyKeys {
+		if k.RateLimit < 0 {
+			return fmt.Errorf("auth.read_only_keys %q: rate_limit must not be negative", k.Name)
+		}
+	}
+	switch c.Logging.Format {
+	case "", logging.FormatText, logging.FormatJSON:
+	default:
+		return fmt.Errorf("logging.format must be \"text\" or \"json\"")
+	}
+	if _, err := logging.ParseLevel(c.Logging.Level); err != nil {
+		return fmt.Errorf("logging.level: %w", err)
+	}
 	if c.Server.Port <= 0 || c.Server.Port > 65535 {
 		return fmt.Errorf("server.port must be between 1 and 65535")
 	}
@@ -9,29 +9,147 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 )
 
 const encPrefix = "enc:"
 
-// EncryptPassword encrypts a plaintext password using AES-256-GCM.
-// The encryption key is derived from the machine ID so the ciphertext
-// is only decryptable on the same host.
+// Sources of the master key that encrypts secrets in config.toml, in order
+// of precedence. Without any of them the key is derived from the machine
+// ID, which ties the configuration to the host.
+const (
+	// EnvMasterKey holds the master key itself.
+	EnvMasterKey = "RSYSLOX_MASTER_KEY"
+
+	// EnvMasterKeyFile names a file containing the master key.
+	EnvMasterKeyFile = "RSYSLOX_MASTER_KEY_FILE"
+
+	// MasterKeyCredential is the name of the systemd credential
+	// (LoadCredential=master-key:/path) read from $CREDENTIALS_DIRECTORY.
+	MasterKeyCredential = "master-key"
+
+	// masterKeyFile is the key file next to config.toml.
+	masterKeyFile = "master.key"
+)
+
+// minMasterKeyLength guards against passphrases that are easily guessed.
+const minMasterKeyLength = 16
+
+// MasterKey encrypts and decrypts secrets such as database.password.
+type MasterKey struct {
+	Source string // where the key came from, for messages
+	key    []byte
+}
+
+// NewMasterKey derives a master key from secret. Surrounding whitespace is
+// ignored, so key files may end with a newline.
+func NewMasterKey(secret, source string) (*MasterKey, error) {
+	secret = strings.TrimSpace(secret)
+	if len(secret) < minMasterKeyLength {
+		return nil, fmt.Errorf("master key from %s must be at least %d characters", source, minMasterKeyLength)
+	}
+	return newMasterKey(secret, source), nil
+}
+
+func newMasterKey(secret, source string) *MasterKey {
+	const salt = "rsyslox-v1-config-key"
+	h := sha256.Sum256([]byte(secret + salt))
+	return &MasterKey{Source: source, key: h[:]}
+}
+
+// MasterKeyFromFile reads a master key from path.
+func MasterKeyFromFile(path string) (*MasterKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read master key: %w", err)
+	}
+	return NewMasterKey(string(data), path)
+}
+
+// MasterKeyFromMachineID returns the key used when no master key is
+// configured on the host with the given machine ID.
+func MasterKeyFromMachineID(id string) *MasterKey {
+	return newMasterKey(strings.TrimSpace(id), "machine ID")
+}
+
+// MasterKeyPath returns the default key file: master.key next to the
+// active config.toml.
+func MasterKeyPath() string {
+	return filepath.Join(filepath.Dir(configPath()), masterKeyFile)
+}
+
+// LoadMasterKey returns the master key from the first available source:
+// RSYSLOX_MASTER_KEY, RSYSLOX_MASTER_KEY_FILE, the systemd credential
+// master-key, MasterKeyPath, and finally the machine ID.
+func LoadMasterKey() (*MasterKey, error) {
+	if v := os.Getenv(EnvMasterKey); v != "" {
+		return NewMasterKey(v, EnvMasterKey)
+	}
+	if p := os.Getenv(EnvMasterKeyFile); p != "" {
+		return MasterKeyFromFile(p)
+	}
+	if dir := os.Getenv("CREDENTIALS_DIRECTORY"); dir != "" {
+		p := filepath.Join(dir, MasterKeyCredential)
+		if _, err := os.Stat(p); err == nil {
+			return MasterKeyFromFile(p)
+		}
+	}
+	if p := MasterKeyPath(); fileExists(p) {
+		return MasterKeyFromFile(p)
+	}
+	machineID, err := readMachineID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read machine ID: %w", err)
+	}
+	return MasterKeyFromMachineID(machineID), nil
+}
+
+// GenerateMasterKey returns a new random master key for a key file.
+func GenerateMasterKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", fmt.Errorf("failed to generate master key: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// EncryptPassword encrypts a plaintext password using AES-256-GCM with the
+// master key (see LoadMasterKey).
 // Returns a string with the "enc:" prefix.
 func EncryptPassword(plaintext string) (string, error) {
-	key, err := deriveKey()
+	key, err := LoadMasterKey()
 	if err != nil {
 		return "", err
 	}
+	return key.Encrypt(plaintext)
+}
 
-	block, err := aes.NewCipher(key)
+// DecryptPassword decrypts a password encrypted by EncryptPassword.
+// If the value does not have the "enc:" prefix it is returned as-is
+// (plaintext fallback for migration / first-run).
+func DecryptPassword(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	key, err := LoadMasterKey()
 	if err != nil {
-		return "", fmt.Errorf("failed to create cipher: %w", err)
+		return "", err
 	}
+	return key.Decrypt(value)
+}
 
-	gcm, err := cipher.NewGCM(block)
+// IsEncrypted reports whether a password value is already encrypted.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, encPrefix)
+}
+
+// Encrypt encrypts plaintext using AES-256-GCM.
+// Returns a string with the "enc:" prefix.
+func (k *MasterKey) Encrypt(plaintext string) (string, error) {
+	gcm, err := k.gcm()
 	if err != nil {
-		return "", fmt.Errorf("failed to create GCM: %w", err)
+		return "", err
 	}
 
 	nonce := make([]byte, gcm.NonceSize())
@@ -44,11 +162,10 @@ func EncryptPassword(plaintext string) (string, error) {
 	return encPrefix + encoded, nil
 }
 
-// DecryptPassword decrypts a password encrypted by EncryptPassword.
-// If the value does not have the "enc:" prefix it is returned as-is
-// (plaintext fallback for migration / first-run).
-func DecryptPassword(value string) (string, error) {
-	if !strings.HasPrefix(value, encPrefix) {
+// Decrypt decrypts a value encrypted by Encrypt. Values without the "enc:"
+// prefix are returned as-is.
+func (k *MasterKey) Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
 		return value, nil
 	}
 
@@ -58,21 +175,11 @@ func DecryptPassword(value string) (string, error) {
 		return "", fmt.Errorf("failed to decode encrypted password: %w", err)
 	}
 
-	key, err := deriveKey()
+	gcm, err := k.gcm()
 	if err != nil {
 		return "", err
 	}
 
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return "", fmt.Errorf("failed to create cipher: %w", err)
-	}
-
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return "", fmt.Errorf("failed to create GCM: %w", err)
-	}
-
 	nonceSize := gcm.NonceSize()
 	if len(ciphertext) < nonceSize {
 		return "", fmt.Errorf("ciphertext too short")
@@ -81,26 +188,56 @@ func DecryptPassword(value string) (string, error) {
 	nonce, ciphertext := ciphertext[:nonceSize], ciphertext[nonceSize:]
 	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
 	if err != nil {
-		return "", fmt.Errorf("failed to decrypt password: %w", err)
+		// The usual cause is a config.toml from another host or a
+		// rotated key, so name the key that was tried.
+		return "", fmt.Errorf("failed to decrypt password with the master key from %s (was it encrypted with another key?): %w", k.Source, err)
 	}
 
 	return string(plaintext), nil
 }
 
-// IsEncrypted reports whether a password value is already encrypted.
-func IsEncrypted(value string) bool {
-	return strings.HasPrefix(value, encPrefix)
+func (k *MasterKey) gcm() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(k.key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	return gcm, nil
 }
 
-// deriveKey derives a 32-byte AES key from the machine ID.
-func deriveKey() ([]byte, error) {
-	machineID, err := readMachineID()
-	if err != nil {
-		return nil, fmt.Errorf("failed to read machine ID: %w", err)
+// secrets returns the encrypted settings of c by TOML key.
+func (c *Config) secrets() map[string]*string {
+	return map[string]*string{
+		"database.password":       &c.Database.Password,
+		"auth.ldap.bind_password": &c.Auth.LDAP.BindPassword,
+		"auth.totp_secret":        &c.Auth.TOTPSecret,
 	}
-	const salt = "rsyslox-v1-config-key"
-	h := sha256.Sum256([]byte(machineID + salt))
-	return h[:], nil
+}
+
+// Rekey re-encrypts the secrets of c, which were encrypted with from,
+// with to. Secrets stored in plaintext are encrypted as well. It returns
+// the number of secrets; on error c is unchanged.
+func (c *Config) Rekey(from, to *MasterKey) (int, error) {
+	next := map[*string]string{}
+	for name, p := range c.secrets() {
+		if *p == "" {
+			continue
+		}
+		plain, err := from.Decrypt(*p)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", name, err)
+		}
+		if next[p], err = to.Encrypt(plain); err != nil {
+			return 0, err
+		}
+	}
+	for p, v := range next {
+		*p = v
+	}
+	return len(next), nil
 }
 
 // readMachineID returns a stable host identifier.
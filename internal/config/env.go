@@ -0,0 +1,215 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// envPrefix starts the variables that override settings of config.toml:
+// RSYSLOX_ followed by the TOML key in upper case with dots and dashes
+// replaced by underscores, e.g. RSYSLOX_DATABASE_PASSWORD for
+// database.password. With the suffix _FILE the value is read from a file
+// instead (Docker and Kubernetes secrets).
+const envPrefix = "RSYSLOX_"
+
+// envField is a setting that can be overridden from the environment.
+type envField struct {
+	Name  string // environment variable
+	Key   string // TOML key, e.g. "database.password"
+	index []int  // reflect field index path from Config
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// envFields lists the settings of Config that can be set from the
+// environment: strings, numbers, booleans, durations and lists of strings
+// (comma-separated or a TOML array, see splitList). Lists of tables such as auth.read_only_keys are not
+// included.
+func envFields() []envField {
+	var fields []envField
+	var walk func(t reflect.Type, key string, index []int)
+	walk = func(t reflect.Type, key string, index []int) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := strings.Split(f.Tag.Get("toml"), ",")[0]
+			if tag == "" || tag == "-" {
+				continue
+			}
+			k := tag
+			if key != "" {
+				k = key + "." + tag
+			}
+			idx := append(append([]int{}, index...), i)
+			switch {
+			case f.Type.Kind() == reflect.Struct && f.Type != reflect.TypeOf(time.Time{}):
+				walk(f.Type, k, idx)
+			case settable(f.Type):
+				fields = append(fields, envField{Name: envName(k), Key: k, index: idx})
+			}
+		}
+	}
+	walk(reflect.TypeOf(Config{}), "", nil)
+	return fields
+}
+
+// envName returns the variable for a TOML key.
+func envName(key string) string {
+	return envPrefix + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(key))
+}
+
+func settable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Bool, reflect.Int, reflect.Int64, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.String
+	}
+	return false
+}
+
+// lookupEnv returns the value of name, or of the file named by name_FILE.
+func lookupEnv(name string) (string, bool, error) {
+	if v, ok := os.LookupEnv(name); ok {
+		return v, true, nil
+	}
+	p, ok := os.LookupEnv(name + "_FILE")
+	if !ok {
+		return "", false, nil
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return "", false, fmt.Errorf("%s_FILE: %w", name, err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), true, nil
+}
+
+// hasEnvOverrides reports whether any override variable is set.
+func hasEnvOverrides() bool {
+	for _, f := range envFields() {
+		if _, ok := os.LookupEnv(f.Name); ok {
+			return true
+		}
+		if _, ok := os.LookupEnv(f.Name + "_FILE"); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// applyEnv sets the fields of c that are overridden in the environment
+// and remembers their values in the file, so Save does not persist them.
+func (c *Config) applyEnv() error {
+	file := *c
+	v := reflect.ValueOf(c).Elem()
+	for _, f := range envFields() {
+		s, ok, err := lookupEnv(f.Name)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if err := setField(v.FieldByIndex(f.index), s); err != nil {
+			return fmt.Errorf("%s: invalid value for %s: %w", f.Name, f.Key, err)
+		}
+		c.envOverrides = append(c.envOverrides, f)
+	}
+	if len(c.envOverrides) > 0 {
+		c.fileValues = &file
+	}
+	return nil
+}
+
+func setField(v reflect.Value, s string) error {
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(s)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.Int || v.Kind() == reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case v.Kind() == reflect.Float64:
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	case v.Kind() == reflect.Slice:
+		elems, err := splitList(s)
+		if err != nil {
+			return err
+		}
+		list := reflect.MakeSlice(v.Type(), 0, len(elems))
+		for _, e := range elems {
+			list = reflect.Append(list, reflect.ValueOf(e).Convert(v.Type().Elem()))
+		}
+		v.Set(list)
+	}
+	return nil
+}
+
+// splitList parses the value of a list setting: a TOML array such as
+// ["cn=admins,dc=example,dc=org"] for values that contain commas, like
+// LDAP DNs, or else comma-separated values.
+func splitList(s string) ([]string, error) {
+	if strings.HasPrefix(strings.TrimSpace(s), "[") {
+		var arr struct{ V []string }
+		if _, err := toml.Decode("V = "+s, &arr); err != nil {
+			return nil, fmt.Errorf("invalid array: %w", err)
+		}
+		return arr.V, nil
+	}
+	var list []string
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			list = append(list, e)
+		}
+	}
+	return list, nil
+}
+
+// EnvOverrides returns the variables that override settings of c, sorted.
+func (c *Config) EnvOverrides() []string {
+	names := make([]string, len(c.envOverrides))
+	for i, f := range c.envOverrides {
+		names[i] = f.Name
+	}
+	sort.Strings(names)
+	return names
+}
+
+// forFile returns c with the overridden settings set back to their values
+// in config.toml.
+func (c *Config) forFile() *Config {
+	if c.fileValues == nil {
+		return c
+	}
+	out := *c
+	v := reflect.ValueOf(&out).Elem()
+	file := reflect.ValueOf(c.fileValues).Elem()
+	for _, f := range c.envOverrides {
+		v.FieldByIndex(f.index).Set(file.FieldByIndex(f.index))
+	}
+	return &out
+}
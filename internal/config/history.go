@@ -0,0 +1,333 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/phil-bot/rsyslox/internal/fileutil"
+)
+
+// historyDir holds the saved versions of config.toml, next to it.
+const historyDir = "history"
+
+// ActionFileEdit marks versions that were found on disk instead of being
+// saved by rsyslox, e.g. after editing config.toml by hand.
+const ActionFileEdit = "file.edit"
+
+// ErrVersionNotFound is returned for versions that are not in the history.
+var ErrVersionNotFound = errors.New("configuration version not found")
+
+// ErrInvalidVersion wraps the error of a version that cannot be read as a
+// configuration or is not valid.
+var ErrInvalidVersion = errors.New("invalid configuration version")
+
+// saveMu serialises saves within the process; version files are created
+// exclusively, so a concurrent CLI command cannot overwrite one either.
+var saveMu sync.Mutex
+
+// Origin records who saved a configuration and why.
+type Origin struct {
+	User   string // e.g. "admin", "cli:alice", "setup"
+	Action string // audit action such as "config.update"
+}
+
+// Version describes one saved configuration.
+type Version struct {
+	Version int       `json:"version"`
+	SavedAt time.Time `json:"saved_at"`
+	SavedBy string    `json:"saved_by"`
+	Action  string    `json:"action"`
+	Current bool      `json:"current"` // identical to config.toml
+}
+
+// Each version is stored as <n>.toml: a header of comments followed by the
+// file as written.
+const (
+	headerVersion = "# rsyslox configuration version "
+	headerSavedAt = "# saved_at = "
+	headerSavedBy = "# saved_by = "
+	headerAction  = "# action   = "
+)
+
+func historyPath(configFile string) string {
+	return filepath.Join(filepath.Dir(configFile), historyDir)
+}
+
+func versionFile(dir string, n int) string {
+	return filepath.Join(dir, fmt.Sprintf("%06d.toml", n))
+}
+
+// History returns the saved versions of the config file at path, newest
+// first.
+func History(path string) ([]Version, error) {
+	dir := historyPath(path)
+	nums, err := versionNumbers(dir)
+	if err != nil {
+		return nil, err
+	}
+	current, _ := os.ReadFile(path)
+	list := make([]Version, 0, len(nums))
+	for i := len(nums) - 1; i >= 0; i-- {
+		v, body, err := readVersion(versionFile(dir, nums[i]))
+		if err != nil {
+			slog.Warn("Config history", "err", err)
+			continue
+		}
+		v.Current = current != nil && bytes.Equal(body, current)
+		list = append(list, *v)
+	}
+	return list, nil
+}
+
+// ReadVersion returns version n of the config file at path as it was
+// written: over the defaults, without environment overrides.
+func ReadVersion(path string, n int) (*Config, *Version, error) {
+	v, body, err := readVersion(versionFile(historyPath(path), n))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, ErrVersionNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	cfg := defaults()
+	cfg.ConfigPath = path
+	cfg.InstallPath = installPath()
+	if _, err := toml.Decode(string(body), cfg); err != nil {
+		return nil, nil, fmt.Errorf("%w %d: %w", ErrInvalidVersion, n, err)
+	}
+	return cfg, v, nil
+}
+
+// Restore returns the configuration a rollback of current to version n
+// produces. The environment overrides apply as on Load, and the settings
+// in KeptOnRestore stay as they are in current, so a rollback cannot
+// revive a revoked key, certificate or group or a replaced password. The
+// result is validated.
+func Restore(current *Config, n int) (*Config, error) {
+	path := current.ConfigPath
+	if path == "" {
+		path = configPath()
+	}
+	cfg, _, err := ReadVersion(path, n)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.applyEnv(); err != nil {
+		return nil, fmt.Errorf("%w %d: %w", ErrInvalidVersion, n, err)
+	}
+	keepCredentials(cfg, current)
+	if cfg.fileValues != nil {
+		keepCredentials(cfg.fileValues, current.forFile())
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("%w %d: %w", ErrInvalidVersion, n, err)
+	}
+	return cfg, nil
+}
+
+// KeptOnRestore lists the settings (dotted TOML keys) that decide who has
+// access. Restore takes them from the running configuration instead of
+// the restored version.
+var KeptOnRestore = []string{
+	"auth.admin_password_hash",
+	"auth.totp_secret",
+	"auth.totp_recovery_codes",
+	"auth.read_only_keys",
+	"auth.mtls.mappings",
+	"auth.ldap.admin_groups",
+	"auth.ldap.read_only_groups",
+}
+
+// keepCredentials copies the settings of KeptOnRestore from from to cfg.
+func keepCredentials(cfg, from *Config) {
+	cfg.Auth.AdminPasswordHash = from.Auth.AdminPasswordHash
+	cfg.Auth.TOTPSecret = from.Auth.TOTPSecret
+	cfg.Auth.TOTPRecoveryCodes = slices.Clone(from.Auth.TOTPRecoveryCodes)
+	cfg.Auth.ReadOnlyKeys = slices.Clone(from.Auth.ReadOnlyKeys)
+	cfg.Auth.MTLS.Mappings = slices.Clone(from.Auth.MTLS.Mappings)
+	cfg.Auth.LDAP.AdminGroups = slices.Clone(from.Auth.LDAP.AdminGroups)
+	cfg.Auth.LDAP.ReadOnlyGroups = slices.Clone(from.Auth.LDAP.ReadOnlyGroups)
+}
+
+// RekeyHistory re-encrypts the secrets in the saved versions of the config
+// file at path, like Config.Rekey. Versions encrypted with neither key are
+// left as they are and counted as skipped.
+func RekeyHistory(path string, from, to *MasterKey) (rekeyed, skipped int, err error) {
+	saveMu.Lock()
+	defer saveMu.Unlock()
+
+	dir := historyPath(path)
+	nums, err := versionNumbers(dir)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, n := range nums {
+		file := versionFile(dir, n)
+		v, body, err := readVersion(file)
+		if err != nil {
+			return rekeyed, skipped, err
+		}
+		cfg := defaults()
+		if _, err := toml.Decode(string(body), cfg); err != nil {
+			return rekeyed, skipped, fmt.Errorf("version %d: %w", n, err)
+		}
+		if _, err := cfg.Rekey(from, to); err != nil {
+			// Versions saved with the new key need no change.
+			if _, err := cfg.Rekey(to, to); err != nil {
+				skipped++
+			}
+			continue
+		}
+		data, err := encode(cfg)
+		if err != nil {
+			return rekeyed, skipped, err
+		}
+		if err := fileutil.WriteAtomic(file, append(header(v), data...), 0640); err != nil {
+			return rekeyed, skipped, err
+		}
+		rekeyed++
+	}
+	return rekeyed, skipped, nil
+}
+
+// recordEdits stores the config file at path as a version when it differs
+// from the newest version, i.e. when it was changed outside of Save.
+func recordEdits(path string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	dir := historyPath(path)
+	if nums, err := versionNumbers(dir); err == nil && len(nums) > 0 {
+		if _, body, err := readVersion(versionFile(dir, nums[len(nums)-1])); err == nil && bytes.Equal(body, data) {
+			return
+		}
+	}
+	savedAt := time.Now()
+	if fi, err := os.Stat(path); err == nil {
+		savedAt = fi.ModTime()
+	}
+	if err := recordVersion(path, data, Origin{Action: ActionFileEdit}, savedAt, 0); err != nil {
+		slog.Warn("Config history", "err", err)
+	}
+}
+
+// recordVersion adds data as the next version and, when keep > 0, removes
+// all but the newest keep versions.
+func recordVersion(path string, data []byte, origin Origin, savedAt time.Time, keep int) error {
+	dir := historyPath(path)
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return err
+	}
+	nums, err := versionNumbers(dir)
+	if err != nil {
+		return err
+	}
+	next := 1
+	if len(nums) > 0 {
+		next = nums[len(nums)-1] + 1
+	}
+	for ; ; next++ {
+		f, err := os.OpenFile(versionFile(dir, next), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0640)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		v := &Version{Version: next, SavedAt: savedAt.UTC(), SavedBy: origin.User, Action: origin.Action}
+		_, err = f.Write(append(header(v), data...))
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+		break
+	}
+	if keep > 0 && len(nums)+1 > keep {
+		nums = append(nums, next)
+		for _, n := range nums[:len(nums)-keep] {
+			os.Remove(versionFile(dir, n))
+		}
+	}
+	return nil
+}
+
+func header(v *Version) []byte {
+	return []byte(fmt.Sprintf("%s%d\n%s%s\n%s%s\n%s%s\n",
+		headerVersion, v.Version,
+		headerSavedAt, v.SavedAt.UTC().Format(time.RFC3339),
+		headerSavedBy, v.SavedBy,
+		headerAction, v.Action))
+}
+
+// readVersion parses a version file into its header and the file body.
+func readVersion(file string) (*Version, []byte, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	v := &Version{}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	offset := 0
+	for i := 0; i < 4 && sc.Scan(); i++ {
+		line := sc.Text()
+		offset += len(line) + 1
+		switch {
+		case strings.HasPrefix(line, headerVersion):
+			v.Version, err = strconv.Atoi(strings.TrimPrefix(line, headerVersion))
+		case strings.HasPrefix(line, headerSavedAt):
+			v.SavedAt, err = time.Parse(time.RFC3339, strings.TrimPrefix(line, headerSavedAt))
+		case strings.HasPrefix(line, headerSavedBy):
+			v.SavedBy = strings.TrimPrefix(line, headerSavedBy)
+		case strings.HasPrefix(line, headerAction):
+			v.Action = strings.TrimPrefix(line, headerAction)
+		default:
+			err = errors.New("missing header")
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %s: invalid header: %w", ErrInvalidVersion, filepath.Base(file), err)
+		}
+	}
+	if offset > len(data) {
+		offset = len(data)
+	}
+	return v, data[offset:], nil
+}
+
+// versionNumbers returns the versions in dir in ascending order.
+func versionNumbers(dir string) ([]int, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var nums []int
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasSuffix(name, ".toml") {
+			continue
+		}
+		if n, err := strconv.Atoi(strings.TrimSuffix(name, ".toml")); err == nil {
+			nums = append(nums, n)
+		}
+	}
+	sort.Ints(nums)
+	return nums, nil
+}
@@ -0,0 +1,163 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ListenList is server.listen. It accepts a single string as well as an
+// array, so `listen = "unix:/run/rsyslox/rsyslox.sock"` works.
+type ListenList []string
+
+// UnmarshalTOML implements toml.Unmarshaler.
+func (l *ListenList) UnmarshalTOML(v interface{}) error {
+	switch v := v.(type) {
+	case string:
+		*l = ListenList{v}
+	case []interface{}:
+		list := make(ListenList, 0, len(v))
+		for _, e := range v {
+			s, ok := e.(string)
+			if !ok {
+				return fmt.Errorf("server.listen: entries must be strings")
+			}
+			list = append(list, s)
+		}
+		*l = list
+	default:
+		return fmt.Errorf("server.listen must be a string or an array of strings")
+	}
+	return nil
+}
+
+// ListenSpec is one parsed entry of server.listen.
+type ListenSpec struct {
+	Network string // "tcp" | "unix" | "systemd"
+	Address string // host:port, socket path, or systemd socket name ("" = all passed sockets)
+	TLS     bool
+}
+
+// Key identifies the socket independent of TLS, for matching sockets handed
+// over on restart against the configuration.
+func (l ListenSpec) Key() string {
+	return l.Network + ":" + l.Address
+}
+
+// String returns the spec in the syntax of server.listen.
+func (l ListenSpec) String() string {
+	switch l.Network {
+	case "tcp":
+		if l.TLS {
+			return "https://" + l.Address
+		}
+		return "http://" + l.Address
+	default:
+		s := l.Network
+		if l.Address != "" {
+			s += ":" + l.Address
+		}
+		if l.TLS {
+			s = "https+" + s
+		}
+		return s
+	}
+}
+
+// ParseListen parses one entry of server.listen:
+//
+//	"https://0.0.0.0:8443"            TCP with TLS
+//	"http://127.0.0.1:8000"           TCP without TLS
+//	"0.0.0.0:8000"                    TCP, TLS when defaultTLS (server.use_ssl) is set
+//	"unix:/run/rsyslox/rsyslox.sock"  Unix domain socket
+//	"systemd" / "systemd:<name>"      sockets passed by systemd (LISTEN_FDS), all
+//	                                  or the one with FileDescriptorName=<name>
+//
+// Unix and systemd sockets serve plain HTTP unless prefixed with "https+".
+func ParseListen(entry string, defaultTLS bool) (ListenSpec, error) {
+	e := strings.TrimSpace(entry)
+	var spec ListenSpec
+	switch {
+	case strings.HasPrefix(e, "https://"):
+		spec = ListenSpec{Network: "tcp", Address: strings.TrimPrefix(e, "https://"), TLS: true}
+	case strings.HasPrefix(e, "http://"):
+		spec = ListenSpec{Network: "tcp", Address: strings.TrimPrefix(e, "http://")}
+	default:
+		tls := strings.HasPrefix(e, "https+")
+		rest := strings.TrimPrefix(e, "https+")
+		network, addr, _ := strings.Cut(rest, ":")
+		switch network {
+		case "unix":
+			if !strings.HasPrefix(addr, "/") {
+				return spec, fmt.Errorf("server.listen %q: unix socket path must be absolute", entry)
+			}
+			return ListenSpec{Network: "unix", Address: addr, TLS: tls}, nil
+		case "systemd":
+			return ListenSpec{Network: "systemd", Address: addr, TLS: tls}, nil
+		}
+		if tls {
+			return spec, fmt.Errorf("server.listen %q: use https://host:port for TCP", entry)
+		}
+		spec = ListenSpec{Network: "tcp", Address: strings.TrimPrefix(e, "tcp:"), TLS: defaultTLS}
+	}
+	host, port, err := net.SplitHostPort(strings.TrimSuffix(spec.Address, "/"))
+	if err != nil {
+		return spec, fmt.Errorf("server.listen %q: %w", entry, err)
+	}
+	if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+		return spec, fmt.Errorf("server.listen %q: port must be between 1 and 65535", entry)
+	}
+	spec.Address = net.JoinHostPort(host, port)
+	return spec, nil
+}
+
+// Listeners returns the parsed server.listen entries, or host:port when
+// server.listen is empty.
+func (s ServerConfig) Listeners() ([]ListenSpec, error) {
+	if len(s.Listen) == 0 {
+		addr := net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+		return []ListenSpec{{Network: "tcp", Address: addr, TLS: s.UseSSL}}, nil
+	}
+	specs := make([]ListenSpec, 0, len(s.Listen))
+	seen := make(map[string]bool)
+	for _, e := range s.Listen {
+		spec, err := ParseListen(e, s.UseSSL)
+		if err != nil {
+			return nil, err
+		}
+		if seen[spec.Key()] {
+			return nil, fmt.Errorf("server.listen: %s is listed twice", spec.Key())
+		}
+		seen[spec.Key()] = true
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// TLSEnabled reports whether any listener serves HTTPS.
+func (s ServerConfig) TLSEnabled() bool {
+	specs, err := s.Listeners()
+	if err != nil {
+		return s.UseSSL
+	}
+	for _, l := range specs {
+		if l.TLS {
+			return true
+		}
+	}
+	return false
+}
+
+// UnixSocketMode returns server.socket_mode as file permissions.
+func (s ServerConfig) UnixSocketMode() (os.FileMode, error) {
+	if s.SocketMode == "" {
+		return 0660, nil
+	}
+	m, err := strconv.ParseUint(s.SocketMode, 8, 32)
+	if err != nil || m > 0777 {
+		return 0, fmt.Errorf("server.socket_mode must be an octal mode such as \"0660\"")
+	}
+	return os.FileMode(m), nil
+}
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// Live holds the running configuration of the server. The Config it holds
+// is never modified: a reload or an admin change builds a new one and
+// swaps it in with Update. Readers take a snapshot with Get once per
+// request or operation and read all settings from it, so they never see
+// a half-applied change.
+type Live struct {
+	mu  sync.Mutex // serializes Update
+	cur atomic.Pointer[Config]
+}
+
+// NewLive returns a Live holding cfg. cfg must not be modified afterwards.
+func NewLive(cfg *Config) *Live {
+	l := &Live{}
+	l.cur.Store(cfg)
+	return l
+}
+
+// Get returns the current configuration. It must not be modified; use
+// Update to change it.
+func (l *Live) Get() *Config {
+	return l.cur.Load()
+}
+
+// Update calls fn with a copy of the current configuration and makes the
+// copy current if fn returns nil. Updates run one at a time, so fn sees
+// the result of the previous one; it typically saves the copy with Save
+// and returns the error, leaving the running configuration as it was when
+// saving fails.
+func (l *Live) Update(fn func(next *Config) error) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	next := l.Get().Clone()
+	if err := fn(next); err != nil {
+		return err
+	}
+	l.cur.Store(next)
+	return nil
+}
+
+// Clone returns a copy of c that shares no slices with it, so the copy
+// can be changed without affecting readers of c.
+func (c *Config) Clone() *Config {
+	out := *c
+	out.Server.AllowedOrigins = slices.Clone(c.Server.AllowedOrigins)
+	out.Server.TrustedProxies = slices.Clone(c.Server.TrustedProxies)
+	out.Server.Listen = slices.Clone(c.Server.Listen)
+	out.Server.ACME.Domains = slices.Clone(c.Server.ACME.Domains)
+	out.Auth.ReadOnlyKeys = slices.Clone(c.Auth.ReadOnlyKeys)
+	out.Auth.TOTPRecoveryCodes = slices.Clone(c.Auth.TOTPRecoveryCodes)
+	out.Auth.LDAP.AdminGroups = slices.Clone(c.Auth.LDAP.AdminGroups)
+	out.Auth.LDAP.ReadOnlyGroups = slices.Clone(c.Auth.LDAP.ReadOnlyGroups)
+	out.Auth.MTLS.Mappings = slices.Clone(c.Auth.MTLS.Mappings)
+	return &out
+}
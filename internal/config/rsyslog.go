@@ -1,38 +1,525 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"regexp"
+	"strconv"
+	"strings"
 )
 
-// ParseRsyslogConfig reads MySQL connection details from rsyslog config file
-func ParseRsyslogConfig(configPath string) (string, string, string, string, error) {
-	// Check if file exists
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		return "", "", "", "", fmt.Errorf("rsyslog config file not found: %s", configPath)
+// DefaultRsyslogConfig is the main rsyslog configuration file; the files in
+// DefaultRsyslogConfigDir are read even if it does not include them.
+const (
+	DefaultRsyslogConfig    = "/etc/rsyslog.conf"
+	DefaultRsyslogConfigDir = "/etc/rsyslog.d"
+)
+
+// RsyslogDatabase is the database an ommysql action of rsyslog writes to.
+type RsyslogDatabase struct {
+	Host     string
+	Port     int // 0 = default
+	Name     string
+	User     string
+	Password string
+	File     string // where the action is defined
+	Line     int
+}
+
+// RsyslogParseError is a syntax error in an rsyslog configuration file.
+type RsyslogParseError struct {
+	File string
+	Line int
+	Msg  string
+}
+
+func (e *RsyslogParseError) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+}
+
+// FindRsyslogDatabases returns the ommysql actions of the local rsyslog
+// installation: those in DefaultRsyslogConfig and the files it includes,
+// and those in DefaultRsyslogConfigDir/*.conf.
+func FindRsyslogDatabases() ([]RsyslogDatabase, error) {
+	p := newRsyslogParser()
+	if _, err := os.Stat(DefaultRsyslogConfig); err == nil {
+		p.parseFile(DefaultRsyslogConfig)
+	}
+	p.include(filepath.Join(DefaultRsyslogConfigDir, "*.conf"), "", 0, true)
+	return p.actions, errors.Join(p.errs...)
+}
+
+// ParseRsyslogConfig returns the ommysql actions in the rsyslog
+// configuration file at path and the files it includes, in the order
+// rsyslog reads them. Both RainerScript —
+//
+//	action(type="ommysql" server="localhost" db="Syslog" uid="rsyslog" pwd="secret")
+//
+// with its parameters in any order and spread over several lines — and
+// the legacy syntax are understood:
+//
+//	$ActionOmmysqlServerPort 3306
+//	*.* :ommysql:localhost,Syslog,rsyslog,secret
+//
+// Files are included with include(file="...") and $IncludeConfig, both of
+// which accept globs and directories. Syntax errors do not stop the
+// parser: the actions found are returned together with the errors, each
+// an *RsyslogParseError with file and line.
+func ParseRsyslogConfig(path string) ([]RsyslogDatabase, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("rsyslog config: %w", err)
 	}
+	p := newRsyslogParser()
+	p.parseFile(path)
+	return p.actions, errors.Join(p.errs...)
+}
 
-	// Read file
-	content, err := os.ReadFile(configPath)
+type rsyslogParser struct {
+	actions    []RsyslogDatabase
+	errs       []error
+	visited    map[string]bool
+	legacyPort int // $ActionOmmysqlServerPort, applies to later legacy actions
+}
+
+func newRsyslogParser() *rsyslogParser {
+	return &rsyslogParser{visited: make(map[string]bool)}
+}
+
+func (p *rsyslogParser) errorf(file string, line int, format string, args ...interface{}) {
+	p.errs = append(p.errs, &RsyslogParseError{File: file, Line: line, Msg: fmt.Sprintf(format, args...)})
+}
+
+// include parses the files matching pattern, a glob or a directory,
+// relative to the directory of from. A pattern matching nothing is an
+// error unless optional is set.
+func (p *rsyslogParser) include(pattern, from string, line int, optional bool) {
+	if !filepath.IsAbs(pattern) && from != "" {
+		pattern = filepath.Join(filepath.Dir(from), pattern)
+	}
+	if fi, err := os.Stat(pattern); err == nil && fi.IsDir() {
+		pattern = filepath.Join(pattern, "*")
+	}
+	files, err := filepath.Glob(pattern)
 	if err != nil {
-		return "", "", "", "", fmt.Errorf("failed to read rsyslog config: %v", err)
+		p.errorf(from, line, "invalid include pattern %q: %v", pattern, err)
+		return
+	}
+	if len(files) == 0 && !optional {
+		p.errorf(from, line, "included file %s not found", pattern)
+	}
+	for _, f := range files {
+		if fi, err := os.Stat(f); err == nil && fi.Mode().IsRegular() {
+			p.parseFile(f)
+		}
+	}
+}
+
+func (p *rsyslogParser) parseFile(file string) {
+	abs, err := filepath.Abs(file)
+	if err == nil {
+		file = abs
+	}
+	if p.visited[file] {
+		return
+	}
+	p.visited[file] = true
+	data, err := os.ReadFile(file)
+	if err != nil {
+		p.errs = append(p.errs, fmt.Errorf("rsyslog config: %w", err))
+		return
+	}
+	s := &rsyslogScanner{src: data, file: file, line: 1}
+	for s.pos < len(s.src) {
+		p.statement(s)
+	}
+}
+
+// legacySelector matches a legacy selector line up to its action, e.g.
+// "*.* >" or "kern,mail.=warn;*.none >".
+var legacySelector = regexp.MustCompile(`^[\w*,]+\.[!=<>]*[\w*]+(;[\w*,]+\.[!=<>]*[\w*]+)*\s+-?>`)
+
+// statement consumes the input up to the next point of interest.
+func (p *rsyslogParser) statement(s *rsyslogScanner) {
+	c := s.src[s.pos]
+	switch {
+	case c == '\n':
+		s.pos++
+		s.line++
+	case c == ' ' || c == '\t' || c == '\r':
+		s.pos++
+	case c == '#':
+		s.skipLine()
+	case c == '/' && s.peek(1) == '*':
+		if err := s.skipBlockComment(); err != nil {
+			p.errs = append(p.errs, err)
+		}
+	case c == '"' || c == '\'' || c == '`':
+		if _, err := s.readString(); err != nil {
+			p.errs = append(p.errs, err)
+			s.skipLine()
+		}
+	case c == '$' && s.atLineStart():
+		p.legacyDirective(s)
+	case s.atLineStart() && legacySelector.Match(s.restOfLine()):
+		loc := legacySelector.FindIndex(s.restOfLine())
+		s.pos += loc[1]
+		p.legacyAction(s, s.readLegacyValue())
+	case c == ':' && s.hasPrefix(":ommysql:"):
+		s.pos += len(":ommysql:")
+		p.legacyAction(s, s.readLegacyValue())
+	case isIdentStart(c):
+		name := strings.ToLower(s.readIdent())
+		if name != "action" && name != "include" && name != "module" {
+			return
+		}
+		if err := s.skipSpace(); err != nil {
+			p.errs = append(p.errs, err)
+			return
+		}
+		if s.pos >= len(s.src) || s.src[s.pos] != '(' {
+			return
+		}
+		line := s.line
+		params, err := s.readParams()
+		if err != nil {
+			p.errs = append(p.errs, err)
+			s.skipLine()
+			return
+		}
+		switch name {
+		case "action":
+			p.action(s.file, line, params)
+		case "include":
+			p.includeObject(s.file, line, params)
+		}
+	default:
+		s.pos++
+	}
+}
+
+// action records an action(type="ommysql" ...).
+func (p *rsyslogParser) action(file string, line int, params map[string]string) {
+	if !strings.EqualFold(params["type"], "ommysql") {
+		return
+	}
+	db := RsyslogDatabase{
+		Host:     params["server"],
+		Name:     params["db"],
+		User:     params["uid"],
+		Password: params["pwd"],
+		File:     file,
+		Line:     line,
+	}
+	if port, ok := params["serverport"]; ok {
+		n, err := strconv.Atoi(port)
+		if err != nil || n < 1 || n > 65535 {
+			p.errorf(file, line, "ommysql: invalid serverport %q", port)
+		} else {
+			db.Port = n
+		}
+	}
+	p.add(db)
+}
+
+// includeObject follows include(file="..." mode="...").
+func (p *rsyslogParser) includeObject(file string, line int, params map[string]string) {
+	pattern, ok := params["file"]
+	if !ok {
+		return // include(text="...")
+	}
+	p.include(pattern, file, line, strings.EqualFold(params["mode"], "optional"))
+}
+
+// legacyDirective handles the $-directives that matter here.
+func (p *rsyslogParser) legacyDirective(s *rsyslogScanner) {
+	line := s.line
+	fields := strings.Fields(string(s.restOfLine()))
+	s.skipLine()
+	if len(fields) < 2 {
+		return
+	}
+	switch strings.ToLower(fields[0]) {
+	case "$includeconfig":
+		p.include(fields[1], s.file, line, false)
+	case "$actionommysqlserverport":
+		n, err := strconv.Atoi(fields[1])
+		if err != nil || n < 1 || n > 65535 {
+			p.errorf(s.file, line, "$ActionOmmysqlServerPort: invalid port %q", fields[1])
+			return
+		}
+		p.legacyPort = n
 	}
+}
 
-	// Parse configuration
-	// Pattern: action(type="ommysql" server="host" db="dbname" uid="user" pwd="password")
-	pattern := `action\(type="ommysql"\s+server="([^"]+)"\s+db="([^"]+)"\s+uid="([^"]+)"\s+pwd="([^"]+)"\)`
-	re := regexp.MustCompile(pattern)
-	matches := re.FindStringSubmatch(string(content))
+// legacyAction records ":ommysql:host,db,user,password;template".
+func (p *rsyslogParser) legacyAction(s *rsyslogScanner, value string) {
+	value, _, _ = strings.Cut(value, ";")
+	parts := strings.SplitN(value, ",", 4)
+	if len(parts) < 3 {
+		p.errorf(s.file, s.line, "ommysql: expected host,database,user,password")
+		return
+	}
+	db := RsyslogDatabase{
+		Host: parts[0],
+		Name: parts[1],
+		User: parts[2],
+		Port: p.legacyPort,
+		File: s.file,
+		Line: s.line,
+	}
+	if len(parts) == 4 {
+		db.Password = parts[3]
+	}
+	p.add(db)
+}
 
-	if len(matches) != 5 {
-		return "", "", "", "", fmt.Errorf("failed to parse MySQL connection parameters from rsyslog config")
+func (p *rsyslogParser) add(db RsyslogDatabase) {
+	var missing []string
+	for _, f := range []struct{ name, value string }{{"server", db.Host}, {"db", db.Name}, {"uid", db.User}} {
+		if f.value == "" {
+			missing = append(missing, f.name)
+		}
+	}
+	if len(missing) > 0 {
+		p.errorf(db.File, db.Line, "ommysql action without %s", strings.Join(missing, ", "))
+		return
 	}
+	p.actions = append(p.actions, db)
+}
+
+// rsyslogScanner reads an rsyslog configuration file, tracking the line.
+type rsyslogScanner struct {
+	src  []byte
+	pos  int
+	file string
+	line int
+}
 
-	dbHost := matches[1]
-	dbName := matches[2]
-	dbUser := matches[3]
-	dbPass := matches[4]
+func (s *rsyslogScanner) peek(n int) byte {
+	if s.pos+n < len(s.src) {
+		return s.src[s.pos+n]
+	}
+	return 0
+}
 
-	return dbUser, dbPass, dbName, dbHost, nil
+func (s *rsyslogScanner) hasPrefix(prefix string) bool {
+	return strings.HasPrefix(string(s.src[s.pos:min(len(s.src), s.pos+len(prefix))]), prefix)
+}
+
+// atLineStart reports whether only blanks precede pos on its line.
+func (s *rsyslogScanner) atLineStart() bool {
+	for i := s.pos - 1; i >= 0; i-- {
+		switch s.src[i] {
+		case '\n':
+			return true
+		case ' ', '\t', '\r':
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// restOfLine returns the input from pos to the end of the line.
+func (s *rsyslogScanner) restOfLine() []byte {
+	end := s.pos
+	for end < len(s.src) && s.src[end] != '\n' {
+		end++
+	}
+	return s.src[s.pos:end]
+}
+
+// skipLine moves pos to the newline ending the current line.
+func (s *rsyslogScanner) skipLine() {
+	s.pos += len(s.restOfLine())
+}
+
+func (s *rsyslogScanner) skipBlockComment() error {
+	line := s.line
+	end := strings.Index(string(s.src[s.pos+2:]), "*/")
+	if end < 0 {
+		s.line += strings.Count(string(s.src[s.pos:]), "\n")
+		s.pos = len(s.src)
+		return &RsyslogParseError{File: s.file, Line: line, Msg: "unterminated comment"}
+	}
+	end += s.pos + 4
+	s.line += strings.Count(string(s.src[s.pos:end]), "\n")
+	s.pos = end
+	return nil
+}
+
+// skipSpace skips blanks, newlines and comments.
+func (s *rsyslogScanner) skipSpace() error {
+	for s.pos < len(s.src) {
+		switch c := s.src[s.pos]; {
+		case c == '\n':
+			s.line++
+			s.pos++
+		case c == ' ' || c == '\t' || c == '\r':
+			s.pos++
+		case c == '#':
+			s.skipLine()
+		case c == '/' && s.peek(1) == '*':
+			if err := s.skipBlockComment(); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdent(c byte) bool {
+	return isIdentStart(c) || c == '.' || c == '-' || (c >= '0' && c <= '9')
+}
+
+func (s *rsyslogScanner) readIdent() string {
+	start := s.pos
+	for s.pos < len(s.src) && isIdent(s.src[s.pos]) {
+		s.pos++
+	}
+	return string(s.src[start:s.pos])
+}
+
+// readString reads a quoted string starting at pos. Backslash escapes are
+// resolved in double-quoted strings.
+func (s *rsyslogScanner) readString() (string, error) {
+	quote := s.src[s.pos]
+	line := s.line
+	s.pos++
+	var b strings.Builder
+	for s.pos < len(s.src) {
+		c := s.src[s.pos]
+		s.pos++
+		switch {
+		case c == quote:
+			return b.String(), nil
+		case c == '\\' && quote == '"' && s.pos < len(s.src):
+			e := s.src[s.pos]
+			s.pos++
+			switch e {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			default:
+				if e == '\n' {
+					s.line++
+				}
+				b.WriteByte(e)
+			}
+		default:
+			if c == '\n' {
+				s.line++
+			}
+			b.WriteByte(c)
+		}
+	}
+	return "", &RsyslogParseError{File: s.file, Line: line, Msg: "unterminated string"}
+}
+
+// readParams reads the parameter list of an object such as action(...),
+// starting at the opening parenthesis. Names are returned in lower case;
+// arrays keep their first element.
+func (s *rsyslogScanner) readParams() (map[string]string, error) {
+	line := s.line
+	s.pos++ // (
+	params := make(map[string]string)
+	for {
+		if err := s.skipSpace(); err != nil {
+			return nil, err
+		}
+		if s.pos >= len(s.src) {
+			return nil, &RsyslogParseError{File: s.file, Line: line, Msg: "missing ) after parameters"}
+		}
+		if s.src[s.pos] == ')' {
+			s.pos++
+			return params, nil
+		}
+		if !isIdentStart(s.src[s.pos]) {
+			return nil, &RsyslogParseError{File: s.file, Line: s.line, Msg: fmt.Sprintf("unexpected %q in parameter list", s.src[s.pos])}
+		}
+		name := strings.ToLower(s.readIdent())
+		if err := s.skipSpace(); err != nil {
+			return nil, err
+		}
+		if s.pos >= len(s.src) || s.src[s.pos] != '=' {
+			return nil, &RsyslogParseError{File: s.file, Line: s.line, Msg: fmt.Sprintf("missing = after parameter %s", name)}
+		}
+		s.pos++
+		if err := s.skipSpace(); err != nil {
+			return nil, err
+		}
+		value, err := s.readValue()
+		if err != nil {
+			return nil, err
+		}
+		params[name] = value
+	}
+}
+
+// readValue reads a parameter value: a string, an array of strings or a
+// bare word such as a number.
+func (s *rsyslogScanner) readValue() (string, error) {
+	if s.pos >= len(s.src) {
+		return "", &RsyslogParseError{File: s.file, Line: s.line, Msg: "missing parameter value"}
+	}
+	switch c := s.src[s.pos]; {
+	case c == '"' || c == '\'' || c == '`':
+		return s.readString()
+	case c == '[':
+		line := s.line
+		s.pos++
+		var first string
+		for n := 0; ; n++ {
+			if err := s.skipSpace(); err != nil {
+				return "", err
+			}
+			if s.pos >= len(s.src) {
+				return "", &RsyslogParseError{File: s.file, Line: line, Msg: "missing ] after array"}
+			}
+			switch s.src[s.pos] {
+			case ']':
+				s.pos++
+				return first, nil
+			case ',':
+				s.pos++
+				continue
+			}
+			v, err := s.readValue()
+			if err != nil {
+				return "", err
+			}
+			if n == 0 {
+				first = v
+			}
+		}
+	default:
+		start := s.pos
+		for s.pos < len(s.src) && !strings.ContainsRune(" \t\r\n)]#,", rune(s.src[s.pos])) {
+			s.pos++
+		}
+		if s.pos == start {
+			return "", &RsyslogParseError{File: s.file, Line: s.line, Msg: fmt.Sprintf("unexpected %q as parameter value", c)}
+		}
+		return string(s.src[start:s.pos]), nil
+	}
+}
+
+// readLegacyValue reads the parameters of a legacy action up to the end
+// of the line or a comment.
+func (s *rsyslogScanner) readLegacyValue() string {
+	rest := string(s.restOfLine())
+	if i := strings.Index(rest, " #"); i >= 0 {
+		rest = rest[:i]
+	}
+	s.skipLine()
+	return strings.TrimSpace(rest)
 }
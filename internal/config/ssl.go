@@ -8,7 +8,7 @@ import (
 	"crypto/x509/pkix"
 	"encoding/pem"
 	"fmt"
-	"log"
+	"log/slog"
 	"math/big"
 	"net"
 	"os"
@@ -38,7 +38,7 @@ func EnsureSSLCerts(cfg *ServerConfig) error {
 		return nil
 	}
 
-	log.Printf("SSL: certificate or key not found — generating self-signed cert (%s)", certPath)
+	slog.Info("SSL: certificate or key not found, generating a self-signed certificate", "path", certPath)
 
 	if err := os.MkdirAll(filepath.Dir(certPath), 0755); err != nil {
 		return fmt.Errorf("ssl: failed to create cert directory: %w", err)
@@ -101,8 +101,7 @@ func EnsureSSLCerts(cfg *ServerConfig) error {
 	}
 	keyFile.Close()
 
-	log.Printf("✓ SSL: self-signed certificate generated (valid until %s)",
-		now.Add(10*365*24*time.Hour).Format("2006-01-02"))
+	slog.Info("SSL: self-signed certificate generated", "valid_until", now.Add(10*365*24*time.Hour).Format("2006-01-02"))
 	return nil
 }
 
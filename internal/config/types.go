@@ -1,17 +1,28 @@
 package config
 
-import "time"
+import (
+	"strings"
+	"time"
+)
 
 // Config is the root configuration structure, mapped 1:1 to config.toml.
 type Config struct {
-	Server   ServerConfig   `toml:"server"`
-	Database DatabaseConfig `toml:"database"`
-	Auth     AuthConfig     `toml:"auth"`
-	Cleanup  CleanupConfig  `toml:"cleanup"`
+	Server    ServerConfig    `toml:"server"`
+	Database  DatabaseConfig  `toml:"database"`
+	Auth      AuthConfig      `toml:"auth"`
+	Cleanup   CleanupConfig   `toml:"cleanup"`
+	Audit     AuditConfig     `toml:"audit"`
+	RateLimit RateLimitConfig `toml:"rate_limit"`
+	Logging   LoggingConfig   `toml:"logging"`
 
 	// Runtime-only fields (not persisted to TOML)
 	InstallPath string `toml:"-"`
 	ConfigPath  string `toml:"-"`
+
+	// Settings overridden by RSYSLOX_* environment variables, and their
+	// values in config.toml for Save.
+	envOverrides []envField
+	fileValues   *Config
 }
 
 // ServerConfig holds HTTP server settings.
@@ -23,6 +34,40 @@ type ServerConfig struct {
 	SSLKeyFile     string   `toml:"ssl_key"`
 	AllowedOrigins []string `toml:"allowed_origins"`
 
+	// Reverse proxies whose X-Forwarded-For and X-Forwarded-Proto headers
+	// are trusted when determining the client IP and scheme. Single IPs or
+	// CIDR ranges.
+	TrustedProxies []string `toml:"trusted_proxies"`
+
+	// Sockets to serve on, overriding Host/Port; see ParseListen for the
+	// syntax. When empty and systemd passes sockets (LISTEN_FDS), those are
+	// used instead of Host/Port.
+	Listen     ListenList `toml:"listen"`
+	SocketMode string     `toml:"socket_mode"` // permissions of unix: sockets, e.g. "0660"
+
+	// URL path prefix all routes are served under, e.g. "/syslog" when a
+	// reverse proxy publishes rsyslox at https://host/syslog/. Empty = root.
+	BasePath string `toml:"base_path"`
+
+	// HTTP timeouts; 0 disables. WriteTimeout bounds a whole request and must
+	// leave room for the slowest query. On SIGTERM/SIGINT or restart the
+	// server waits up to ShutdownTimeout for in-flight requests.
+	ReadTimeout     time.Duration `toml:"read_timeout"`
+	WriteTimeout    time.Duration `toml:"write_timeout"`
+	IdleTimeout     time.Duration `toml:"idle_timeout"`
+	ShutdownTimeout time.Duration `toml:"shutdown_timeout"`
+
+	// Reload config.toml automatically when it changes on disk.
+	// SIGHUP and POST /api/admin/config/reload work regardless.
+	WatchConfig bool `toml:"watch_config"`
+
+	// Number of saved versions of config.toml kept in history/ next to it
+	// for diffs and rollbacks; 0 disables the history.
+	ConfigHistory int `toml:"config_history"`
+
+	// Automatic certificates from an ACME CA such as Let's Encrypt.
+	ACME ACMEConfig `toml:"acme"`
+
 	// Server-side defaults — applied to new browser sessions that have not
 	// yet stored their own preferences in localStorage.
 	AutoRefreshInterval int    `toml:"auto_refresh_interval"` // seconds
@@ -32,6 +77,31 @@ type ServerConfig struct {
 	DefaultTimeFormat   string `toml:"default_time_format"`   // "24h" | "12h"
 }
 
+// Prefix returns BasePath normalised for prefixing paths: empty for the
+// root, otherwise with a leading and without a trailing slash.
+func (s ServerConfig) Prefix() string {
+	p := strings.Trim(s.BasePath, "/")
+	if p == "" {
+		return ""
+	}
+	return "/" + p
+}
+
+// ACMEConfig enables automatic certificates via ACME (RFC 8555). Requires
+// use_ssl. Certificates for Domains are requested on startup and renewed
+// RenewBefore their expiry; the self-signed or uploaded certificate is still
+// served to clients that connect by IP address or another name.
+type ACMEConfig struct {
+	Enabled      bool          `toml:"enabled"`
+	DirectoryURL string        `toml:"directory_url"`
+	Domains      []string      `toml:"domains"`
+	Email        string        `toml:"email"`        // contact for expiry notices
+	CacheDir     string        `toml:"cache_dir"`    // account key and certificates
+	HTTPPort     int           `toml:"http_port"`    // HTTP-01 challenges; 0 = TLS-ALPN-01 only
+	RenewBefore  time.Duration `toml:"renew_before"` // e.g. 720h
+	CAFile       string        `toml:"ca_file"`      // extra trust for the directory, e.g. Pebble
+}
+
 // DatabaseConfig holds database connection settings.
 // Password is stored AES-GCM encrypted with prefix "enc:".
 type DatabaseConfig struct {
@@ -40,19 +110,143 @@ type DatabaseConfig struct {
 	Name     string `toml:"name"`
 	User     string `toml:"user"`
 	Password string `toml:"password"` // may be "enc:<base64>" or plaintext during setup
+
+	// Time limits for the queries behind each API endpoint; 0 disables.
+	QueryTimeouts QueryTimeouts `toml:"query_timeouts"`
+
+	// The db_total shown next to filtered results is cached and refreshed
+	// in the background every TotalRefresh — with COUNT(*) when ExactDBTotal
+	// is set, otherwise from the table statistics.
+	TotalRefresh time.Duration `toml:"total_refresh"`
+	ExactDBTotal bool          `toml:"exact_db_total"`
+}
+
+// QueryTimeouts limits how long the database may work on one request.
+// The limit is enforced on the server too (MAX_EXECUTION_TIME on MySQL,
+// max_statement_time on MariaDB), so abandoned queries do not keep running.
+type QueryTimeouts struct {
+	Logs time.Duration `toml:"logs"` // /api/logs
+	Meta time.Duration `toml:"meta"` // /api/meta and /api/meta/{column}
 }
 
 // ReadOnlyKey is a named API key for read-only access.
 // The actual key is stored as a SHA-256 hex hash.
+//
+// After a rotation the previous secret keeps working until
+// PreviousExpiresAt so clients can be switched over without downtime.
+// Last-used times are kept separately (see AuthConfig.KeyUsageFile) so
+// that API requests never rewrite config.toml.
 type ReadOnlyKey struct {
-	Name    string `toml:"name"`
-	KeyHash string `toml:"key_hash"` // sha256 hex
+	Name      string    `toml:"name"`
+	KeyHash   string    `toml:"key_hash"` // sha256 hex
+	CreatedAt time.Time `toml:"created_at,omitempty"`
+	CreatedBy string    `toml:"created_by,omitempty"`
+	ExpiresAt time.Time `toml:"expires_at,omitempty"` // zero = never
+
+	PreviousKeyHash   string    `toml:"previous_key_hash,omitempty"`
+	PreviousExpiresAt time.Time `toml:"previous_expires_at,omitempty"`
+
+	// Requests per minute for this key; 0 uses rate_limit.requests_per_minute.
+	RateLimit int `toml:"rate_limit,omitempty"`
 }
 
 // AuthConfig holds authentication settings.
 type AuthConfig struct {
 	AdminPasswordHash string        `toml:"admin_password_hash"` // bcrypt
 	ReadOnlyKeys      []ReadOnlyKey `toml:"read_only_keys"`
+	KeyUsageFile      string        `toml:"key_usage_file"` // last-used time and IP per key
+	LDAP              LDAPConfig    `toml:"ldap"`
+	Lockout           LockoutConfig `toml:"lockout"`
+	Sessions          SessionConfig `toml:"sessions"`
+	MTLS              MTLSConfig    `toml:"mtls"`
+
+	// Optional TOTP second factor for the local admin account.
+	// Enabled when TOTPSecret is set.
+	TOTPSecret        string   `toml:"totp_secret"`         // "enc:<base64>"
+	TOTPRecoveryCodes []string `toml:"totp_recovery_codes"` // sha256 hex, removed once used
+}
+
+// LDAPConfig holds the optional LDAP / Active Directory login backend.
+// BindPassword is stored AES-GCM encrypted with prefix "enc:".
+type LDAPConfig struct {
+	Enabled            bool          `toml:"enabled"`
+	URL                string        `toml:"url"`                  // ldap://host:389 or ldaps://host:636
+	StartTLS           bool          `toml:"start_tls"`            // upgrade ldap:// connections via StartTLS
+	InsecureSkipVerify bool          `toml:"insecure_skip_verify"` // testing only
+	CAFile             string        `toml:"ca_file"`              // PEM bundle; system roots when empty
+	Timeout            time.Duration `toml:"timeout"`
+
+	// Service account used to search for the user entry.
+	BindDN       string `toml:"bind_dn"`
+	BindPassword string `toml:"bind_password"` // may be "enc:<base64>"
+
+	// User lookup. %s in UserFilter is replaced by the escaped login name.
+	UserBaseDN string `toml:"user_base_dn"`
+	UserFilter string `toml:"user_filter"` // e.g. "(sAMAccountName=%s)"
+
+	// Group membership is read from GroupAttribute on the user entry
+	// (memberOf on AD). When GroupBaseDN is set, groups are searched instead;
+	// {dn} and {username} in GroupFilter are replaced with escaped values.
+	GroupAttribute string `toml:"group_attribute"`
+	GroupBaseDN    string `toml:"group_base_dn"`
+	GroupFilter    string `toml:"group_filter"` // e.g. "(member={dn})"
+
+	// Group DNs mapped to roles. Users in neither list are rejected.
+	AdminGroups    []string `toml:"admin_groups"`
+	ReadOnlyGroups []string `toml:"read_only_groups"`
+
+	// LocalFallback also accepts the local admin account when LDAP
+	// rejects the login or is unreachable.
+	LocalFallback bool `toml:"local_fallback"`
+}
+
+// LockoutConfig controls brute-force protection on the admin login.
+//
+// After MaxAttempts failures from one IP within Window, that IP is locked
+// out for BaseLockout; every further failure doubles the lockout up to
+// MaxLockout. When GlobalMaxAttempts failures from all IPs together occur
+// within Window, every login is paused for GlobalLockout.
+type LockoutConfig struct {
+	MaxAttempts       int           `toml:"max_attempts"`
+	BaseLockout       time.Duration `toml:"base_lockout"`
+	MaxLockout        time.Duration `toml:"max_lockout"`
+	Window            time.Duration `toml:"window"`
+	GlobalMaxAttempts int           `toml:"global_max_attempts"` // 0 disables the global limit
+	GlobalLockout     time.Duration `toml:"global_lockout"`
+}
+
+// SessionConfig controls admin UI sessions.
+// Sessions always end 8 hours after login (or after the last request when
+// Sliding is set); IdleTimeout additionally ends sessions that are unused.
+// MaxLifetime bounds a session from login however often it is renewed.
+type SessionConfig struct {
+	Store       string        `toml:"store"`        // "memory" | "file"
+	File        string        `toml:"file"`         // used by the "file" store; token hashes only
+	IdleTimeout time.Duration `toml:"idle_timeout"` // 0 disables
+	Sliding     bool          `toml:"sliding"`      // every request renews the 8 hour lifetime
+	MaxLifetime time.Duration `toml:"max_lifetime"` // from login, not extended by Sliding; 0 disables
+}
+
+// MTLSConfig enables client certificate authentication on the TLS
+// listener (requires server.use_ssl). Certificates issued by ClientCA are
+// verified during the handshake; Mappings decide what a verified
+// certificate may do. Certificates without a matching mapping get no access.
+type MTLSConfig struct {
+	Enabled  bool          `toml:"enabled"`
+	ClientCA string        `toml:"client_ca"` // PEM bundle of the issuing CAs
+	Required bool          `toml:"required"`  // reject TLS connections without a valid client certificate
+	Mappings []CertMapping `toml:"mappings"`
+}
+
+// CertMapping grants a client certificate either a role or the rights of
+// a read-only key. It matches certificates with the given subject DN
+// and/or subject alternative name; the first matching mapping is used.
+type CertMapping struct {
+	Name    string `toml:"name"`
+	Subject string `toml:"subject,omitempty"` // e.g. "CN=backup01,O=Example Corp"
+	SAN     string `toml:"san,omitempty"`     // DNS name, email address, URI or IP
+	Role    string `toml:"role,omitempty"`    // "readonly" | "admin"
+	Key     string `toml:"key,omitempty"`     // name of a read-only key
 }
 
 // CleanupConfig holds the log cleanup / housekeeping settings.
@@ -64,6 +258,45 @@ type CleanupConfig struct {
 	Interval         time.Duration `toml:"interval"`
 }
 
+// AuditConfig controls the audit trail of admin actions.
+// Entries are appended to File as JSON lines and can additionally be sent
+// to syslog — to the local daemon when SyslogAddress is empty.
+type AuditConfig struct {
+	Enabled       bool   `toml:"enabled"`
+	File          string `toml:"file"`
+	Syslog        bool   `toml:"syslog"`
+	SyslogNetwork string `toml:"syslog_network"` // "udp" | "tcp"; ignored for the local daemon
+	SyslogAddress string `toml:"syslog_address"` // e.g. "logs.example.com:514"
+	SyslogTag     string `toml:"syslog_tag"`
+}
+
+// RateLimitConfig protects the database from expensive or excessive
+// /api/logs and /api/meta requests.
+//
+// Every API key and admin session has a token bucket refilled at
+// RequestsPerMinute with room for Burst requests; every client IP has a
+// second bucket shared by all its credentials. Independently, each query
+// gets a cost estimate (roughly: days in the date range, multiplied for
+// Message searches and divided for host/tag filters). Queries above
+// MaxQueryCost are rejected; queries above HeavyQueryCost wait for one of
+// HeavyQuerySlots slots for at most HeavyQueryWait.
+type RateLimitConfig struct {
+	Enabled             bool          `toml:"enabled"`
+	RequestsPerMinute   int           `toml:"requests_per_minute"`    // per API key or admin session
+	IPRequestsPerMinute int           `toml:"ip_requests_per_minute"` // per client IP; 0 disables
+	Burst               int           `toml:"burst"`
+	MaxQueryCost        float64       `toml:"max_query_cost"` // 0 disables
+	HeavyQueryCost      float64       `toml:"heavy_query_cost"`
+	HeavyQuerySlots     int           `toml:"heavy_query_slots"` // applied on restart
+	HeavyQueryWait      time.Duration `toml:"heavy_query_wait"`
+}
+
+// LoggingConfig controls rsyslox's own log output on stderr.
+type LoggingConfig struct {
+	Format string `toml:"format"` // "text" | "json"; applied on restart
+	Level  string `toml:"level"`  // "debug" | "info" | "warn" | "error"
+}
+
 // defaults returns a Config pre-filled with sensible defaults.
 func defaults() *Config {
 	return &Config{
@@ -74,19 +307,60 @@ func defaults() *Config {
 			SSLCertFile:         "/etc/rsyslox/certs/cert.pem",
 			SSLKeyFile:          "/etc/rsyslox/certs/key.pem",
 			AllowedOrigins:      []string{"*"},
+			TrustedProxies:      []string{},
+			SocketMode:          "0660",
 			AutoRefreshInterval: 30,
 			DefaultTimeRange:    "24h",
 			DefaultLanguage:     "en",
 			DefaultFontSize:     "medium",
 			DefaultTimeFormat:   "24h",
+			ReadTimeout:         30 * time.Second,
+			WriteTimeout:        120 * time.Second,
+			IdleTimeout:         120 * time.Second,
+			ShutdownTimeout:     30 * time.Second,
+			ConfigHistory:       50,
+			ACME: ACMEConfig{
+				DirectoryURL: "https://acme-v02.api.letsencrypt.org/directory",
+				Domains:      []string{},
+				CacheDir:     "/etc/rsyslox/certs/acme",
+				HTTPPort:     80,
+				RenewBefore:  30 * 24 * time.Hour,
+			},
 		},
 		Database: DatabaseConfig{
 			Host: "localhost",
 			Port: 3306,
 			Name: "Syslog",
+			QueryTimeouts: QueryTimeouts{
+				Logs: 30 * time.Second,
+				Meta: 10 * time.Second,
+			},
+			TotalRefresh: time.Minute,
+			ExactDBTotal: true,
 		},
 		Auth: AuthConfig{
 			ReadOnlyKeys: []ReadOnlyKey{},
+			KeyUsageFile: "/etc/rsyslox/key_usage.json",
+			LDAP: LDAPConfig{
+				Timeout:        10 * time.Second,
+				UserFilter:     "(uid=%s)",
+				GroupAttribute: "memberOf",
+				GroupFilter:    "(member={dn})",
+				LocalFallback:  true,
+			},
+			Lockout: LockoutConfig{
+				MaxAttempts:       5,
+				BaseLockout:       30 * time.Second,
+				MaxLockout:        time.Hour,
+				Window:            15 * time.Minute,
+				GlobalMaxAttempts: 100,
+				GlobalLockout:     5 * time.Minute,
+			},
+			Sessions: SessionConfig{
+				Store:       "memory",
+				File:        "/etc/rsyslox/sessions.json",
+				MaxLifetime: 24 * time.Hour,
+			},
 		},
 		Cleanup: CleanupConfig{
 			Enabled:          false,
@@ -95,5 +369,24 @@ func defaults() *Config {
 			BatchSize:        1000,
 			Interval:         15 * time.Minute,
 		},
+		Audit: AuditConfig{
+			Enabled:   true,
+			File:      "/etc/rsyslox/audit.log",
+			SyslogTag: "rsyslox-audit",
+		},
+		RateLimit: RateLimitConfig{
+			Enabled:             true,
+			RequestsPerMinute:   300,
+			IPRequestsPerMinute: 1200,
+			Burst:               60,
+			MaxQueryCost:        500,
+			HeavyQueryCost:      100,
+			HeavyQuerySlots:     2,
+			HeavyQueryWait:      15 * time.Second,
+		},
+		Logging: LoggingConfig{
+			Format: "text",
+			Level:  "info",
+		},
 	}
 }
@@ -44,6 +44,14 @@ func (c *MetaCache) Set(key string, value interface{}) {
 	c.entries[key] = cacheEntry{value: value, expiresAt: time.Now().Add(metaCacheTTL)}
 }
 
+// Len returns the number of cached entries, including expired ones not
+// yet evicted.
+func (c *MetaCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
 // CacheKey generates a deterministic cache key from column, WHERE clause, and args.
 func CacheKey(column, whereClause string, args []interface{}) string {
 	return fmt.Sprintf("%s|%s|%v", column, whereClause, args)
@@ -0,0 +1,309 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/phil-bot/rsyslox/internal/config"
+)
+
+// CheckStatus is the outcome of one item of a Report.
+type CheckStatus string
+
+const (
+	CheckOK      CheckStatus = "ok"
+	CheckWarning CheckStatus = "warning" // works, with limitations
+	CheckFailed  CheckStatus = "failed"  // rsyslox cannot run with these settings
+	CheckSkipped CheckStatus = "skipped" // an earlier check failed
+)
+
+// Check IDs, in the order of Report.Checks.
+const (
+	CheckConnection      = "connection"
+	CheckTable           = "table"
+	CheckColumns         = "columns"
+	CheckRows            = "rows"
+	CheckPriorityMode    = "priority_mode"
+	CheckPrivilegeSelect = "privilege_select"
+	CheckPrivilegeDelete = "privilege_delete"
+	CheckPrivilegeIndex  = "privilege_index"
+)
+
+// Check is one item of the checklist.
+type Check struct {
+	ID      string      `json:"id"`
+	Status  CheckStatus `json:"status"`
+	Message string      `json:"message"`
+}
+
+// Report is the checklist produced by Diagnose.
+type Report struct {
+	OK             bool     `json:"ok"`                        // no check failed
+	Server         string   `json:"server,omitempty"`          // SELECT VERSION()
+	PriorityMode   string   `json:"priority_mode,omitempty"`   // see PriorityMode
+	Rows           *int64   `json:"rows,omitempty"`            // approximate, from the table statistics
+	MissingColumns []string `json:"missing_columns,omitempty"` // columns rsyslox reads that SystemEvents lacks
+	Checks         []Check  `json:"checks"`
+}
+
+// Err returns the first failed check as an error, or nil.
+func (r *Report) Err() error {
+	for _, c := range r.Checks {
+		if c.Status == CheckFailed {
+			return errors.New(c.Message)
+		}
+	}
+	return nil
+}
+
+func (r *Report) add(id string, status CheckStatus, format string, args ...interface{}) {
+	r.Checks = append(r.Checks, Check{ID: id, Status: status, Message: fmt.Sprintf(format, args...)})
+	if status == CheckFailed {
+		r.OK = false
+	}
+}
+
+// skip marks the given checks as skipped because of an earlier failure.
+func (r *Report) skip(ids ...string) {
+	for _, id := range ids {
+		r.add(id, CheckSkipped, "Skipped")
+	}
+}
+
+// Diagnose checks the database settings of cfg without touching the
+// running connection pool: it opens a temporary connection, pings the
+// server, checks that SystemEvents exists and has the columns rsyslox
+// reads, detects the priority mode and reports the row count and the
+// privileges of the database user. Bound the run time with ctx.
+func Diagnose(ctx context.Context, cfg *config.Config) *Report {
+	r := &Report{OK: true}
+	all := []string{CheckTable, CheckColumns, CheckRows, CheckPriorityMode,
+		CheckPrivilegeSelect, CheckPrivilegeDelete, CheckPrivilegeIndex}
+
+	dsn, err := cfg.DSN()
+	if err != nil {
+		r.add(CheckConnection, CheckFailed, "Failed to build DSN: %v", err)
+		r.skip(all...)
+		return r
+	}
+	sqlDB, err := sql.Open("mysql", dsn)
+	if err != nil {
+		r.add(CheckConnection, CheckFailed, "Failed to open database: %v", err)
+		r.skip(all...)
+		return r
+	}
+	defer sqlDB.Close()
+
+	if err := sqlDB.PingContext(ctx); err != nil {
+		r.add(CheckConnection, CheckFailed, "Failed to connect to %s: %v", cfg.Database.Host, err)
+		r.skip(all...)
+		return r
+	}
+	if err := sqlDB.QueryRowContext(ctx, "SELECT VERSION()").Scan(&r.Server); err != nil {
+		r.add(CheckConnection, CheckOK, "Connected")
+	} else {
+		r.add(CheckConnection, CheckOK, "Connected to %s", r.Server)
+	}
+	p := &Pool{DB: sqlDB, MariaDB: strings.Contains(strings.ToLower(r.Server), "mariadb")}
+
+	// The table statistics tell whether the table exists without reading
+	// it; the read below then shows whether SELECT is granted.
+	var rows sql.NullInt64
+	err = sqlDB.QueryRowContext(ctx,
+		"SELECT TABLE_ROWS FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'SystemEvents'",
+	).Scan(&rows)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		r.add(CheckTable, CheckFailed, "Table SystemEvents not found in database %s (or the user has no access to it); is rsyslog writing to this database?", cfg.Database.Name)
+		r.skip(all[1:]...)
+		return r
+	case err != nil:
+		r.add(CheckTable, CheckFailed, "Failed to look up table SystemEvents: %v", err)
+		r.skip(all[1:]...)
+		return r
+	}
+	r.add(CheckTable, CheckOK, "Table SystemEvents exists")
+
+	columnsOK := r.checkColumns(ctx, p)
+
+	var one int
+	readErr := sqlDB.QueryRowContext(ctx, "SELECT 1 FROM SystemEvents LIMIT 1").Scan(&one)
+	empty := errors.Is(readErr, sql.ErrNoRows)
+	if empty {
+		readErr = nil
+	}
+	switch {
+	case readErr != nil:
+		r.add(CheckRows, CheckSkipped, "Skipped")
+	case empty:
+		n := int64(0)
+		r.Rows = &n
+		r.add(CheckRows, CheckWarning, "SystemEvents is empty; rsyslog may not be writing to it yet")
+	default:
+		n := rows.Int64
+		r.Rows = &n
+		r.add(CheckRows, CheckOK, "About %d rows", n)
+	}
+
+	switch {
+	case readErr != nil || !columnsOK:
+		r.add(CheckPriorityMode, CheckSkipped, "Skipped")
+	default:
+		mode, _, _, ok := p.samplePriorityMode(ctx)
+		r.PriorityMode = mode.String()
+		if ok {
+			r.add(CheckPriorityMode, CheckOK, "Priority mode: %s", mode)
+		} else {
+			r.add(CheckPriorityMode, CheckWarning, "No non-kernel entries to detect the priority mode from; %s is assumed", mode)
+		}
+	}
+
+	r.checkPrivileges(ctx, p, readErr)
+	return r
+}
+
+// checkColumns compares the columns of SystemEvents with logColumns.
+func (r *Report) checkColumns(ctx context.Context, p *Pool) bool {
+	rows, err := p.QueryContext(ctx, "SHOW COLUMNS FROM SystemEvents")
+	if err != nil {
+		r.add(CheckColumns, CheckFailed, "Failed to read the columns of SystemEvents: %v", err)
+		return false
+	}
+	defer rows.Close()
+	present := make(map[string]bool)
+	for rows.Next() {
+		var field, colType, null, key, def, extra sql.NullString
+		if err := rows.Scan(&field, &colType, &null, &key, &def, &extra); err == nil && field.Valid {
+			present[field.String] = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		r.add(CheckColumns, CheckFailed, "Failed to read the columns of SystemEvents: %v", err)
+		return false
+	}
+	for _, col := range logColumns {
+		if !present[col] {
+			r.MissingColumns = append(r.MissingColumns, col)
+		}
+	}
+	if len(r.MissingColumns) > 0 {
+		r.add(CheckColumns, CheckFailed, "SystemEvents lacks columns rsyslox reads: %s; is this the rsyslog MySQL schema?",
+			strings.Join(r.MissingColumns, ", "))
+		return false
+	}
+	r.add(CheckColumns, CheckOK, "All %d columns present", len(logColumns))
+	return true
+}
+
+// checkPrivileges reports SELECT from the read of SystemEvents (readErr),
+// and DELETE (cleanup) and INDEX (index creation at startup) from the
+// grants of the user.
+func (r *Report) checkPrivileges(ctx context.Context, p *Pool, readErr error) {
+	if readErr != nil {
+		r.add(CheckPrivilegeSelect, CheckFailed, "Cannot read SystemEvents: %v", readErr)
+	} else {
+		r.add(CheckPrivilegeSelect, CheckOK, "SELECT granted")
+	}
+
+	var dbName string
+	p.QueryRowContext(ctx, "SELECT DATABASE()").Scan(&dbName) //nolint:errcheck // empty on error
+	granted, roles, err := grants(ctx, p, dbName)
+	unknown := ""
+	switch {
+	case err != nil:
+		unknown = fmt.Sprintf("could not read the grants: %v", err)
+	case roles:
+		unknown = "it may be granted through a role"
+	}
+
+	if granted["DELETE"] {
+		r.add(CheckPrivilegeDelete, CheckOK, "DELETE granted")
+	} else if unknown != "" {
+		r.add(CheckPrivilegeDelete, CheckWarning, "DELETE not found in the grants (%s); the disk cleanup needs it", unknown)
+	} else {
+		r.add(CheckPrivilegeDelete, CheckWarning, "DELETE not granted; the disk cleanup cannot remove old entries")
+	}
+
+	if granted["INDEX"] {
+		r.add(CheckPrivilegeIndex, CheckOK, "INDEX granted")
+		return
+	}
+	missing := 0
+	if status, err := p.IndexStatus(ctx); err == nil {
+		for _, s := range status {
+			if !s.Present {
+				missing++
+			}
+		}
+		if missing == 0 {
+			r.add(CheckPrivilegeIndex, CheckOK, "INDEX not granted, but all indexes exist")
+			return
+		}
+	}
+	if unknown != "" {
+		r.add(CheckPrivilegeIndex, CheckWarning, "INDEX not found in the grants (%s); it is needed to create missing indexes at startup", unknown)
+	} else {
+		r.add(CheckPrivilegeIndex, CheckWarning, "INDEX not granted; indexes missing at startup cannot be created, which slows down queries")
+	}
+}
+
+// grantLine matches "GRANT <privileges> ON <db>.<table> TO ...".
+var grantLine = regexp.MustCompile(`^GRANT (.+?) ON (\S+) TO `)
+
+// grants returns the privileges of the current user that apply to
+// SystemEvents in dbName. roles reports grants of roles, whose privileges
+// SHOW GRANTS does not list.
+func grants(ctx context.Context, p *Pool, dbName string) (granted map[string]bool, roles bool, err error) {
+	rows, err := p.QueryContext(ctx, "SHOW GRANTS FOR CURRENT_USER()")
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+	granted = make(map[string]bool)
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return nil, false, err
+		}
+		m := grantLine.FindStringSubmatch(line)
+		if m == nil {
+			if strings.HasPrefix(line, "GRANT ") {
+				roles = true
+			}
+			continue
+		}
+		if !grantScope(m[2], dbName) {
+			continue
+		}
+		for _, p := range strings.Split(m[1], ",") {
+			p = strings.ToUpper(strings.TrimSpace(p))
+			if strings.Contains(p, "(") {
+				continue // column privilege
+			}
+			if p == "ALL" || p == "ALL PRIVILEGES" {
+				granted["SELECT"], granted["DELETE"], granted["INDEX"] = true, true, true
+			}
+			granted[p] = true
+		}
+	}
+	return granted, roles, rows.Err()
+}
+
+// grantScope reports whether a grant on scope ("*.*", "`db`.*" or
+// "`db`.`table`") covers SystemEvents in dbName.
+func grantScope(scope, dbName string) bool {
+	scope = strings.ReplaceAll(scope, "`", "")
+	db, table, ok := strings.Cut(scope, ".")
+	if !ok {
+		return false
+	}
+	db = strings.NewReplacer(`\_`, "_", `\%`, "%").Replace(db)
+	if db != "*" && !strings.EqualFold(db, dbName) {
+		return false
+	}
+	return table == "*" || table == "SystemEvents"
+}
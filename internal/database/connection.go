@@ -1,25 +1,230 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/phil-bot/rsyslox/internal/config"
 )
 
-// DB wraps the database connection and provides helper methods.
+// DB is the handle to the database that the server holds for its whole
+// lifetime. The connection itself is a Pool, which a reconnect replaces as
+// a whole: callers take the current one with Pool once per request and
+// use it throughout, so they keep a consistent view of the schema even
+// while a reload swaps in a new connection.
 type DB struct {
+	pool atomic.Pointer[Pool] // nil until connected
+
+	// Set up by ConnectInBackground.
+	stop    chan struct{}
+	stopped sync.Once
+	errMu   sync.Mutex
+	lastErr error // of the last connection attempt while not ready
+}
+
+// Pool is one connection pool to the database together with the schema
+// information read through it. It is not changed after it was opened.
+type Pool struct {
 	*sql.DB
 	AvailableColumns []string
 	PriorityMode     PriorityMode
 	MetaCache        *MetaCache
+	MariaDB          bool   // selects the syntax of query time limits
+	Version          string // SELECT VERSION()
+
+	total totalCache
+
+	done    chan struct{} // closed by retire; stops refreshTotalLoop
+	retired sync.Once
 }
 
+// ErrNotReady is returned while a database started with
+// ConnectInBackground has not been reached yet.
+var ErrNotReady = errors.New("database not connected yet")
+
+// Backoff of the connection attempts of ConnectInBackground.
+const (
+	reconnectMinDelay = time.Second
+	reconnectMaxDelay = time.Minute
+)
+
+// retireDelay is how long a replaced pool stays open. Requests that took
+// it just before the swap may still start queries on it; it exceeds the
+// default server.write_timeout, which bounds every request.
+const retireDelay = 3 * time.Minute
+
 // Connect establishes a connection to the database using the TOML-based config.
 func Connect(cfg *config.Config) (*DB, error) {
+	p, err := open(cfg, true)
+	if err != nil {
+		return nil, err
+	}
+	db := &DB{}
+	db.pool.Store(p)
+	if interval := cfg.Database.TotalRefresh; interval > 0 {
+		go p.refreshTotalLoop(interval, cfg.Database.ExactDBTotal)
+	}
+	return db, nil
+}
+
+// ConnectInBackground returns a DB that is not ready and connects it in
+// the background, for a server that starts while the database is down.
+// Attempts are retried with exponential backoff up to reconnectMaxDelay and
+// read the database settings from live each time, so corrected settings
+// are picked up. Once connected the DB is initialized like by Connect and
+// onReady, if set, is called. firstErr is the error of the failed Connect.
+func ConnectInBackground(live *config.Live, firstErr error, onReady func(*DB)) *DB {
+	db := &DB{stop: make(chan struct{}), lastErr: firstErr}
+	go db.connectLoop(live, onReady)
+	return db
+}
+
+func (db *DB) connectLoop(live *config.Live, onReady func(*DB)) {
+	delay := reconnectMinDelay
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-db.stop:
+			return
+		case <-time.After(delay):
+		}
+		// A reload with new database settings may have connected meanwhile.
+		if !db.Ready() {
+			cfg := live.Get()
+			fresh, err := open(cfg, true)
+			if err != nil {
+				db.errMu.Lock()
+				db.lastErr = err
+				db.errMu.Unlock()
+				delay = min(delay*2, reconnectMaxDelay)
+				slog.Warn("Database still unreachable", "attempt", attempt, "next_in", delay.String(), "err", err)
+				continue
+			}
+			db.swap(fresh)
+			if interval := cfg.Database.TotalRefresh; interval > 0 {
+				go fresh.refreshTotalLoop(interval, cfg.Database.ExactDBTotal)
+			}
+		}
+		slog.Info("Database connected, leaving degraded mode")
+		if onReady != nil {
+			onReady(db)
+		}
+		return
+	}
+}
+
+// Pool returns the current connection pool, or nil while the database is
+// not connected. Use the same Pool for all queries of a request.
+func (db *DB) Pool() *Pool {
+	return db.pool.Load()
+}
+
+// Ready reports whether the database has been connected and initialized.
+// Only a DB from ConnectInBackground can be not ready.
+func (db *DB) Ready() bool {
+	return db.Pool() != nil
+}
+
+// LastError returns the error of the last connection attempt while the
+// DB is not ready, and nil once it is.
+func (db *DB) LastError() error {
+	if db.Ready() {
+		return nil
+	}
+	db.errMu.Lock()
+	defer db.errMu.Unlock()
+	return db.lastErr
+}
+
+// Close stops connecting in the background and closes the connection pool.
+func (db *DB) Close() error {
+	if db.stop != nil {
+		db.stopped.Do(func() { close(db.stop) })
+	}
+	p := db.pool.Swap(nil)
+	if p == nil {
+		return nil
+	}
+	return p.retire()
+}
+
+// ConnectReadOnly connects like Connect for a short-lived client such as
+// the CLI: it neither creates indexes nor refreshes the table total in
+// the background, so a database user with SELECT privileges suffices.
+func ConnectReadOnly(cfg *config.Config) (*DB, error) {
+	p, err := open(cfg, false)
+	if err != nil {
+		return nil, err
+	}
+	db := &DB{}
+	db.pool.Store(p)
+	return db, nil
+}
+
+// OpenPool opens a new connection pool for the database settings in cfg
+// without using it yet, so a caller can check that the settings work
+// before committing to them. Hand it to Use, or Discard it.
+func OpenPool(cfg *config.Config) (*Pool, error) {
+	return open(cfg, true)
+}
+
+// Use makes fresh, opened by OpenPool for cfg, the current pool. The old
+// pool is closed after retireDelay, once the requests using it have
+// finished.
+func (db *DB) Use(fresh *Pool, cfg *config.Config) {
+	db.swap(fresh)
+	if interval := cfg.Database.TotalRefresh; interval > 0 {
+		go fresh.refreshTotalLoop(interval, cfg.Database.ExactDBTotal)
+	}
+}
+
+// Discard closes a pool from OpenPool that was not passed to Use.
+func (p *Pool) Discard() {
+	if err := p.retire(); err != nil {
+		slog.Warn("Closing unused database pool", "err", err)
+	}
+}
+
+// swap makes fresh the current pool and retires the previous one.
+func (db *DB) swap(fresh *Pool) {
+	old := db.pool.Swap(fresh)
+	if old == nil {
+		return
+	}
+	time.AfterFunc(retireDelay, func() {
+		if err := old.retire(); err != nil {
+			slog.Warn("Closing previous database pool", "err", err)
+		}
+	})
+}
+
+// retire stops the background work of p and closes its connections. It
+// may be called more than once; later calls do nothing.
+func (p *Pool) retire() error {
+	var err error
+	p.retired.Do(func() {
+		close(p.done)
+		err = p.Close()
+	})
+	return err
+}
+
+// Test checks that the database settings of cfg work before they are
+// saved: it returns the first failed check of Diagnose.
+func Test(ctx context.Context, cfg *config.Config) error {
+	return Diagnose(ctx, cfg).Err()
+}
+
+// open connects to the database and loads its schema information. With
+// indexes set it also creates the indexes the queries rely on.
+func open(cfg *config.Config, indexes bool) (*Pool, error) {
 	dsn, err := cfg.DSN()
 	if err != nil {
 		return nil, fmt.Errorf("failed to build DSN: %w", err)
@@ -35,63 +240,79 @@ func Connect(cfg *config.Config) (*DB, error) {
 	sqlDB.SetConnMaxLifetime(5 * time.Minute)
 
 	if err := sqlDB.Ping(); err != nil {
+		sqlDB.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	log.Println("✓ Database connection established")
+	slog.Info("Database connection established")
 
-	db := &DB{DB: sqlDB, MetaCache: NewMetaCache()}
-	if err := db.initialize(); err != nil {
+	p := &Pool{DB: sqlDB, MetaCache: NewMetaCache(), done: make(chan struct{})}
+	if err := p.initialize(indexes); err != nil {
+		sqlDB.Close()
 		return nil, err
 	}
-
-	return db, nil
+	return p, nil
 }
 
 // initialize performs initial database setup.
-func (db *DB) initialize() error {
-	if err := db.createIndexes(); err != nil {
-		return err
+func (p *Pool) initialize(indexes bool) error {
+	if indexes {
+		if err := p.createIndexes(); err != nil {
+			return err
+		}
 	}
-	if err := db.loadColumns(); err != nil {
+	if err := p.loadColumns(); err != nil {
 		return err
 	}
-	db.PriorityMode = db.detectPriorityMode()
+	p.detectServer()
+	p.PriorityMode = p.detectPriorityMode()
 	return nil
 }
 
 // loadColumns loads all column names from the SystemEvents table.
 // "Severity" is added as a virtual computed column.
-func (db *DB) loadColumns() error {
-	rows, err := db.Query("SHOW COLUMNS FROM SystemEvents")
+func (p *Pool) loadColumns() error {
+	rows, err := p.Query("SHOW COLUMNS FROM SystemEvents")
 	if err != nil {
 		return fmt.Errorf("failed to query columns: %w", err)
 	}
 	defer rows.Close()
 
-	db.AvailableColumns = []string{}
+	p.AvailableColumns = []string{}
 	for rows.Next() {
 		var field, colType, null, key, def, extra sql.NullString
 		if err := rows.Scan(&field, &colType, &null, &key, &def, &extra); err != nil {
-			log.Printf("Warning: failed to scan column info: %v", err)
+			slog.Warn("Failed to scan column info", "err", err)
 			continue
 		}
 		if field.Valid {
-			db.AvailableColumns = append(db.AvailableColumns, field.String)
+			p.AvailableColumns = append(p.AvailableColumns, field.String)
 		}
 	}
 
 	// Virtual column derived from Priority MOD 8
-	db.AvailableColumns = append(db.AvailableColumns, "Severity")
+	p.AvailableColumns = append(p.AvailableColumns, "Severity")
 
-	log.Printf("✓ Loaded %d columns from SystemEvents (+ virtual: Severity)",
-		len(db.AvailableColumns)-1)
+	slog.Info("Loaded columns from SystemEvents", "columns", len(p.AvailableColumns)-1, "virtual", "Severity")
 	return nil
 }
 
+// detectServer tells MariaDB from MySQL, which use different syntax for
+// per-statement time limits.
+func (p *Pool) detectServer() {
+	var version string
+	if err := p.QueryRow("SELECT VERSION()").Scan(&version); err != nil {
+		slog.Warn("Failed to read server version", "err", err)
+		return
+	}
+	p.Version = version
+	p.MariaDB = strings.Contains(strings.ToLower(version), "mariadb")
+	slog.Info("Database server", "version", version)
+}
+
 // IsValidColumn checks if a column name is valid (real or virtual).
-func (db *DB) IsValidColumn(column string) bool {
-	for _, col := range db.AvailableColumns {
+func (p *Pool) IsValidColumn(column string) bool {
+	for _, col := range p.AvailableColumns {
 		if col == column {
 			return true
 		}
@@ -99,7 +320,22 @@ func (db *DB) IsValidColumn(column string) bool {
 	return false
 }
 
+// MissingColumns returns the columns rsyslox reads that SystemEvents lacks.
+func (p *Pool) MissingColumns() []string {
+	var missing []string
+	for _, col := range logColumns {
+		if !p.IsValidColumn(col) {
+			missing = append(missing, col)
+		}
+	}
+	return missing
+}
+
 // Health checks the database connection health.
 func (db *DB) Health() error {
-	return db.Ping()
+	p := db.Pool()
+	if p == nil {
+		return ErrNotReady
+	}
+	return p.Ping()
 }
@@ -1,46 +1,91 @@
 package database
 
-import "log"
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"strings"
+)
 
-// createIndexes creates necessary database indexes for optimal query performance
-func (db *DB) createIndexes() error {
-	indexes := []struct {
-		name  string
-		query string
-	}{
-		{
-			name:  "idx_receivedat",
-			query: "CREATE INDEX IF NOT EXISTS idx_receivedat ON SystemEvents (ReceivedAt)",
-		},
-		{
-			name:  "idx_host_time",
-			query: "CREATE INDEX IF NOT EXISTS idx_host_time ON SystemEvents (FromHost, ReceivedAt)",
-		},
-		{
-			name:  "idx_priority",
-			query: "CREATE INDEX IF NOT EXISTS idx_priority ON SystemEvents (Priority)",
-		},
-		{
-			name:  "idx_facility",
-			query: "CREATE INDEX IF NOT EXISTS idx_facility ON SystemEvents (Facility)",
-		},
-		{
-			name:  "idx_syslogtag",
-			query: "CREATE INDEX IF NOT EXISTS idx_syslogtag ON SystemEvents (SysLogTag)",
-		},
-	}
+// index is an index of SystemEvents the queries rely on.
+type index struct {
+	name    string
+	columns string
+}
+
+// indexes are created at startup if missing.
+var indexes = []index{
+	{"idx_receivedat", "ReceivedAt"},
+	{"idx_host_time", "FromHost, ReceivedAt"},
+	{"idx_priority", "Priority"},
+	{"idx_facility", "Facility"},
+	{"idx_syslogtag", "SysLogTag"},
+}
 
+// createIndexes creates necessary database indexes for optimal query performance
+func (p *Pool) createIndexes() error {
 	for _, idx := range indexes {
-		if _, err := db.Exec(idx.query); err != nil {
-			log.Printf("Index creation info (%s): %v", idx.name, err)
+		query := "CREATE INDEX IF NOT EXISTS " + idx.name + " ON SystemEvents (" + idx.columns + ")"
+		if _, err := p.Exec(query); err != nil {
+			slog.Debug("Index not created", "index", idx.name, "err", err)
 		}
 	}
 
 	// Try to create fulltext index (may fail if already exists)
-	if _, err := db.Exec("ALTER TABLE SystemEvents ADD FULLTEXT(Message)"); err != nil {
-		log.Printf("Fulltext index info: %v", err)
+	if _, err := p.Exec("ALTER TABLE SystemEvents ADD FULLTEXT(Message)"); err != nil {
+		slog.Debug("Fulltext index not created", "err", err)
 	}
 
-	log.Println("✓ Database indexes created/verified")
+	slog.Info("Database indexes created/verified")
 	return nil
 }
+
+// IndexStatus tells whether an index rsyslox relies on exists.
+type IndexStatus struct {
+	Name    string `json:"name"`
+	Columns string `json:"columns"`
+	Present bool   `json:"present"`
+}
+
+// IndexStatus lists the indexes created at startup, and the full-text
+// index on Message, with whether they exist.
+func (p *Pool) IndexStatus(ctx context.Context) ([]IndexStatus, error) {
+	names := make(map[string]bool)
+	fulltext := false
+	err := p.query(ctx, "SHOW INDEX FROM SystemEvents", nil, func(rows *sql.Rows) error {
+		cols, err := rows.Columns()
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			// The column set differs between MySQL and MariaDB versions;
+			// read everything and pick the columns by name.
+			vals := make([]sql.NullString, len(cols))
+			ptrs := make([]interface{}, len(cols))
+			for i := range vals {
+				ptrs[i] = &vals[i]
+			}
+			if err := rows.Scan(ptrs...); err != nil {
+				return err
+			}
+			row := make(map[string]string, len(cols))
+			for i, c := range cols {
+				row[c] = vals[i].String
+			}
+			names[row["Key_name"]] = true
+			if strings.EqualFold(row["Index_type"], "FULLTEXT") && row["Column_name"] == "Message" {
+				fulltext = true
+			}
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	status := make([]IndexStatus, 0, len(indexes)+1)
+	for _, idx := range indexes {
+		status = append(status, IndexStatus{Name: idx.name, Columns: idx.columns, Present: names[idx.name]})
+	}
+	return append(status, IndexStatus{Name: "FULLTEXT", Columns: "Message", Present: fulltext}), nil
+}
@@ -1,6 +1,9 @@
 package database
 
-import "log"
+import (
+	"context"
+	"log/slog"
+)
 
 // PriorityMode describes how the Priority column is stored in the database.
 // This differs between rsyslog versions:
@@ -48,18 +51,29 @@ func (m PriorityMode) String() string {
 //
 // Fallback: if no non-kernel entries exist, legacy mode is assumed and a warning
 // is logged.
-func (db *DB) detectPriorityMode() PriorityMode {
-	var oldest, newest int
+func (p *Pool) detectPriorityMode() PriorityMode {
+	mode, oldest, newest, ok := p.samplePriorityMode(context.Background())
+	if !ok {
+		slog.Warn("Priority mode detection: no non-kernel entries found, assuming legacy mode")
+		return PriorityModeLegacy
+	}
+	slog.Info("Priority mode detected", "mode", mode.String(), "oldest_priority", oldest, "newest_priority", newest)
+	return mode
+}
+
+// samplePriorityMode applies the decision table of detectPriorityMode. ok
+// is false when there are no non-kernel entries to sample.
+func (p *Pool) samplePriorityMode(ctx context.Context) (mode PriorityMode, oldest, newest int, ok bool) {
 	var oldestFound, newestFound bool
 
-	row := db.QueryRow(
+	row := p.QueryRowContext(ctx,
 		"SELECT Priority FROM SystemEvents WHERE Facility > 0 ORDER BY ReceivedAt ASC LIMIT 1",
 	)
 	if err := row.Scan(&oldest); err == nil {
 		oldestFound = true
 	}
 
-	row = db.QueryRow(
+	row = p.QueryRowContext(ctx,
 		"SELECT Priority FROM SystemEvents WHERE Facility > 0 ORDER BY ReceivedAt DESC LIMIT 1",
 	)
 	if err := row.Scan(&newest); err == nil {
@@ -67,14 +81,12 @@ func (db *DB) detectPriorityMode() PriorityMode {
 	}
 
 	if !oldestFound && !newestFound {
-		log.Println("⚠ Priority mode detection: no non-kernel entries found, assuming legacy mode")
-		return PriorityModeLegacy
+		return PriorityModeLegacy, 0, 0, false
 	}
 
 	oldestIsModern := oldestFound && oldest > 7
 	newestIsModern := newestFound && newest > 7
 
-	var mode PriorityMode
 	switch {
 	case !oldestIsModern && !newestIsModern:
 		mode = PriorityModeLegacy
@@ -84,8 +96,5 @@ func (db *DB) detectPriorityMode() PriorityMode {
 		// Oldest entry is legacy-format, newest is modern-format → rsyslog was updated
 		mode = PriorityModeMixed
 	}
-
-	log.Printf("✓ Priority mode detected: %s (oldest non-kernel Priority=%d, newest=%d)",
-		mode, oldest, newest)
-	return mode
+	return mode, oldest, newest, true
 }
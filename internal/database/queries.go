@@ -1,32 +1,44 @@
 package database
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/phil-bot/rsyslox/internal/models"
 )
 
+// logColumns are the columns of SystemEvents read for each log entry, in
+// the order of models.LogEntry.ScanFromRows.
+var logColumns = []string{
+	"ID", "CustomerID", "ReceivedAt", "DeviceReportedTime", "Facility", "Priority",
+	"FromHost", "Message", "NTSeverity", "Importance", "EventSource", "EventUser",
+	"EventCategory", "EventID", "EventBinaryData", "MaxAvailable", "CurrUsage",
+	"MinUsage", "MaxUsage", "InfoUnitID", "SysLogTag", "EventLogType",
+	"GenericFileName", "SystemID",
+}
+
 // QueryLogs executes a paginated log query with the given WHERE clause and args.
 // A copy of args is made internally so the caller's slice is never mutated.
-func (db *DB) QueryLogs(whereClause string, args []interface{}, limit, offset int) ([]models.LogEntry, error) {
-	return db.queryLogsRaw(whereClause, args, limit, offset)
+//
+// All query methods take a context: its deadline becomes a server-side
+// time limit and canceling it kills the query (see Pool.query).
+func (p *Pool) QueryLogs(ctx context.Context, whereClause string, args []interface{}, limit, offset int) ([]models.LogEntry, error) {
+	return p.queryLogsRaw(ctx, whereClause, args, limit, offset)
 }
 
 // queryLogsRaw executes the SELECT without mutating the caller's args slice.
-func (db *DB) queryLogsRaw(whereClause string, args []interface{}, limit, offset int) ([]models.LogEntry, error) {
+func (p *Pool) queryLogsRaw(ctx context.Context, whereClause string, args []interface{}, limit, offset int) ([]models.LogEntry, error) {
 	query := fmt.Sprintf(`
-		SELECT ID, CustomerID, ReceivedAt, DeviceReportedTime, Facility, Priority,
-		       FromHost, Message, NTSeverity, Importance, EventSource, EventUser,
-		       EventCategory, EventID, EventBinaryData, MaxAvailable, CurrUsage,
-		       MinUsage, MaxUsage, InfoUnitID, SysLogTag, EventLogType,
-		       GenericFileName, SystemID
+		SELECT %s
 		FROM SystemEvents
 		WHERE %s
 		ORDER BY ReceivedAt DESC
 		LIMIT ? OFFSET ?
-	`, whereClause)
+	`, strings.Join(logColumns, ", "), whereClause)
 
 	// Build a fresh slice — do not append to the caller's args.
 	queryArgs := make([]interface{}, len(args)+2)
@@ -34,57 +46,74 @@ func (db *DB) queryLogsRaw(whereClause string, args []interface{}, limit, offset
 	queryArgs[len(args)] = limit
 	queryArgs[len(args)+1] = offset
 
-	rows, err := db.Query(query, queryArgs...)
-	if err != nil {
-		return nil, fmt.Errorf("query failed: %v", err)
-	}
-	defer rows.Close()
-
 	entries := []models.LogEntry{}
-	for rows.Next() {
-		var entry models.LogEntry
-		if err := entry.ScanFromRows(rows); err != nil {
-			continue
+	err := p.query(ctx, query, queryArgs, func(rows *sql.Rows) error {
+		for rows.Next() {
+			var entry models.LogEntry
+			if err := entry.ScanFromRows(rows); err != nil {
+				continue
+			}
+			entries = append(entries, entry)
 		}
-		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
 	}
 
 	return entries, nil
 }
 
 // CountLogs counts the total number of rows matching the given WHERE clause.
-func (db *DB) CountLogs(whereClause string, args []interface{}) (int, error) {
+func (p *Pool) CountLogs(ctx context.Context, whereClause string, args []interface{}) (int, error) {
 	query := fmt.Sprintf("SELECT COUNT(*) FROM SystemEvents WHERE %s", whereClause)
 	var total int
-	if err := db.QueryRow(query, args...).Scan(&total); err != nil {
-		return 0, fmt.Errorf("count query failed: %v", err)
+	if err := p.queryRow(ctx, query, args, &total); err != nil {
+		return 0, fmt.Errorf("count query failed: %w", err)
 	}
 	return total, nil
 }
 
 // TotalCount returns the total number of rows in SystemEvents (no filter applied).
-func (db *DB) TotalCount() (int, error) {
+func (p *Pool) TotalCount(ctx context.Context) (int, error) {
 	var total int
-	if err := db.QueryRow("SELECT COUNT(*) FROM SystemEvents").Scan(&total); err != nil {
-		return 0, fmt.Errorf("total count query failed: %v", err)
+	if err := p.queryRow(ctx, "SELECT COUNT(*) FROM SystemEvents", nil, &total); err != nil {
+		return 0, fmt.Errorf("total count query failed: %w", err)
 	}
 	return total, nil
 }
 
 // OldestEntryTime returns the ReceivedAt timestamp of the oldest log entry.
 // Returns nil when the table is empty.
-func (db *DB) OldestEntryTime() (*time.Time, error) {
+func (p *Pool) OldestEntryTime(ctx context.Context) (*time.Time, error) {
 	var t time.Time
-	err := db.QueryRow("SELECT MIN(ReceivedAt) FROM SystemEvents").Scan(&t)
+	err := p.queryRow(ctx, "SELECT MIN(ReceivedAt) FROM SystemEvents", nil, &t)
 	if err != nil || t.IsZero() {
 		return nil, nil
 	}
 	return &t, nil
 }
 
-// QueryLogsWithTotal runs CountLogs, QueryLogs and TotalCount in parallel.
-// Returns (entries, filteredTotal, dbTotal, error).
-func (db *DB) QueryLogsWithTotal(whereClause string, args []interface{}, limit, offset int) ([]models.LogEntry, int, int, error) {
+// LogsResult is a page of log entries with the counts shown next to it.
+type LogsResult struct {
+	Entries      []models.LogEntry
+	Total        int  // rows matching the filter
+	TotalExact   bool // false for estimates and for CountNone
+	DBTotal      int  // rows in SystemEvents, from the background cache
+	DBTotalExact bool
+	HasMore      bool // at least one more row follows this page
+}
+
+// QueryLogsWithTotal fetches a page of entries and counts the matching rows
+// according to mode, in parallel. The table total comes from the cache
+// (see DBTotal). When one query fails the other is canceled.
+//
+// A page that is not full reveals the exact total without counting, so
+// CountEstimate and CountNone use that whenever they can.
+func (p *Pool) QueryLogsWithTotal(ctx context.Context, whereClause string, args []interface{}, limit, offset int, mode CountMode) (*LogsResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	type countResult struct {
 		n   int
 		err error
@@ -94,120 +123,147 @@ func (db *DB) QueryLogsWithTotal(whereClause string, args []interface{}, limit,
 		err  error
 	}
 
-	filteredCh := make(chan countResult, 1)
-	dbTotalCh  := make(chan countResult, 1)
-	entriesCh  := make(chan entriesResult, 1)
+	countCh   := make(chan countResult, 1)
+	entriesCh := make(chan entriesResult, 1)
 
 	var wg sync.WaitGroup
-	wg.Add(3)
-
-	go func() {
-		defer wg.Done()
-		n, err := db.CountLogs(whereClause, args)
-		filteredCh <- countResult{n, err}
-	}()
+	wg.Add(2)
 
 	go func() {
 		defer wg.Done()
-		n, err := db.TotalCount()
-		dbTotalCh <- countResult{n, err}
+		var n int
+		var err error
+		switch mode {
+		case CountExact:
+			n, err = p.CountLogs(ctx, whereClause, args)
+		case CountEstimate:
+			n, err = p.EstimateLogs(ctx, whereClause, args)
+		}
+		if err != nil {
+			cancel()
+		}
+		countCh <- countResult{n, err}
 	}()
 
 	go func() {
 		defer wg.Done()
+		// One extra row tells whether another page follows.
 		// queryLogsRaw builds its own args copy — safe to share args here.
-		rows, err := db.queryLogsRaw(whereClause, args, limit, offset)
+		rows, err := p.queryLogsRaw(ctx, whereClause, args, limit+1, offset)
+		if err != nil {
+			cancel()
+		}
 		entriesCh <- entriesResult{rows, err}
 	}()
 
 	wg.Wait()
-	close(filteredCh)
-	close(dbTotalCh)
+	close(countCh)
 	close(entriesCh)
 
-	filtered := <-filteredCh
-	dbTotal  := <-dbTotalCh
-	entries  := <-entriesCh
+	count   := <-countCh
+	entries := <-entriesCh
 
-	if filtered.err != nil {
-		return nil, 0, 0, filtered.err
+	if entries.err != nil {
+		return nil, entries.err
 	}
-	if dbTotal.err != nil {
-		return nil, 0, 0, dbTotal.err
+	if count.err != nil {
+		return nil, count.err
 	}
-	if entries.err != nil {
-		return nil, 0, 0, entries.err
+
+	res := &LogsResult{Entries: entries.rows, Total: count.n, TotalExact: mode == CountExact}
+	if len(res.Entries) > limit {
+		res.Entries = res.Entries[:limit]
+		res.HasMore = true
 	}
 
-	return entries.rows, filtered.n, dbTotal.n, nil
+	seen := offset + len(res.Entries)
+	switch {
+	case mode == CountExact:
+	case !res.HasMore && (len(res.Entries) > 0 || offset == 0):
+		// Last page: the total is known exactly.
+		res.Total, res.TotalExact = seen, true
+	case mode == CountNone || res.Total < seen:
+		// Lower bound; +1 for the row that proved HasMore.
+		res.Total = seen
+		if res.HasMore {
+			res.Total++
+		}
+	}
+
+	res.DBTotal, res.DBTotalExact = p.DBTotal(ctx)
+	return res, nil
 }
 
 // QueryDistinctValues returns distinct values for a column, with optional filters.
 // Results are cached for metaCacheTTL (60 s) to reduce redundant DB round-trips.
 // "Severity" is a virtual column computed from Priority MOD 8.
-func (db *DB) QueryDistinctValues(column, whereClause string, args []interface{}) (interface{}, error) {
+func (p *Pool) QueryDistinctValues(ctx context.Context, column, whereClause string, args []interface{}) (interface{}, error) {
 	key := CacheKey(column, whereClause, args)
-	if cached, ok := db.MetaCache.Get(key); ok {
+	if cached, ok := p.MetaCache.Get(key); ok {
 		return cached, nil
 	}
 
-	result, err := db.queryDistinctValuesUncached(column, whereClause, args)
+	result, err := p.queryDistinctValuesUncached(ctx, column, whereClause, args)
 	if err != nil {
 		return nil, err
 	}
 
-	db.MetaCache.Set(key, result)
+	p.MetaCache.Set(key, result)
 	return result, nil
 }
 
 // queryDistinctValuesUncached performs the actual DB query without consulting the cache.
-func (db *DB) queryDistinctValuesUncached(column, whereClause string, args []interface{}) (interface{}, error) {
+func (p *Pool) queryDistinctValuesUncached(ctx context.Context, column, whereClause string, args []interface{}) (interface{}, error) {
 	if column == "Severity" {
-		return db.queryDistinctSeverity(whereClause, args)
+		return p.queryDistinctSeverity(ctx, whereClause, args)
 	}
 
 	query := fmt.Sprintf(
 		"SELECT DISTINCT %s FROM SystemEvents WHERE %s AND %s IS NOT NULL ORDER BY %s ASC",
 		column, whereClause, column, column,
 	)
-	rows, err := db.Query(query, args...)
+	var result interface{}
+	err := p.query(ctx, query, args, func(rows *sql.Rows) error {
+		var err error
+		switch {
+		case column == "Facility":
+			result, err = scanMetaFacilityValues(rows)
+		case p.isIntegerColumn(column):
+			result, err = scanIntValues(rows)
+		default:
+			result, err = scanStringValues(rows)
+		}
+		return err
+	})
 	if err != nil {
-		return nil, fmt.Errorf("meta query failed: %v", err)
+		return nil, fmt.Errorf("meta query failed: %w", err)
 	}
-	defer rows.Close()
-
-	if column == "Facility" {
-		return scanMetaFacilityValues(rows)
-	}
-	if db.isIntegerColumn(column) {
-		return scanIntValues(rows)
-	}
-	return scanStringValues(rows)
+	return result, nil
 }
 
 // queryDistinctSeverity returns distinct Severity values derived from Priority MOD 8.
-func (db *DB) queryDistinctSeverity(whereClause string, args []interface{}) (interface{}, error) {
+func (p *Pool) queryDistinctSeverity(ctx context.Context, whereClause string, args []interface{}) (interface{}, error) {
 	query := fmt.Sprintf(
 		"SELECT DISTINCT Priority MOD 8 AS Severity FROM SystemEvents WHERE %s ORDER BY Severity ASC",
 		whereClause,
 	)
-	rows, err := db.Query(query, args...)
-	if err != nil {
-		return nil, fmt.Errorf("severity meta query failed: %v", err)
-	}
-	defer rows.Close()
-
 	var result []models.MetaValue
-	for rows.Next() {
-		var v int
-		if err := rows.Scan(&v); err != nil {
-			continue
-		}
-		label := ""
-		if v >= 0 && v < len(models.SeverityLabels) {
-			label = models.SeverityLabels[v]
+	err := p.query(ctx, query, args, func(rows *sql.Rows) error {
+		for rows.Next() {
+			var v int
+			if err := rows.Scan(&v); err != nil {
+				continue
+			}
+			label := ""
+			if v >= 0 && v < len(models.SeverityLabels) {
+				label = models.SeverityLabels[v]
+			}
+			result = append(result, models.MetaValue{Val: v, Label: label})
 		}
-		result = append(result, models.MetaValue{Val: v, Label: label})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("severity meta query failed: %w", err)
 	}
 	if result == nil {
 		result = []models.MetaValue{}
@@ -268,7 +324,7 @@ func scanStringValues(rows interface{ Scan(...interface{}) error; Next() bool })
 }
 
 // isIntegerColumn returns true for columns known to hold integer values.
-func (db *DB) isIntegerColumn(column string) bool {
+func (p *Pool) isIntegerColumn(column string) bool {
 	intCols := map[string]bool{
 		"Facility": true, "Priority": true, "NTSeverity": true,
 		"Importance": true, "EventCategory": true, "EventID": true,
@@ -0,0 +1,169 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// ErrQueryTimeout is returned when a query ran longer than the deadline of
+// its context, whether the client or the server noticed first.
+var ErrQueryTimeout = errors.New("query timed out")
+
+// MySQL / MariaDB error numbers for interrupted statements.
+const (
+	errQueryInterrupted = 1317 // KILL QUERY
+	errMaxStatementTime = 1969 // MariaDB max_statement_time
+	errMaxExecutionTime = 3024 // MySQL MAX_EXECUTION_TIME
+)
+
+// killTimeout bounds the KILL QUERY issued for a canceled request.
+const killTimeout = 5 * time.Second
+
+// query runs a SELECT and hands the result rows to scan.
+//
+// When ctx carries a deadline, the statement gets a server-side limit as
+// well (MAX_EXECUTION_TIME on MySQL, max_statement_time on MariaDB), so
+// MySQL stops on its own even if the client is gone. When ctx is canceled
+// before the query finished, the query is killed on the server: closing
+// the client connection alone leaves MySQL working on it.
+func (p *Pool) query(ctx context.Context, query string, args []interface{}, scan func(*sql.Rows) error) error {
+	if ctx.Done() == nil {
+		// Not cancelable — no need for a dedicated connection.
+		rows, err := p.QueryContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		if err := scan(rows); err != nil {
+			return err
+		}
+		return rows.Err()
+	}
+
+	query, err := p.withTimeoutHint(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	conn, err := p.Conn(ctx)
+	if err != nil {
+		return p.queryError(ctx, err)
+	}
+	defer conn.Close()
+
+	var connID int64
+	if err := conn.QueryRowContext(ctx, "SELECT CONNECTION_ID()").Scan(&connID); err != nil {
+		return p.queryError(ctx, err)
+	}
+
+	// Kill the server-side query if ctx ends first. finished guards against
+	// killing whatever the connection runs after this query completed.
+	var mu sync.Mutex
+	finished := false
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			mu.Lock()
+			if !finished {
+				p.killQuery(connID)
+			}
+			mu.Unlock()
+		case <-done:
+		}
+	}()
+	defer func() {
+		mu.Lock()
+		finished = true
+		mu.Unlock()
+		close(done)
+	}()
+
+	rows, err := conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return p.queryError(ctx, err)
+	}
+	defer rows.Close()
+	if err := scan(rows); err != nil {
+		return p.queryError(ctx, err)
+	}
+	return p.queryError(ctx, rows.Err())
+}
+
+// queryRow runs a single-row SELECT and scans it into dest.
+func (p *Pool) queryRow(ctx context.Context, query string, args []interface{}, dest ...interface{}) error {
+	return p.query(ctx, query, args, func(rows *sql.Rows) error {
+		if !rows.Next() {
+			if err := rows.Err(); err != nil {
+				return err
+			}
+			return sql.ErrNoRows
+		}
+		return rows.Scan(dest...)
+	})
+}
+
+// withTimeoutHint adds a server-side execution limit matching the deadline
+// of ctx to a SELECT. Queries without a deadline are returned unchanged.
+func (p *Pool) withTimeoutHint(ctx context.Context, query string) (string, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return query, nil
+	}
+	remaining := time.Until(deadline)
+	if remaining <= 0 {
+		return "", ErrQueryTimeout
+	}
+
+	trimmed := strings.TrimSpace(query)
+	if !strings.HasPrefix(strings.ToUpper(trimmed), "SELECT") {
+		return query, nil
+	}
+	if p.MariaDB {
+		return fmt.Sprintf("SET STATEMENT max_statement_time=%.3f FOR %s", remaining.Seconds(), trimmed), nil
+	}
+	ms := remaining.Milliseconds()
+	if ms < 1 {
+		ms = 1
+	}
+	return fmt.Sprintf("SELECT /*+ MAX_EXECUTION_TIME(%d) */%s", ms, trimmed[len("SELECT"):]), nil
+}
+
+// killQuery stops the statement running on connection id.
+func (p *Pool) killQuery(id int64) {
+	ctx, cancel := context.WithTimeout(context.Background(), killTimeout)
+	defer cancel()
+	// KILL does not take placeholders; id is an integer from CONNECTION_ID().
+	if _, err := p.ExecContext(ctx, fmt.Sprintf("KILL QUERY %d", id)); err != nil {
+		slog.Warn("Failed to kill query", "connection", id, "err", err)
+	}
+}
+
+// queryError translates interruptions into ErrQueryTimeout or the
+// context's error so callers can tell them from database failures.
+func (p *Pool) queryError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	var me *mysql.MySQLError
+	interrupted := errors.As(err, &me) &&
+		(me.Number == errMaxExecutionTime || me.Number == errMaxStatementTime || me.Number == errQueryInterrupted)
+
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return ErrQueryTimeout
+	case ctx.Err() != nil:
+		return ctx.Err()
+	case interrupted && me.Number != errQueryInterrupted:
+		return ErrQueryTimeout
+	}
+	return err
+}
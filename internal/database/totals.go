@@ -0,0 +1,149 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CountMode selects how the filtered row count of a log query is obtained.
+type CountMode string
+
+const (
+	CountExact    CountMode = "exact"    // SELECT COUNT(*) — accurate, slow on large tables
+	CountEstimate CountMode = "estimate" // optimizer row estimate from EXPLAIN
+	CountNone     CountMode = "none"     // no count; see LogsResult.HasMore
+)
+
+// totalCache holds the row count of SystemEvents. It is refreshed in the
+// background so no request has to wait for a COUNT(*) of the whole table.
+type totalCache struct {
+	mu      sync.Mutex
+	n       int
+	exact   bool
+	updated time.Time
+}
+
+// DBTotal returns the cached number of rows in SystemEvents and whether it
+// came from an exact count. Before the first background refresh it falls
+// back to the table statistics.
+func (p *Pool) DBTotal(ctx context.Context) (int, bool) {
+	p.total.mu.Lock()
+	n, exact, updated := p.total.n, p.total.exact, p.total.updated
+	p.total.mu.Unlock()
+	if !updated.IsZero() {
+		return n, exact
+	}
+
+	n, err := p.tableRowsEstimate(ctx)
+	if err != nil {
+		slog.Warn("DB total: estimate failed", "err", err)
+		return 0, false
+	}
+	p.setTotal(n, false)
+	return n, false
+}
+
+func (p *Pool) setTotal(n int, exact bool) {
+	p.total.mu.Lock()
+	p.total.n, p.total.exact, p.total.updated = n, exact, time.Now()
+	p.total.mu.Unlock()
+}
+
+// refreshTotalLoop keeps the cached table total up to date. With exact set
+// it runs COUNT(*), bounded by interval; otherwise, or if the count fails,
+// it uses the table statistics. It returns once the pool is retired.
+func (p *Pool) refreshTotalLoop(interval time.Duration, exact bool) {
+	refresh := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		defer cancel()
+		if exact {
+			n, err := p.TotalCount(ctx)
+			if err == nil {
+				p.setTotal(n, true)
+				return
+			}
+			slog.Warn("DB total: exact count failed, using estimate", "err", err)
+		}
+		if n, err := p.tableRowsEstimate(ctx); err == nil {
+			p.setTotal(n, false)
+		} else {
+			slog.Warn("DB total: estimate failed", "err", err)
+		}
+	}
+
+	refresh()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			refresh()
+		}
+	}
+}
+
+// tableRowsEstimate reads the approximate row count of SystemEvents from
+// the table statistics. Instant, but may be off by 40–50 % on InnoDB.
+func (p *Pool) tableRowsEstimate(ctx context.Context) (int, error) {
+	var n sql.NullInt64
+	err := p.queryRow(ctx,
+		"SELECT TABLE_ROWS FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'SystemEvents'",
+		nil, &n)
+	if err != nil {
+		return 0, fmt.Errorf("table statistics: %w", err)
+	}
+	return int(n.Int64), nil
+}
+
+// EstimateLogs returns the optimizer's estimate of the number of rows
+// matching whereClause, taken from EXPLAIN ("rows" × "filtered" %).
+func (p *Pool) EstimateLogs(ctx context.Context, whereClause string, args []interface{}) (int, error) {
+	if whereClause == "1=1" {
+		return p.tableRowsEstimate(ctx)
+	}
+
+	query := fmt.Sprintf("EXPLAIN SELECT 1 FROM SystemEvents WHERE %s", whereClause)
+	var estimate float64
+	err := p.query(ctx, query, args, func(rows *sql.Rows) error {
+		cols, err := rows.Columns()
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			vals := make([]sql.NullString, len(cols))
+			ptrs := make([]interface{}, len(cols))
+			for i := range vals {
+				ptrs[i] = &vals[i]
+			}
+			if err := rows.Scan(ptrs...); err != nil {
+				return err
+			}
+			// Column names differ between MySQL and MariaDB versions;
+			// "filtered" is missing on older servers.
+			rowsEst, filtered := 0.0, 100.0
+			for i, c := range cols {
+				switch strings.ToLower(c) {
+				case "rows":
+					fmt.Sscan(vals[i].String, &rowsEst) //nolint:errcheck
+				case "filtered":
+					if vals[i].Valid {
+						fmt.Sscan(vals[i].String, &filtered) //nolint:errcheck
+					}
+				}
+			}
+			estimate += rowsEst * filtered / 100
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("estimate query failed: %w", err)
+	}
+	return int(estimate + 0.5), nil
+}
@@ -0,0 +1,58 @@
+// Package fileutil writes the state files of rsyslox — config.toml, its
+// history, sessions and key usage — so that a crash never leaves a
+// partially written or empty file behind.
+package fileutil
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// WriteAtomic replaces path with data: it writes a temporary file in the
+// same directory, syncs it and renames it over path, then syncs the
+// directory so the rename survives a crash too. An existing file's owner
+// is kept when running as root, e.g. for the CLI under sudo.
+func WriteAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp) // no-op after the rename
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		return err
+	}
+	if fi, err := os.Stat(path); err == nil {
+		keepOwner(f, fi)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	if d, err := os.Open(dir); err == nil {
+		d.Sync() //nolint:errcheck // best effort
+		d.Close()
+	}
+	return nil
+}
+
+// keepOwner gives f the owner and group of fi when running as root.
+func keepOwner(f *os.File, fi os.FileInfo) {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok && os.Geteuid() == 0 {
+		f.Chown(int(st.Uid), int(st.Gid)) //nolint:errcheck // best effort
+	}
+}
@@ -0,0 +1,49 @@
+package filters
+
+import (
+	"math"
+	"time"
+)
+
+// unboundedRangeDays is the range assumed for queries without a start date.
+const unboundedRangeDays = 365
+
+// CostParams describes a log query for EstimateCost.
+type CostParams struct {
+	Start, End   time.Time // zero Start: no date range
+	MessageTerms int       // Message LIKE terms
+	Hosts        int       // FromHost values
+	Tags         int       // SysLogTag values
+	Limit        int
+}
+
+// EstimateCost returns a rough relative cost of a query, where one day of
+// logs without further filters costs 1.
+//
+// The date range drives the number of rows MySQL has to read. A Message
+// search cannot use an index ('%term%'), so it multiplies the cost; host
+// and tag filters narrow the scan via idx_host_time and idx_syslogtag
+// (one host counts as a tenth of the data, one tag as a quarter).
+// Large pages add the cost of transferring the rows.
+func EstimateCost(p CostParams) float64 {
+	days := float64(unboundedRangeDays)
+	if !p.Start.IsZero() {
+		end := p.End
+		if end.IsZero() {
+			end = time.Now()
+		}
+		days = math.Max(end.Sub(p.Start).Hours()/24, 1.0/24)
+	}
+
+	cost := days
+	if p.MessageTerms > 0 {
+		cost *= 10 + 2*float64(p.MessageTerms-1)
+	}
+	if p.Hosts > 0 {
+		cost *= math.Min(1, float64(p.Hosts)/10)
+	}
+	if p.Tags > 0 {
+		cost *= math.Min(1, float64(p.Tags)/4)
+	}
+	return cost + float64(p.Limit)/1000
+}
@@ -0,0 +1,110 @@
+package admin
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/phil-bot/rsyslox/internal/audit"
+	"github.com/phil-bot/rsyslox/internal/config"
+	"github.com/phil-bot/rsyslox/internal/middleware"
+	"github.com/phil-bot/rsyslox/internal/models"
+)
+
+const (
+	auditDefaultLimit = 50
+	auditMaxLimit     = 500
+)
+
+// AuditHandler handles GET /api/admin/audit.
+//
+// Query parameters (all optional):
+//
+//	action  — exact action ("key.create") or prefix ending in "." ("auth.")
+//	actor   — username
+//	ip      — client IP
+//	since   — RFC3339 timestamp, inclusive
+//	until   — RFC3339 timestamp, inclusive
+//	limit   — page size, default 50, max 500
+//	offset  — entries to skip, newest first
+type AuditHandler struct {
+	audit *audit.Logger
+}
+
+// NewAuditHandler creates a new AuditHandler.
+func NewAuditHandler(al *audit.Logger) *AuditHandler {
+	return &AuditHandler{audit: al}
+}
+
+func (h *AuditHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed,
+			models.NewAPIError("METHOD_NOT_ALLOWED", "Only GET is allowed"))
+		return
+	}
+
+	p := r.URL.Query()
+	q := audit.Query{
+		Action: p.Get("action"),
+		Actor:  p.Get("actor"),
+		IP:     p.Get("ip"),
+		Limit:  auditDefaultLimit,
+	}
+
+	for _, f := range []struct {
+		name string
+		dst  *time.Time
+	}{{"since", &q.Since}, {"until", &q.Until}} {
+		if v := p.Get(f.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				respondError(w, http.StatusBadRequest,
+					models.NewValidationError(f.name, "Must be an RFC3339 timestamp"))
+				return
+			}
+			*f.dst = t
+		}
+	}
+	if v := p.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > auditMaxLimit {
+			respondError(w, http.StatusBadRequest,
+				models.NewValidationError("limit", "Must be between 1 and 500"))
+			return
+		}
+		q.Limit = n
+	}
+	if v := p.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			respondError(w, http.StatusBadRequest,
+				models.NewValidationError("offset", "Must be 0 or greater"))
+			return
+		}
+		q.Offset = n
+	}
+
+	page, err := h.audit.Query(q)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Audit: query failed", "err", err)
+		respondError(w, http.StatusInternalServerError,
+			models.NewAPIError("INTERNAL_ERROR", "Failed to read audit log"))
+		return
+	}
+	respondJSON(w, http.StatusOK, page)
+}
+
+// origin attributes a saved configuration to the admin of r.
+func origin(r *http.Request, action string) config.Origin {
+	return config.Origin{User: auditEntry(r, action).Actor, Action: action}
+}
+
+// auditEntry returns an entry pre-filled with the acting user and client IP.
+func auditEntry(r *http.Request, action string) audit.Entry {
+	e := audit.Entry{Action: action, IP: middleware.ClientIP(r)}
+	if id, ok := middleware.IdentityFromContext(r.Context()); ok {
+		e.Actor = id.Username
+	}
+	return e
+}
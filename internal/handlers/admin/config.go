@@ -1,14 +1,19 @@
 package admin
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"io"
+	"log/slog"
 	"net/http"
 	"time"
 
-	"github.com/phil-bot/rsyslox/internal/cleanup"
+	"github.com/phil-bot/rsyslox/internal/audit"
 	"github.com/phil-bot/rsyslox/internal/config"
+	"github.com/phil-bot/rsyslox/internal/database"
 	"github.com/phil-bot/rsyslox/internal/models"
+	"github.com/phil-bot/rsyslox/internal/reload"
 )
 
 // ConfigView is the safe, sanitized view of the config returned to the frontend.
@@ -16,6 +21,7 @@ type ConfigView struct {
 	Server   ServerView   `json:"server"`
 	Database DatabaseView `json:"database"`
 	Cleanup  CleanupView  `json:"cleanup"`
+	Auth     AuthView     `json:"auth"`
 }
 
 type ServerView struct {
@@ -47,10 +53,36 @@ type CleanupView struct {
 	IntervalSeconds  int     `json:"interval_seconds"`
 }
 
+type AuthView struct {
+	LDAP LDAPView `json:"ldap"`
+}
+
+// LDAPView never contains the bind password; BindPasswordSet tells the
+// frontend whether one is stored.
+type LDAPView struct {
+	Enabled            bool     `json:"enabled"`
+	URL                string   `json:"url"`
+	StartTLS           bool     `json:"start_tls"`
+	InsecureSkipVerify bool     `json:"insecure_skip_verify"`
+	CAFile             string   `json:"ca_file"`
+	TimeoutSeconds     int      `json:"timeout_seconds"`
+	BindDN             string   `json:"bind_dn"`
+	BindPasswordSet    bool     `json:"bind_password_set"`
+	UserBaseDN         string   `json:"user_base_dn"`
+	UserFilter         string   `json:"user_filter"`
+	GroupAttribute     string   `json:"group_attribute"`
+	GroupBaseDN        string   `json:"group_base_dn"`
+	GroupFilter        string   `json:"group_filter"`
+	AdminGroups        []string `json:"admin_groups"`
+	ReadOnlyGroups     []string `json:"read_only_groups"`
+	LocalFallback      bool     `json:"local_fallback"`
+}
+
 type ConfigUpdateRequest struct {
 	Server   *ServerUpdateRequest   `json:"server,omitempty"`
 	Database *DatabaseUpdateRequest `json:"database,omitempty"`
 	Cleanup  *CleanupUpdateRequest  `json:"cleanup,omitempty"`
+	Auth     *AuthUpdateRequest     `json:"auth,omitempty"`
 }
 
 type ServerUpdateRequest struct {
@@ -81,17 +113,60 @@ type CleanupUpdateRequest struct {
 	IntervalSeconds  *int     `json:"interval_seconds,omitempty"`
 }
 
-// ConfigHandler handles GET and PATCH /api/admin/config.
+type AuthUpdateRequest struct {
+	LDAP *LDAPUpdateRequest `json:"ldap,omitempty"`
+}
+
+// LDAPUpdateRequest uses pointers for every field that may legitimately be
+// cleared (empty filter, no CA file, empty group list).
+type LDAPUpdateRequest struct {
+	Enabled            *bool     `json:"enabled,omitempty"`
+	URL                *string   `json:"url,omitempty"`
+	StartTLS           *bool     `json:"start_tls,omitempty"`
+	InsecureSkipVerify *bool     `json:"insecure_skip_verify,omitempty"`
+	CAFile             *string   `json:"ca_file,omitempty"`
+	TimeoutSeconds     *int      `json:"timeout_seconds,omitempty"`
+	BindDN             *string   `json:"bind_dn,omitempty"`
+	BindPassword       string    `json:"bind_password,omitempty"`
+	UserBaseDN         *string   `json:"user_base_dn,omitempty"`
+	UserFilter         *string   `json:"user_filter,omitempty"`
+	GroupAttribute     *string   `json:"group_attribute,omitempty"`
+	GroupBaseDN        *string   `json:"group_base_dn,omitempty"`
+	GroupFilter        *string   `json:"group_filter,omitempty"`
+	AdminGroups        *[]string `json:"admin_groups,omitempty"`
+	ReadOnlyGroups     *[]string `json:"read_only_groups,omitempty"`
+	LocalFallback      *bool     `json:"local_fallback,omitempty"`
+}
+
+// ConfigUpdateResponse is the configuration after a PATCH together with
+// the settings it changed and which of them are in effect.
+type ConfigUpdateResponse struct {
+	ConfigView
+	*reload.Result
+}
+
+// ConfigHandler handles GET and PATCH /api/admin/config and
+// POST /api/admin/config/test-db.
 type ConfigHandler struct {
-	cfg     *config.Config
-	cleaner *cleanup.Cleaner
+	live     *config.Live
+	reloader *reload.Reloader
+	audit    *audit.Logger
 }
 
-func NewConfigHandler(cfg *config.Config, cleaner *cleanup.Cleaner) *ConfigHandler {
-	return &ConfigHandler{cfg: cfg, cleaner: cleaner}
+func NewConfigHandler(live *config.Live, rl *reload.Reloader, al *audit.Logger) *ConfigHandler {
+	return &ConfigHandler{live: live, reloader: rl, audit: al}
 }
 
 func (h *ConfigHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/api/admin/config/test-db" {
+		if r.Method != http.MethodPost {
+			respondError(w, http.StatusMethodNotAllowed,
+				models.NewAPIError("METHOD_NOT_ALLOWED", "Only POST is allowed"))
+			return
+		}
+		h.handleTestDB(w, r)
+		return
+	}
 	switch r.Method {
 	case http.MethodGet:
 		h.handleGet(w, r)
@@ -104,7 +179,7 @@ func (h *ConfigHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *ConfigHandler) handleGet(w http.ResponseWriter, _ *http.Request) {
-	respondJSON(w, http.StatusOK, toConfigView(h.cfg))
+	respondJSON(w, http.StatusOK, toConfigView(h.live.Get()))
 }
 
 func (h *ConfigHandler) handlePatch(w http.ResponseWriter, r *http.Request) {
@@ -115,130 +190,244 @@ func (h *ConfigHandler) handlePatch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The change is applied like a reload: new database settings are
+	// connected to before anything is saved, and the new connection pool
+	// replaces the running one once the configuration is saved.
+	var status int
+	var apiErr *models.APIError
+	res, err := h.reloader.Update(func(next *config.Config) error {
+		if status, apiErr = applyConfigUpdate(next, &req); apiErr != nil {
+			return errUpdateRejected
+		}
+		if err := next.Validate(); err != nil {
+			status = http.StatusBadRequest
+			apiErr = models.NewAPIError(models.ErrCodeInvalidConfig, "Invalid configuration").WithDetails(err.Error())
+			return errUpdateRejected
+		}
+		return nil
+	}, origin(r, audit.ActionConfigUpdate))
+	switch {
+	case errors.Is(err, errUpdateRejected):
+		respondError(w, status, apiErr)
+		return
+	case errors.Is(err, reload.ErrDatabase):
+		slog.WarnContext(r.Context(), "Config update: database connection failed", "err", err)
+		respondError(w, http.StatusBadRequest,
+			models.NewAPIError(models.ErrCodeDatabaseConnection, "The new database settings do not work; nothing was saved").WithDetails(err.Error()))
+		return
+	case err != nil:
+		slog.ErrorContext(r.Context(), "Config update: failed to apply", "err", err)
+		respondError(w, http.StatusInternalServerError,
+			models.NewAPIError("INTERNAL_ERROR", "Failed to save configuration"))
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Admin: configuration updated")
+	e := auditEntry(r, audit.ActionConfigUpdate)
+	e.Changes = res.Changes
+	h.audit.Record(e)
+	respondJSON(w, http.StatusOK, ConfigUpdateResponse{ConfigView: toConfigView(h.live.Get()), Result: res})
+}
+
+// handleTestDB runs the database checklist for the current settings with
+// the fields of the request body replaced, without saving anything. An
+// empty body tests the current settings.
+func (h *ConfigHandler) handleTestDB(w http.ResponseWriter, r *http.Request) {
+	var req DatabaseUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		respondError(w, http.StatusBadRequest,
+			models.NewAPIError(models.ErrCodeInvalidParameter, "Invalid JSON body"))
+		return
+	}
+	next := h.live.Get().Clone()
+	if status, apiErr := applyDatabaseUpdate(&next.Database, &req); apiErr != nil {
+		respondError(w, status, apiErr)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), dbTestTimeout)
+	defer cancel()
+	report := database.Diagnose(ctx, next)
+	if err := report.Err(); err != nil {
+		slog.WarnContext(r.Context(), "Admin: database test failed", "user", next.Database.User, "host", next.Database.Host, "database", next.Database.Name, "err", err)
+	}
+	respondJSON(w, http.StatusOK, report)
+}
+
+// dbTestTimeout bounds the database checklist of test-db.
+const dbTestTimeout = 10 * time.Second
+
+// errUpdateRejected aborts a configuration update whose response has
+// already been decided.
+var errUpdateRejected = errors.New("update rejected")
+
+// applyConfigUpdate copies the set fields of req into cfg.
+// On error it returns the HTTP status.
+func applyConfigUpdate(cfg *config.Config, req *ConfigUpdateRequest) (int, *models.APIError) {
 	if s := req.Server; s != nil {
 		if s.Host != "" {
-			h.cfg.Server.Host = s.Host
+			cfg.Server.Host = s.Host
 		}
 		if s.Port != nil {
 			if *s.Port < 1 || *s.Port > 65535 {
-				respondError(w, http.StatusBadRequest,
-					models.NewValidationError("port", "Must be between 1 and 65535"))
-				return
+				return http.StatusBadRequest, models.NewValidationError("port", "Must be between 1 and 65535")
 			}
-			h.cfg.Server.Port = *s.Port
+			cfg.Server.Port = *s.Port
 		}
 		if len(s.AllowedOrigins) > 0 {
-			h.cfg.Server.AllowedOrigins = s.AllowedOrigins
+			cfg.Server.AllowedOrigins = s.AllowedOrigins
 		}
 		if s.AutoRefreshInterval != nil {
 			if *s.AutoRefreshInterval < 5 {
-				respondError(w, http.StatusBadRequest,
-					models.NewValidationError("auto_refresh_interval", "Minimum interval is 5 seconds"))
-				return
+				return http.StatusBadRequest, models.NewValidationError("auto_refresh_interval", "Minimum interval is 5 seconds")
 			}
-			h.cfg.Server.AutoRefreshInterval = *s.AutoRefreshInterval
+			cfg.Server.AutoRefreshInterval = *s.AutoRefreshInterval
 		}
 		if s.UseSSL != nil {
-			h.cfg.Server.UseSSL = *s.UseSSL
+			cfg.Server.UseSSL = *s.UseSSL
 		}
 		if s.DefaultTimeRange != "" {
-			h.cfg.Server.DefaultTimeRange = s.DefaultTimeRange
+			cfg.Server.DefaultTimeRange = s.DefaultTimeRange
 		}
 		if s.DefaultLanguage != "" {
-			h.cfg.Server.DefaultLanguage = s.DefaultLanguage
+			cfg.Server.DefaultLanguage = s.DefaultLanguage
 		}
 		if s.DefaultFontSize != "" {
-			h.cfg.Server.DefaultFontSize = s.DefaultFontSize
+			cfg.Server.DefaultFontSize = s.DefaultFontSize
 		}
 		if s.DefaultTimeFormat != "" {
-			h.cfg.Server.DefaultTimeFormat = s.DefaultTimeFormat
+			cfg.Server.DefaultTimeFormat = s.DefaultTimeFormat
 		}
 	}
 
 	if d := req.Database; d != nil {
-		if d.Host != "" {
-			h.cfg.Database.Host = d.Host
-		}
-		if d.Port != nil {
-			if *d.Port < 1 || *d.Port > 65535 {
-				respondError(w, http.StatusBadRequest,
-					models.NewValidationError("database.port", "Must be between 1 and 65535"))
-				return
-			}
-			h.cfg.Database.Port = *d.Port
-		}
-		if d.Name != "" {
-			h.cfg.Database.Name = d.Name
-		}
-		if d.User != "" {
-			h.cfg.Database.User = d.User
-		}
-		if d.Password != "" {
-			encrypted, err := config.EncryptPassword(d.Password)
-			if err != nil {
-				respondError(w, http.StatusInternalServerError,
-					models.NewAPIError("INTERNAL_ERROR", "Failed to encrypt password"))
-				return
-			}
-			h.cfg.Database.Password = encrypted
+		if status, apiErr := applyDatabaseUpdate(&cfg.Database, d); apiErr != nil {
+			return status, apiErr
 		}
 	}
 
 	if c := req.Cleanup; c != nil {
 		if c.Enabled != nil {
-			h.cfg.Cleanup.Enabled = *c.Enabled
+			cfg.Cleanup.Enabled = *c.Enabled
 		}
 		if c.DiskPath != "" {
-			h.cfg.Cleanup.DiskPath = c.DiskPath
+			cfg.Cleanup.DiskPath = c.DiskPath
 		}
 		if c.ThresholdPercent != nil {
 			if *c.ThresholdPercent <= 0 || *c.ThresholdPercent > 100 {
-				respondError(w, http.StatusBadRequest,
-					models.NewValidationError("threshold_percent", "Must be between 1 and 100"))
-				return
+				return http.StatusBadRequest, models.NewValidationError("threshold_percent", "Must be between 1 and 100")
 			}
-			h.cfg.Cleanup.ThresholdPercent = *c.ThresholdPercent
+			cfg.Cleanup.ThresholdPercent = *c.ThresholdPercent
 		}
 		if c.BatchSize != nil {
 			if *c.BatchSize <= 0 {
-				respondError(w, http.StatusBadRequest,
-					models.NewValidationError("batch_size", "Must be greater than 0"))
-				return
+				return http.StatusBadRequest, models.NewValidationError("batch_size", "Must be greater than 0")
 			}
-			h.cfg.Cleanup.BatchSize = *c.BatchSize
+			cfg.Cleanup.BatchSize = *c.BatchSize
 		}
 		if c.IntervalSeconds != nil {
 			if *c.IntervalSeconds < 60 {
-				respondError(w, http.StatusBadRequest,
-					models.NewValidationError("interval_seconds", "Minimum interval is 60 seconds"))
-				return
+				return http.StatusBadRequest, models.NewValidationError("interval_seconds", "Minimum interval is 60 seconds")
 			}
-			h.cfg.Cleanup.Interval = time.Duration(*c.IntervalSeconds) * time.Second
+			cfg.Cleanup.Interval = time.Duration(*c.IntervalSeconds) * time.Second
 		}
 	}
 
-	if err := config.Save(h.cfg); err != nil {
-		log.Printf("Config update: failed to save: %v", err)
-		respondError(w, http.StatusInternalServerError,
-			models.NewAPIError("INTERNAL_ERROR", "Failed to save configuration"))
-		return
+	if a := req.Auth; a != nil && a.LDAP != nil {
+		if apiErr := applyLDAPUpdate(&cfg.Auth.LDAP, a.LDAP); apiErr != nil {
+			return http.StatusBadRequest, apiErr
+		}
 	}
+	return 0, nil
+}
 
-	// Propagate cleanup changes to the running goroutine without restart.
-	if req.Cleanup != nil && h.cleaner != nil {
-		h.cleaner.UpdateConfig(cleanup.Config{
-			Enabled:          h.cfg.Cleanup.Enabled,
-			DiskPath:         h.cfg.Cleanup.DiskPath,
-			ThresholdPercent: h.cfg.Cleanup.ThresholdPercent,
-			BatchSize:        h.cfg.Cleanup.BatchSize,
-			Interval:         h.cfg.Cleanup.Interval,
-		})
-		log.Printf("Cleanup: config updated live (enabled=%v, threshold=%.1f%%)",
-			h.cfg.Cleanup.Enabled, h.cfg.Cleanup.ThresholdPercent)
+// applyDatabaseUpdate copies the set fields of u into d. The password is
+// encrypted before it is stored. On error it returns the HTTP status.
+func applyDatabaseUpdate(d *config.DatabaseConfig, u *DatabaseUpdateRequest) (int, *models.APIError) {
+	if u.Host != "" {
+		d.Host = u.Host
+	}
+	if u.Port != nil {
+		if *u.Port < 1 || *u.Port > 65535 {
+			return http.StatusBadRequest, models.NewValidationError("database.port", "Must be between 1 and 65535")
+		}
+		d.Port = *u.Port
+	}
+	if u.Name != "" {
+		d.Name = u.Name
+	}
+	if u.User != "" {
+		d.User = u.User
 	}
+	if u.Password != "" {
+		encrypted, err := config.EncryptPassword(u.Password)
+		if err != nil {
+			return http.StatusInternalServerError, models.NewAPIError("INTERNAL_ERROR", "Failed to encrypt password")
+		}
+		d.Password = encrypted
+	}
+	return 0, nil
+}
 
-	log.Println("Admin: configuration updated")
-	respondJSON(w, http.StatusOK, toConfigView(h.cfg))
+// applyLDAPUpdate copies the set fields of u into l.
+// The bind password is encrypted before it is stored.
+func applyLDAPUpdate(l *config.LDAPConfig, u *LDAPUpdateRequest) *models.APIError {
+	if u.Enabled != nil {
+		l.Enabled = *u.Enabled
+	}
+	if u.URL != nil {
+		l.URL = *u.URL
+	}
+	if u.StartTLS != nil {
+		l.StartTLS = *u.StartTLS
+	}
+	if u.InsecureSkipVerify != nil {
+		l.InsecureSkipVerify = *u.InsecureSkipVerify
+	}
+	if u.CAFile != nil {
+		l.CAFile = *u.CAFile
+	}
+	if u.TimeoutSeconds != nil {
+		if *u.TimeoutSeconds < 1 {
+			return models.NewValidationError("ldap.timeout_seconds", "Must be at least 1 second")
+		}
+		l.Timeout = time.Duration(*u.TimeoutSeconds) * time.Second
+	}
+	if u.BindDN != nil {
+		l.BindDN = *u.BindDN
+	}
+	if u.BindPassword != "" {
+		encrypted, err := config.EncryptPassword(u.BindPassword)
+		if err != nil {
+			return models.NewAPIError("INTERNAL_ERROR", "Failed to encrypt bind password")
+		}
+		l.BindPassword = encrypted
+	}
+	if u.UserBaseDN != nil {
+		l.UserBaseDN = *u.UserBaseDN
+	}
+	if u.UserFilter != nil {
+		l.UserFilter = *u.UserFilter
+	}
+	if u.GroupAttribute != nil {
+		l.GroupAttribute = *u.GroupAttribute
+	}
+	if u.GroupBaseDN != nil {
+		l.GroupBaseDN = *u.GroupBaseDN
+	}
+	if u.GroupFilter != nil {
+		l.GroupFilter = *u.GroupFilter
+	}
+	if u.AdminGroups != nil {
+		l.AdminGroups = *u.AdminGroups
+	}
+	if u.ReadOnlyGroups != nil {
+		l.ReadOnlyGroups = *u.ReadOnlyGroups
+	}
+	if u.LocalFallback != nil {
+		l.LocalFallback = *u.LocalFallback
+	}
+	return nil
 }
 
 func toConfigView(cfg *config.Config) ConfigView {
@@ -269,5 +458,25 @@ func toConfigView(cfg *config.Config) ConfigView {
 			BatchSize:        cfg.Cleanup.BatchSize,
 			IntervalSeconds:  int(cfg.Cleanup.Interval.Seconds()),
 		},
+		Auth: AuthView{
+			LDAP: LDAPView{
+				Enabled:            cfg.Auth.LDAP.Enabled,
+				URL:                cfg.Auth.LDAP.URL,
+				StartTLS:           cfg.Auth.LDAP.StartTLS,
+				InsecureSkipVerify: cfg.Auth.LDAP.InsecureSkipVerify,
+				CAFile:             cfg.Auth.LDAP.CAFile,
+				TimeoutSeconds:     int(cfg.Auth.LDAP.Timeout.Seconds()),
+				BindDN:             cfg.Auth.LDAP.BindDN,
+				BindPasswordSet:    cfg.Auth.LDAP.BindPassword != "",
+				UserBaseDN:         cfg.Auth.LDAP.UserBaseDN,
+				UserFilter:         cfg.Auth.LDAP.UserFilter,
+				GroupAttribute:     cfg.Auth.LDAP.GroupAttribute,
+				GroupBaseDN:        cfg.Auth.LDAP.GroupBaseDN,
+				GroupFilter:        cfg.Auth.LDAP.GroupFilter,
+				AdminGroups:        cfg.Auth.LDAP.AdminGroups,
+				ReadOnlyGroups:     cfg.Auth.LDAP.ReadOnlyGroups,
+				LocalFallback:      cfg.Auth.LDAP.LocalFallback,
+			},
+		},
 	}
 }
@@ -0,0 +1,226 @@
+package admin
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/phil-bot/rsyslox/internal/cleanup"
+	"github.com/phil-bot/rsyslox/internal/config"
+	"github.com/phil-bot/rsyslox/internal/database"
+	"github.com/phil-bot/rsyslox/internal/models"
+	"github.com/phil-bot/rsyslox/internal/tlscert"
+)
+
+// diagnosticsTimeout bounds the database queries of GET /api/admin/diagnostics.
+const diagnosticsTimeout = 5 * time.Second
+
+// startTime is when the process started, for the uptime in diagnostics.
+var startTime = time.Now()
+
+// DiagnosticsHandler handles GET /api/admin/diagnostics: a snapshot of the
+// build, configuration, database, cleanup and TLS state for support.
+type DiagnosticsHandler struct {
+	live    *config.Live
+	db      *database.DB
+	cleaner *cleanup.Cleaner
+	certs   *tlscert.Store
+	version string
+}
+
+// NewDiagnosticsHandler creates a new DiagnosticsHandler.
+func NewDiagnosticsHandler(live *config.Live, db *database.DB, cleaner *cleanup.Cleaner, certs *tlscert.Store, version string) *DiagnosticsHandler {
+	return &DiagnosticsHandler{live: live, db: db, cleaner: cleaner, certs: certs, version: version}
+}
+
+// Diagnostics is the response of GET /api/admin/diagnostics.
+type Diagnostics struct {
+	Build    BuildInfo         `json:"build"`
+	Config   ConfigDiagnostics `json:"config"`
+	Database DBDiagnostics     `json:"database"`
+	Cleanup  *cleanup.Status   `json:"cleanup,omitempty"`
+	TLS      TLSDiagnostics    `json:"tls"`
+}
+
+// BuildInfo describes the running binary.
+type BuildInfo struct {
+	Version    string    `json:"version"`
+	GoVersion  string    `json:"go_version"`
+	OS         string    `json:"os"`
+	Arch       string    `json:"arch"`
+	Revision   string    `json:"vcs_revision,omitempty"`
+	RevisionAt string    `json:"vcs_time,omitempty"`
+	Modified   bool      `json:"vcs_modified,omitempty"`
+	PID        int       `json:"pid"`
+	StartedAt  time.Time `json:"started_at"`
+	UptimeSecs int64     `json:"uptime_seconds"`
+	Goroutines int       `json:"goroutines"`
+}
+
+// ConfigDiagnostics names the config file and the settings taken from the
+// environment instead.
+type ConfigDiagnostics struct {
+	Path         string   `json:"path"`
+	EnvOverrides []string `json:"env_overrides"`
+}
+
+// DBDiagnostics is the state of the database connection. Fields other
+// than Ready and LastError are empty while the database is not connected.
+type DBDiagnostics struct {
+	Ready            bool                   `json:"ready"`
+	LastError        string                 `json:"last_error,omitempty"`
+	Host             string                 `json:"host"`
+	Name             string                 `json:"name"`
+	ServerVersion    string                 `json:"server_version,omitempty"`
+	MariaDB          bool                   `json:"mariadb,omitempty"`
+	PingMillis       *float64               `json:"ping_ms,omitempty"`
+	PingError        string                 `json:"ping_error,omitempty"`
+	PriorityMode     string                 `json:"priority_mode,omitempty"`
+	Columns          []string               `json:"columns"`
+	MissingColumns   []string               `json:"missing_columns"`
+	Indexes          []database.IndexStatus `json:"indexes,omitempty"`
+	IndexError       string                 `json:"index_error,omitempty"`
+	Rows             *int                   `json:"rows,omitempty"`
+	RowsExact        bool                   `json:"rows_exact,omitempty"`
+	Pool             *PoolStats             `json:"pool,omitempty"`
+	MetaCacheEntries int                    `json:"meta_cache_entries"`
+}
+
+// PoolStats is the subset of sql.DBStats useful to spot an exhausted pool.
+type PoolStats struct {
+	MaxOpen        int   `json:"max_open"`
+	Open           int   `json:"open"`
+	InUse          int   `json:"in_use"`
+	Idle           int   `json:"idle"`
+	WaitCount      int64 `json:"wait_count"`
+	WaitMillis     int64 `json:"wait_ms"`
+	MaxIdleClosed  int64 `json:"max_idle_closed"`
+	LifetimeClosed int64 `json:"max_lifetime_closed"`
+}
+
+// TLSDiagnostics describes the certificate being served.
+type TLSDiagnostics struct {
+	Enabled     bool          `json:"enabled"`
+	Certificate *tlscert.Info `json:"certificate,omitempty"`
+	ExpiresDays *int          `json:"expires_in_days,omitempty"` // negative once expired
+}
+
+func (h *DiagnosticsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed,
+			models.NewAPIError("METHOD_NOT_ALLOWED", "Only GET is allowed"))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), diagnosticsTimeout)
+	defer cancel()
+
+	cfg := h.live.Get()
+	d := Diagnostics{
+		Build: h.build(),
+		Config: ConfigDiagnostics{
+			Path:         config.ActiveConfigPath(),
+			EnvOverrides: cfg.EnvOverrides(),
+		},
+		Database: h.database(ctx, cfg),
+		TLS:      h.tls(),
+	}
+	if h.cleaner != nil {
+		st := h.cleaner.Status()
+		d.Cleanup = &st
+	}
+	respondJSON(w, http.StatusOK, d)
+}
+
+func (h *DiagnosticsHandler) build() BuildInfo {
+	b := BuildInfo{
+		Version:    h.version,
+		GoVersion:  runtime.Version(),
+		OS:         runtime.GOOS,
+		Arch:       runtime.GOARCH,
+		PID:        os.Getpid(),
+		StartedAt:  startTime,
+		UptimeSecs: int64(time.Since(startTime).Seconds()),
+		Goroutines: runtime.NumGoroutine(),
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				b.Revision = s.Value
+			case "vcs.time":
+				b.RevisionAt = s.Value
+			case "vcs.modified":
+				b.Modified = s.Value == "true"
+			}
+		}
+	}
+	return b
+}
+
+func (h *DiagnosticsHandler) database(ctx context.Context, cfg *config.Config) DBDiagnostics {
+	pool := h.db.Pool()
+	d := DBDiagnostics{
+		Ready: pool != nil,
+		Host:  cfg.Database.Host,
+		Name:  cfg.Database.Name,
+	}
+	if err := h.db.LastError(); err != nil {
+		d.LastError = err.Error()
+	}
+	if pool == nil {
+		return d
+	}
+
+	d.ServerVersion = pool.Version
+	d.MariaDB = pool.MariaDB
+	d.PriorityMode = pool.PriorityMode.String()
+	d.Columns = pool.AvailableColumns
+	d.MissingColumns = pool.MissingColumns()
+	d.MetaCacheEntries = pool.MetaCache.Len()
+
+	start := time.Now()
+	if err := pool.PingContext(ctx); err != nil {
+		d.PingError = err.Error()
+	} else {
+		ms := float64(time.Since(start).Microseconds()) / 1000
+		d.PingMillis = &ms
+	}
+
+	if status, err := pool.IndexStatus(ctx); err != nil {
+		d.IndexError = err.Error()
+	} else {
+		d.Indexes = status
+	}
+
+	n, exact := pool.DBTotal(ctx)
+	d.Rows, d.RowsExact = &n, exact
+
+	s := pool.Stats()
+	d.Pool = &PoolStats{
+		MaxOpen:        s.MaxOpenConnections,
+		Open:           s.OpenConnections,
+		InUse:          s.InUse,
+		Idle:           s.Idle,
+		WaitCount:      s.WaitCount,
+		WaitMillis:     s.WaitDuration.Milliseconds(),
+		MaxIdleClosed:  s.MaxIdleClosed,
+		LifetimeClosed: s.MaxLifetimeClosed,
+	}
+	return d
+}
+
+func (h *DiagnosticsHandler) tls() TLSDiagnostics {
+	t := TLSDiagnostics{Enabled: h.certs.Loaded()}
+	info := h.certs.Info()
+	if info == nil {
+		return t
+	}
+	days := int(time.Until(info.NotAfter).Hours() / 24)
+	t.Certificate = info
+	t.ExpiresDays = &days
+	return t
+}
@@ -12,10 +12,10 @@ import (
 // DiskHandler handles GET /api/admin/disk.
 // It returns disk usage statistics for the path configured in cleanup.disk_path.
 type DiskHandler struct {
-	cfg *config.Config
+	live *config.Live
 }
 
-func NewDiskHandler(cfg *config.Config) *DiskHandler { return &DiskHandler{cfg: cfg} }
+func NewDiskHandler(live *config.Live) *DiskHandler { return &DiskHandler{live: live} }
 
 type diskResponse struct {
 	Path        string  `json:"path"`
@@ -32,7 +32,7 @@ func (h *DiskHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	path := h.cfg.Cleanup.DiskPath
+	path := h.live.Get().Cleanup.DiskPath
 	if path == "" {
 		path = "/"
 	}
@@ -15,9 +15,11 @@ func respondJSON(w http.ResponseWriter, status int, data interface{}) {
 }
 
 func respondError(w http.ResponseWriter, status int, err *models.APIError) {
+	body := *err
+	body.RequestID = w.Header().Get(models.RequestIDHeader)
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(err)
+	json.NewEncoder(w).Encode(&body)
 }
 
 // extractToken reads a session token from the request headers.
@@ -0,0 +1,242 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/phil-bot/rsyslox/internal/audit"
+	"github.com/phil-bot/rsyslox/internal/config"
+	"github.com/phil-bot/rsyslox/internal/models"
+	"github.com/phil-bot/rsyslox/internal/reload"
+)
+
+// HistoryResponse is returned by GET /api/admin/config/history.
+type HistoryResponse struct {
+	Keep     int              `json:"keep"` // server.config_history; 0 = disabled
+	Versions []config.Version `json:"versions"`
+}
+
+// VersionResponse is one version with its settings, secrets redacted.
+type VersionResponse struct {
+	config.Version
+	Settings map[string]string `json:"settings"`
+}
+
+// DiffResponse lists the differences between two configurations.
+type DiffResponse struct {
+	From    string         `json:"from"` // "current" or a version number
+	To      int            `json:"to"`
+	Changes []audit.Change `json:"changes"`
+}
+
+// RollbackResponse describes an applied rollback. Kept lists the settings
+// that differ in the restored version but were left as they were, see
+// config.KeptOnRestore.
+type RollbackResponse struct {
+	Version int      `json:"version"`
+	Kept    []string `json:"kept"`
+	*reload.Result
+}
+
+// HistoryHandler serves the saved versions of config.toml.
+//
+//	GET  /api/admin/config/history                — versions, newest first
+//	GET  /api/admin/config/history/{n}            — one version, secrets redacted
+//	GET  /api/admin/config/history/{n}/diff       — what a rollback to n changes;
+//	                                                ?from=previous or ?from={m} compares two versions
+//	POST /api/admin/config/rollback/{n}           — restore version n
+type HistoryHandler struct {
+	live     *config.Live
+	reloader *reload.Reloader
+	audit    *audit.Logger
+}
+
+// NewHistoryHandler creates a new HistoryHandler.
+func NewHistoryHandler(live *config.Live, rl *reload.Reloader, al *audit.Logger) *HistoryHandler {
+	return &HistoryHandler{live: live, reloader: rl, audit: al}
+}
+
+func (h *HistoryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if rest, ok := strings.CutPrefix(r.URL.Path, "/api/admin/config/rollback/"); ok {
+		if r.Method != http.MethodPost {
+			respondError(w, http.StatusMethodNotAllowed,
+				models.NewAPIError("METHOD_NOT_ALLOWED", "Only POST is allowed"))
+			return
+		}
+		n, ok := parseVersion(w, rest)
+		if ok {
+			h.handleRollback(w, r, n)
+		}
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed,
+			models.NewAPIError("METHOD_NOT_ALLOWED", "Only GET is allowed"))
+		return
+	}
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/admin/config/history"), "/")
+	if rest == "" {
+		h.handleList(w, r)
+		return
+	}
+	num, diff := strings.CutSuffix(rest, "/diff")
+	n, ok := parseVersion(w, num)
+	if !ok {
+		return
+	}
+	if diff {
+		h.handleDiff(w, r, n)
+		return
+	}
+	h.handleGet(w, n)
+}
+
+func (h *HistoryHandler) handleList(w http.ResponseWriter, r *http.Request) {
+	cfg := h.live.Get()
+	versions, err := config.History(cfg.ConfigPath)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Config history", "err", err)
+		respondError(w, http.StatusInternalServerError,
+			models.NewAPIError("INTERNAL_ERROR", "Failed to read the configuration history"))
+		return
+	}
+	respondJSON(w, http.StatusOK, HistoryResponse{Keep: cfg.Server.ConfigHistory, Versions: versions})
+}
+
+func (h *HistoryHandler) handleGet(w http.ResponseWriter, n int) {
+	cfg, v, err := config.ReadVersion(h.live.Get().ConfigPath, n)
+	if err != nil {
+		respondVersionError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, VersionResponse{Version: *v, Settings: audit.Redact(audit.Snapshot(cfg))})
+}
+
+// handleDiff compares version n with the running configuration, as
+// restored by a rollback, or with an older version.
+func (h *HistoryHandler) handleDiff(w http.ResponseWriter, r *http.Request, n int) {
+	cfg := h.live.Get()
+	resp := DiffResponse{To: n}
+	var from, to *config.Config
+	var err error
+	switch f := r.URL.Query().Get("from"); f {
+	case "", "current":
+		resp.From = "current"
+		from = cfg
+		to, err = config.Restore(cfg, n)
+	default:
+		m, ok := 0, true
+		if f == "previous" {
+			m, ok = h.previousVersion(w, n)
+		} else if m, err = strconv.Atoi(f); err != nil || m < 1 {
+			respondError(w, http.StatusBadRequest,
+				models.NewValidationError("from", `Must be "current", "previous" or a version number`))
+			return
+		}
+		if !ok {
+			return
+		}
+		resp.From = strconv.Itoa(m)
+		if from, _, err = config.ReadVersion(cfg.ConfigPath, m); err == nil {
+			to, _, err = config.ReadVersion(cfg.ConfigPath, n)
+		}
+	}
+	if err != nil {
+		respondVersionError(w, err)
+		return
+	}
+	resp.Changes = audit.Diff(audit.Snapshot(from), audit.Snapshot(to))
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// previousVersion returns the newest version older than n.
+func (h *HistoryHandler) previousVersion(w http.ResponseWriter, n int) (int, bool) {
+	versions, err := config.History(h.live.Get().ConfigPath)
+	if err != nil {
+		respondVersionError(w, err)
+		return 0, false
+	}
+	for _, v := range versions {
+		if v.Version < n {
+			return v.Version, true
+		}
+	}
+	respondError(w, http.StatusNotFound,
+		models.NewAPIError(models.ErrCodeNotFound, fmt.Sprintf("No version before %d", n)))
+	return 0, false
+}
+
+func (h *HistoryHandler) handleRollback(w http.ResponseWriter, r *http.Request, n int) {
+	e := auditEntry(r, audit.ActionConfigRollback)
+	e.Target = strconv.Itoa(n)
+	kept := h.keptOnRollback(n)
+	res, err := h.reloader.Rollback(n, origin(r, audit.ActionConfigRollback))
+	if err != nil {
+		slog.WarnContext(r.Context(), "Config rollback rejected", "version", n, "err", err)
+		e.Outcome = audit.OutcomeFailure
+		e.Details = err.Error()
+		h.audit.Record(e)
+		respondVersionError(w, err)
+		return
+	}
+	slog.InfoContext(r.Context(), "Admin: configuration rolled back", "version", n, "kept", strings.Join(kept, ","))
+	e.Changes = res.Changes
+	h.audit.Record(e)
+	respondJSON(w, http.StatusOK, RollbackResponse{Version: n, Kept: kept, Result: res})
+}
+
+// keptOnRollback returns the fields of config.KeptOnRestore in which
+// version n differs from the running configuration.
+func (h *HistoryHandler) keptOnRollback(n int) []string {
+	cur := h.live.Get()
+	kept := []string{}
+	v, _, err := config.ReadVersion(cur.ConfigPath, n)
+	if err != nil {
+		return kept // the rollback reports the error
+	}
+	for _, c := range audit.Diff(audit.Snapshot(cur), audit.Snapshot(v)) {
+		for _, k := range config.KeptOnRestore {
+			if c.Field == k || strings.HasPrefix(c.Field, k+".") || strings.HasPrefix(c.Field, k+"[") {
+				kept = append(kept, c.Field)
+				break
+			}
+		}
+	}
+	return kept
+}
+
+func parseVersion(w http.ResponseWriter, s string) (int, bool) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		respondError(w, http.StatusNotFound,
+			models.NewAPIError(models.ErrCodeNotFound, "Unknown configuration version: "+s))
+		return 0, false
+	}
+	return n, true
+}
+
+// respondVersionError answers a failed read or rollback of a version:
+// 404 for an unknown version, 400 for one that cannot be used or whose
+// database settings do not work, and 500 for failures to read or save
+// files.
+func respondVersionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, config.ErrVersionNotFound):
+		respondError(w, http.StatusNotFound,
+			models.NewAPIError(models.ErrCodeNotFound, "Configuration version not found"))
+	case errors.Is(err, config.ErrInvalidVersion):
+		respondError(w, http.StatusBadRequest,
+			models.NewAPIError(models.ErrCodeInvalidConfig, "Configuration version cannot be used").WithDetails(err.Error()))
+	case errors.Is(err, reload.ErrDatabase):
+		respondError(w, http.StatusBadRequest,
+			models.NewAPIError(models.ErrCodeDatabaseConnection, "The database settings of this version do not work; nothing was saved").WithDetails(err.Error()))
+	default:
+		respondError(w, http.StatusInternalServerError,
+			models.NewAPIError("INTERNAL_ERROR", "Failed to restore the configuration version"))
+	}
+}
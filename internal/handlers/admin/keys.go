@@ -2,29 +2,59 @@ package admin
 
 import (
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/phil-bot/rsyslox/internal/audit"
 	"github.com/phil-bot/rsyslox/internal/auth"
 	"github.com/phil-bot/rsyslox/internal/config"
 	"github.com/phil-bot/rsyslox/internal/models"
 )
 
 // KeysHandler handles /api/admin/keys endpoints.
+//
+//	GET    /api/admin/keys                — list keys with lifecycle and usage data
+//	POST   /api/admin/keys                — create a key
+//	POST   /api/admin/keys/{name}/rotate  — issue a new secret, old one valid for an overlap window
+//	DELETE /api/admin/keys/{name}         — delete a key
 type KeysHandler struct {
-	cfg *config.Config
+	live  *config.Live
+	mgr   *auth.Manager
+	audit *audit.Logger
 }
 
 // NewKeysHandler creates a new KeysHandler.
-func NewKeysHandler(cfg *config.Config) *KeysHandler {
-	return &KeysHandler{cfg: cfg}
+func NewKeysHandler(live *config.Live, mgr *auth.Manager, al *audit.Logger) *KeysHandler {
+	return &KeysHandler{live: live, mgr: mgr, audit: al}
 }
 
+// Outcomes of a key change that are not saving errors.
+var (
+	errKeyExists   = errors.New("key exists")
+	errKeyNotFound = errors.New("key not found")
+)
+
+// defaultRotateOverlap is how long the old secret keeps working after a
+// rotation when the request does not say otherwise.
+const defaultRotateOverlap = 24 * time.Hour
+
 // KeyResponse is returned for each stored read-only key.
-// The actual key hash is never exposed; only the name.
+// The actual key hash is never exposed.
 type KeyResponse struct {
-	Name string `json:"name"`
+	Name      string     `json:"name"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	CreatedBy string     `json:"created_by,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Expired   bool       `json:"expired"`
+	LastUsed  *time.Time `json:"last_used,omitempty"`
+	LastIP    string     `json:"last_ip,omitempty"`
+
+	// Set while the previous secret of a rotated key is still accepted.
+	PreviousValidUntil *time.Time `json:"previous_valid_until,omitempty"`
 }
 
 // CreateKeyResponse includes the plaintext key, shown exactly once.
@@ -36,11 +66,29 @@ type CreateKeyResponse struct {
 
 // CreateKeyRequest is the payload for POST /api/admin/keys.
 type CreateKeyRequest struct {
-	Name string `json:"name"`
+	Name      string     `json:"name"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // RFC3339; omitted = never
+}
+
+// RotateKeyRequest is the optional payload for POST /api/admin/keys/{name}/rotate.
+type RotateKeyRequest struct {
+	OverlapSeconds *int       `json:"overlap_seconds,omitempty"` // default 86400
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`      // new expiry; omitted = unchanged
 }
 
 // ServeHTTP routes based on method and path suffix.
 func (h *KeysHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// POST /api/admin/keys/{name}/rotate
+	if rest := strings.TrimPrefix(r.URL.Path, "/api/admin/keys/"); strings.HasSuffix(rest, "/rotate") {
+		if r.Method != http.MethodPost {
+			respondError(w, http.StatusMethodNotAllowed,
+				models.NewAPIError("METHOD_NOT_ALLOWED", "Only POST is allowed"))
+			return
+		}
+		h.handleRotate(w, r, strings.TrimSuffix(rest, "/rotate"))
+		return
+	}
+
 	// DELETE /api/admin/keys/{name}
 	if r.Method == http.MethodDelete {
 		name := strings.TrimPrefix(r.URL.Path, "/api/admin/keys/")
@@ -50,7 +98,7 @@ func (h *KeysHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				models.NewAPIError(models.ErrCodeInvalidParameter, "Key name required in path"))
 			return
 		}
-		h.handleDelete(w, name)
+		h.handleDelete(w, r, name)
 		return
 	}
 
@@ -66,9 +114,25 @@ func (h *KeysHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *KeysHandler) handleList(w http.ResponseWriter) {
-	keys := make([]KeyResponse, len(h.cfg.Auth.ReadOnlyKeys))
-	for i, k := range h.cfg.Auth.ReadOnlyKeys {
-		keys[i] = KeyResponse{Name: k.Name}
+	now := time.Now()
+	cfg := h.live.Get()
+	keys := make([]KeyResponse, len(cfg.Auth.ReadOnlyKeys))
+	for i, k := range cfg.Auth.ReadOnlyKeys {
+		kr := KeyResponse{
+			Name:      k.Name,
+			CreatedAt: timeOrNil(k.CreatedAt),
+			CreatedBy: k.CreatedBy,
+			ExpiresAt: timeOrNil(k.ExpiresAt),
+			Expired:   auth.KeyExpired(k, now),
+		}
+		if k.PreviousKeyHash != "" && now.Before(k.PreviousExpiresAt) {
+			kr.PreviousValidUntil = timeOrNil(k.PreviousExpiresAt)
+		}
+		if u, ok := h.mgr.KeyUsage().Get(k.Name); ok {
+			kr.LastUsed = timeOrNil(u.LastUsed)
+			kr.LastIP = u.LastIP
+		}
+		keys[i] = kr
 	}
 	respondJSON(w, http.StatusOK, keys)
 }
@@ -88,36 +152,57 @@ func (h *KeysHandler) handleCreate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check for duplicate names
-	for _, k := range h.cfg.Auth.ReadOnlyKeys {
-		if k.Name == req.Name {
-			respondError(w, http.StatusConflict,
-				models.NewAPIError("CONFLICT", "A key with this name already exists"))
-			return
-		}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		respondError(w, http.StatusBadRequest,
+			models.NewValidationError("expires_at", "Must be in the future"))
+		return
 	}
 
 	plaintext, hash, err := auth.GenerateReadOnlyKey()
 	if err != nil {
-		log.Printf("Keys: failed to generate key: %v", err)
+		slog.ErrorContext(r.Context(), "Keys: failed to generate key", "err", err)
 		respondError(w, http.StatusInternalServerError,
 			models.NewAPIError("INTERNAL_ERROR", "Failed to generate key"))
 		return
 	}
 
-	h.cfg.Auth.ReadOnlyKeys = append(h.cfg.Auth.ReadOnlyKeys, config.ReadOnlyKey{
-		Name:    req.Name,
-		KeyHash: hash,
+	key := config.ReadOnlyKey{
+		Name:      req.Name,
+		KeyHash:   hash,
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+		CreatedBy: auditEntry(r, "").Actor,
+	}
+	if req.ExpiresAt != nil {
+		key.ExpiresAt = req.ExpiresAt.UTC()
+	}
+	err = h.live.Update(func(next *config.Config) error {
+		for _, k := range next.Auth.ReadOnlyKeys {
+			if k.Name == req.Name {
+				return errKeyExists
+			}
+		}
+		next.Auth.ReadOnlyKeys = append(next.Auth.ReadOnlyKeys, key)
+		return config.Save(next, origin(r, audit.ActionKeyCreate))
 	})
-
-	if err := config.Save(h.cfg); err != nil {
-		log.Printf("Keys: failed to save config: %v", err)
+	if errors.Is(err, errKeyExists) {
+		respondError(w, http.StatusConflict,
+			models.NewAPIError("CONFLICT", "A key with this name already exists"))
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Keys: failed to save config", "err", err)
 		respondError(w, http.StatusInternalServerError,
 			models.NewAPIError("INTERNAL_ERROR", "Failed to save configuration"))
 		return
 	}
 
-	log.Printf("Admin: created read-only key %q", req.Name)
+	slog.InfoContext(r.Context(), "Admin: created read-only key", "key", req.Name)
+	e := auditEntry(r, audit.ActionKeyCreate)
+	e.Target = req.Name
+	if req.ExpiresAt != nil {
+		e.Details = "expires " + key.ExpiresAt.Format(time.RFC3339)
+	}
+	h.audit.Record(e)
 	respondJSON(w, http.StatusCreated, CreateKeyResponse{
 		Name:    req.Name,
 		Key:     plaintext,
@@ -125,32 +210,128 @@ func (h *KeysHandler) handleCreate(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func (h *KeysHandler) handleDelete(w http.ResponseWriter, name string) {
-	found := false
-	filtered := h.cfg.Auth.ReadOnlyKeys[:0]
-	for _, k := range h.cfg.Auth.ReadOnlyKeys {
-		if k.Name == name {
-			found = true
-			continue
+func (h *KeysHandler) handleDelete(w http.ResponseWriter, r *http.Request, name string) {
+	err := h.live.Update(func(next *config.Config) error {
+		found := false
+		filtered := next.Auth.ReadOnlyKeys[:0]
+		for _, k := range next.Auth.ReadOnlyKeys {
+			if k.Name == name {
+				found = true
+				continue
+			}
+			filtered = append(filtered, k)
 		}
-		filtered = append(filtered, k)
-	}
-
-	if !found {
+		if !found {
+			return errKeyNotFound
+		}
+		next.Auth.ReadOnlyKeys = filtered
+		return config.Save(next, origin(r, audit.ActionKeyDelete))
+	})
+	if errors.Is(err, errKeyNotFound) {
 		respondError(w, http.StatusNotFound,
 			models.NewAPIError(models.ErrCodeNotFound, "Key not found: "+name))
 		return
 	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Keys: failed to save config", "err", err)
+		respondError(w, http.StatusInternalServerError,
+			models.NewAPIError("INTERNAL_ERROR", "Failed to save configuration"))
+		return
+	}
+
+	h.mgr.KeyUsage().Forget(name)
+	slog.InfoContext(r.Context(), "Admin: deleted read-only key", "key", name)
+	e := auditEntry(r, audit.ActionKeyDelete)
+	e.Target = name
+	h.audit.Record(e)
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Key deleted"})
+}
+
+func (h *KeysHandler) handleRotate(w http.ResponseWriter, r *http.Request, name string) {
+	var req RotateKeyRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest,
+				models.NewAPIError(models.ErrCodeInvalidParameter, "Invalid JSON body"))
+			return
+		}
+	}
+
+	overlap := defaultRotateOverlap
+	if req.OverlapSeconds != nil {
+		if *req.OverlapSeconds < 0 {
+			respondError(w, http.StatusBadRequest,
+				models.NewValidationError("overlap_seconds", "Must be 0 or greater"))
+			return
+		}
+		overlap = time.Duration(*req.OverlapSeconds) * time.Second
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		respondError(w, http.StatusBadRequest,
+			models.NewValidationError("expires_at", "Must be in the future"))
+		return
+	}
 
-	h.cfg.Auth.ReadOnlyKeys = filtered
+	plaintext, hash, err := auth.GenerateReadOnlyKey()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Keys: failed to generate key", "err", err)
+		respondError(w, http.StatusInternalServerError,
+			models.NewAPIError("INTERNAL_ERROR", "Failed to generate key"))
+		return
+	}
 
-	if err := config.Save(h.cfg); err != nil {
-		log.Printf("Keys: failed to save config: %v", err)
+	err = h.live.Update(func(next *config.Config) error {
+		var key *config.ReadOnlyKey
+		for i := range next.Auth.ReadOnlyKeys {
+			if next.Auth.ReadOnlyKeys[i].Name == name {
+				key = &next.Auth.ReadOnlyKeys[i]
+				break
+			}
+		}
+		if key == nil {
+			return errKeyNotFound
+		}
+		if overlap > 0 {
+			key.PreviousKeyHash = key.KeyHash
+			key.PreviousExpiresAt = time.Now().Add(overlap).UTC().Truncate(time.Second)
+		} else {
+			key.PreviousKeyHash = ""
+			key.PreviousExpiresAt = time.Time{}
+		}
+		key.KeyHash = hash
+		if req.ExpiresAt != nil {
+			key.ExpiresAt = req.ExpiresAt.UTC()
+		}
+		return config.Save(next, origin(r, audit.ActionKeyRotate))
+	})
+	if errors.Is(err, errKeyNotFound) {
+		respondError(w, http.StatusNotFound,
+			models.NewAPIError(models.ErrCodeNotFound, "Key not found: "+name))
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Keys: failed to save config", "err", err)
 		respondError(w, http.StatusInternalServerError,
 			models.NewAPIError("INTERNAL_ERROR", "Failed to save configuration"))
 		return
 	}
 
-	log.Printf("Admin: deleted read-only key %q", name)
-	respondJSON(w, http.StatusOK, map[string]string{"message": "Key deleted"})
+	slog.InfoContext(r.Context(), "Admin: rotated read-only key", "key", name, "overlap", overlap.String())
+	e := auditEntry(r, audit.ActionKeyRotate)
+	e.Target = name
+	e.Details = fmt.Sprintf("old secret valid for %s", overlap)
+	h.audit.Record(e)
+	respondJSON(w, http.StatusOK, CreateKeyResponse{
+		Name:    name,
+		Key:     plaintext,
+		Message: fmt.Sprintf("Store this key securely — it will not be shown again. The previous key keeps working for %s.", overlap),
+	})
+}
+
+// timeOrNil returns nil for the zero time so it is omitted from JSON.
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
 }
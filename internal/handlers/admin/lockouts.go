@@ -0,0 +1,59 @@
+package admin
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/phil-bot/rsyslox/internal/audit"
+	"github.com/phil-bot/rsyslox/internal/auth"
+	"github.com/phil-bot/rsyslox/internal/models"
+)
+
+// LockoutsHandler shows and lifts login lockouts.
+//
+//	GET    /api/admin/lockouts       — current failures and lockouts
+//	DELETE /api/admin/lockouts       — clear all, including the global lockout
+//	DELETE /api/admin/lockouts/{ip}  — clear one client IP
+type LockoutsHandler struct {
+	limiter *auth.LoginLimiter
+	audit   *audit.Logger
+}
+
+// NewLockoutsHandler creates a new LockoutsHandler.
+func NewLockoutsHandler(limiter *auth.LoginLimiter, al *audit.Logger) *LockoutsHandler {
+	return &LockoutsHandler{limiter: limiter, audit: al}
+}
+
+func (h *LockoutsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ip := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/admin/lockouts"), "/")
+
+	switch {
+	case ip == "" && r.Method == http.MethodGet:
+		respondJSON(w, http.StatusOK, h.limiter.Status())
+
+	case ip == "" && r.Method == http.MethodDelete:
+		h.limiter.ClearAll()
+		slog.InfoContext(r.Context(), "Admin: all login lockouts cleared")
+		e := auditEntry(r, audit.ActionLockoutClear)
+		e.Target = "*"
+		h.audit.Record(e)
+		respondJSON(w, http.StatusOK, map[string]string{"message": "All lockouts cleared"})
+
+	case ip != "" && r.Method == http.MethodDelete:
+		if !h.limiter.Clear(ip) {
+			respondError(w, http.StatusNotFound,
+				models.NewAPIError(models.ErrCodeNotFound, "No failed logins recorded for "+ip))
+			return
+		}
+		slog.InfoContext(r.Context(), "Admin: login lockout cleared", "ip", ip)
+		e := auditEntry(r, audit.ActionLockoutClear)
+		e.Target = ip
+		h.audit.Record(e)
+		respondJSON(w, http.StatusOK, map[string]string{"message": "Lockout cleared for " + ip})
+
+	default:
+		respondError(w, http.StatusMethodNotAllowed,
+			models.NewAPIError("METHOD_NOT_ALLOWED", "Method not allowed for this endpoint"))
+	}
+}
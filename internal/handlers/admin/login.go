@@ -2,32 +2,58 @@ package admin
 
 import (
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/phil-bot/rsyslox/internal/audit"
 	"github.com/phil-bot/rsyslox/internal/auth"
+	"github.com/phil-bot/rsyslox/internal/config"
+	"github.com/phil-bot/rsyslox/internal/middleware"
 	"github.com/phil-bot/rsyslox/internal/models"
 )
 
 // LoginRequest is the payload for POST /api/admin/login.
+//
+// Step 1: username (optional, defaults to the local admin account) and password.
+// Step 2 (only when TOTP is enabled): pending_token from step 1 and the
+// current TOTP code or an unused recovery code.
 type LoginRequest struct {
-	Password string `json:"password"`
+	Username     string `json:"username,omitempty"`
+	Password     string `json:"password,omitempty"`
+	PendingToken string `json:"pending_token,omitempty"`
+	Code         string `json:"code,omitempty"`
 }
 
 // LoginResponse is returned on successful authentication.
+// When a second factor is required, only TwoFactorRequired and
+// PendingToken are set.
 type LoginResponse struct {
-	Token string `json:"token"`
+	Token             string `json:"token,omitempty"`
+	Username          string `json:"username,omitempty"`
+	Role              string `json:"role,omitempty"` // "admin" | "readonly"
+	TwoFactorRequired bool   `json:"two_factor_required,omitempty"`
+	PendingToken      string `json:"pending_token,omitempty"`
 }
 
 // LoginHandler handles admin login requests.
+// Failed password and second-factor attempts are counted by limiter;
+// locked-out clients receive 429 with a Retry-After header.
 type LoginHandler struct {
-	mgr   *auth.Manager
-	store *auth.SessionStore
+	live    *config.Live
+	mgr     *auth.Manager
+	store   *auth.SessionStore
+	limiter *auth.LoginLimiter
+	audit   *audit.Logger
 }
 
 // NewLoginHandler creates a new LoginHandler.
-func NewLoginHandler(mgr *auth.Manager, store *auth.SessionStore) *LoginHandler {
-	return &LoginHandler{mgr: mgr, store: store}
+func NewLoginHandler(live *config.Live, mgr *auth.Manager, store *auth.SessionStore, limiter *auth.LoginLimiter, al *audit.Logger) *LoginHandler {
+	return &LoginHandler{live: live, mgr: mgr, store: store, limiter: limiter, audit: al}
 }
 
 // ServeHTTP handles POST /api/admin/login.
@@ -38,6 +64,12 @@ func (h *LoginHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ip := middleware.ClientIP(r)
+	if wait := h.limiter.Check(ip); wait > 0 {
+		respondLockedOut(w, wait)
+		return
+	}
+
 	var req LoginRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondError(w, http.StatusBadRequest,
@@ -45,33 +77,139 @@ func (h *LoginHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !h.mgr.VerifyAdminPassword(req.Password) {
+	if req.PendingToken != "" {
+		h.handleSecondFactor(w, r, req, ip)
+		return
+	}
+
+	username := strings.TrimSpace(req.Username)
+	id, err := h.mgr.Authenticate(username, req.Password)
+	if err != nil {
+		h.recordFailure(r, ip, username, "password")
 		// Use constant-time-safe generic message to avoid user enumeration
 		respondError(w, http.StatusUnauthorized,
 			models.NewAPIError(models.ErrCodeUnauthorized, "Invalid credentials"))
 		return
 	}
 
-	token, err := h.store.Create()
+	// The TOTP factor protects the local admin account; directory users
+	// are expected to be covered by their directory's own policies.
+	if id.Source == "local" && h.mgr.TOTPEnabled() {
+		pending, err := h.store.CreatePending(*id)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Login: failed to create pending login", "err", err)
+			respondError(w, http.StatusInternalServerError,
+				models.NewAPIError("INTERNAL_ERROR", "Failed to create session"))
+			return
+		}
+		respondJSON(w, http.StatusOK, LoginResponse{
+			TwoFactorRequired: true,
+			PendingToken:      pending,
+		})
+		return
+	}
+
+	h.createSession(w, r, *id, ip)
+}
+
+// handleSecondFactor completes a login started with a correct password.
+func (h *LoginHandler) handleSecondFactor(w http.ResponseWriter, r *http.Request, req LoginRequest, ip string) {
+	id, ok := h.store.PendingIdentity(req.PendingToken)
+	if !ok {
+		respondError(w, http.StatusUnauthorized,
+			models.NewAPIError(models.ErrCodeUnauthorized, "Login expired, please start again"))
+		return
+	}
+
+	usedRecovery, err := h.mgr.VerifySecondFactor(req.Code, func(next *config.Config) error {
+		return config.Save(next, config.Origin{User: id.Username, Action: audit.ActionLogin})
+	})
+	if errors.Is(err, auth.ErrInvalidCredentials) {
+		h.recordFailure(r, ip, id.Username, "second factor")
+		respondError(w, http.StatusUnauthorized,
+			models.NewAPIError(models.ErrCodeUnauthorized, "Invalid code"))
+		return
+	}
+	if err != nil {
+		// Includes a used recovery code that could not be saved: it must
+		// not count, or it would be valid again after a restart.
+		slog.ErrorContext(r.Context(), "Login: second factor check failed", "err", err)
+		respondError(w, http.StatusInternalServerError,
+			models.NewAPIError("INTERNAL_ERROR", "Failed to verify code"))
+		return
+	}
+	h.store.CompletePending(req.PendingToken)
+
+	if usedRecovery {
+		slog.InfoContext(r.Context(), "Login: recovery code used",
+			"user", id.Username, "remaining", len(h.live.Get().Auth.TOTPRecoveryCodes))
+	}
+
+	h.createSession(w, r, id, ip)
+}
+
+// createSession issues a session token for id and writes the login response.
+func (h *LoginHandler) createSession(w http.ResponseWriter, r *http.Request, id auth.Identity, ip string) {
+	token, err := h.store.Create(id, ip, r.UserAgent())
 	if err != nil {
-		log.Printf("Login: failed to create session: %v", err)
+		slog.ErrorContext(r.Context(), "Login: failed to create session", "err", err)
 		respondError(w, http.StatusInternalServerError,
 			models.NewAPIError("INTERNAL_ERROR", "Failed to create session"))
 		return
 	}
 
-	log.Println("Admin login successful")
-	respondJSON(w, http.StatusOK, LoginResponse{Token: token})
+	h.limiter.Succeed(ip)
+	slog.InfoContext(r.Context(), "Login successful", "user", id.Username, "source", id.Source, "role", id.Role.String(), "ip", ip)
+	e := auditEntry(r, audit.ActionLogin)
+	e.Actor = id.Username
+	e.Details = fmt.Sprintf("source=%s role=%s", id.Source, id.Role)
+	h.audit.Record(e)
+	respondJSON(w, http.StatusOK, LoginResponse{
+		Token:    token,
+		Username: id.Username,
+		Role:     id.Role.String(),
+	})
+}
+
+// recordFailure counts a failed attempt, logs it and writes an audit entry.
+func (h *LoginHandler) recordFailure(r *http.Request, ip, username, step string) {
+	if username == "" {
+		username = auth.LocalAdminUser
+	}
+	failures, lockout := h.limiter.Fail(ip)
+	slog.WarnContext(r.Context(), "Login failed",
+		"step", step, "user", username, "ip", ip, "failures", failures)
+	e := auditEntry(r, audit.ActionLoginFailed)
+	e.Actor = username
+	e.Outcome = audit.OutcomeFailure
+	e.Details = step
+	h.audit.Record(e)
+	if lockout > 0 {
+		slog.WarnContext(r.Context(), "Login locked", "ip", ip, "lockout", lockout.String())
+	}
+	if h.limiter.GlobalLocked() {
+		slog.WarnContext(r.Context(), "Too many failed logins from all clients, login paused", "lockout", h.live.Get().Auth.Lockout.GlobalLockout.String())
+	}
+}
+
+// respondLockedOut writes 429 with a Retry-After header in whole seconds.
+func respondLockedOut(w http.ResponseWriter, wait time.Duration) {
+	secs := int(math.Ceil(wait.Seconds()))
+	w.Header().Set("Retry-After", fmt.Sprint(secs))
+	respondError(w, http.StatusTooManyRequests,
+		models.NewAPIError(models.ErrCodeTooManyRequests, "Too many failed login attempts, try again later").
+			WithDetails(fmt.Sprintf("retry after %d seconds", secs)))
 }
 
 // LogoutHandler handles POST /api/admin/logout.
 type LogoutHandler struct {
 	store *auth.SessionStore
+	audit *audit.Logger
 }
 
 // NewLogoutHandler creates a new LogoutHandler.
-func NewLogoutHandler(store *auth.SessionStore) *LogoutHandler {
-	return &LogoutHandler{store: store}
+func NewLogoutHandler(store *auth.SessionStore, al *audit.Logger) *LogoutHandler {
+	return &LogoutHandler{store: store, audit: al}
 }
 
 // ServeHTTP handles POST /api/admin/logout.
@@ -86,6 +224,7 @@ func (h *LogoutHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if token != "" {
 		h.store.Revoke(token)
 	}
+	h.audit.Record(auditEntry(r, audit.ActionLogout))
 
 	respondJSON(w, http.StatusOK, map[string]string{"message": "Logged out"})
 }
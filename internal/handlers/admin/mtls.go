@@ -0,0 +1,78 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/phil-bot/rsyslox/internal/auth"
+	"github.com/phil-bot/rsyslox/internal/config"
+	"github.com/phil-bot/rsyslox/internal/models"
+	"github.com/phil-bot/rsyslox/internal/tlscert"
+)
+
+// MTLSHandler handles GET /api/admin/mtls.
+// It lists the client certificate mappings of auth.mtls together with the
+// CAs they are verified against. Mappings are edited in config.toml.
+type MTLSHandler struct {
+	live *config.Live
+}
+
+func NewMTLSHandler(live *config.Live) *MTLSHandler { return &MTLSHandler{live: live} }
+
+// MTLSStatus is the response of GET /api/admin/mtls.
+type MTLSStatus struct {
+	Enabled  bool                 `json:"enabled"`
+	Required bool                 `json:"required"`
+	ClientCA string               `json:"client_ca"`
+	CAs      []*tlscert.Info      `json:"cas"`             // certificates in client_ca
+	Error    string               `json:"error,omitempty"` // why client_ca could not be read
+	Mappings []config.CertMapping `json:"mappings"`
+
+	// The certificate the caller connected with, if any, to help write
+	// a mapping for it.
+	ClientCert *ClientCertInfo `json:"client_certificate,omitempty"`
+}
+
+// ClientCertInfo describes a client certificate and the mapping it matches.
+type ClientCertInfo struct {
+	Subject string   `json:"subject"`
+	SANs    []string `json:"sans"`
+	Mapping string   `json:"mapping,omitempty"`
+}
+
+func (h *MTLSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed,
+			models.NewAPIError("METHOD_NOT_ALLOWED", "Only GET is allowed"))
+		return
+	}
+
+	m := h.live.Get().Auth.MTLS
+	status := MTLSStatus{
+		Enabled:  m.Enabled,
+		Required: m.Required,
+		ClientCA: m.ClientCA,
+		CAs:      []*tlscert.Info{},
+		Mappings: m.Mappings,
+	}
+	if status.Mappings == nil {
+		status.Mappings = []config.CertMapping{}
+	}
+	if m.ClientCA != "" {
+		cas, err := tlscert.ReadCAs(m.ClientCA)
+		if err != nil {
+			status.Error = err.Error()
+		}
+		for _, c := range cas {
+			status.CAs = append(status.CAs, tlscert.NewInfo(c))
+		}
+	}
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		leaf := r.TLS.PeerCertificates[0]
+		status.ClientCert = &ClientCertInfo{Subject: leaf.Subject.String(), SANs: auth.CertSANs(leaf)}
+		if mp, ok := auth.MatchCertMapping(m.Mappings, leaf); ok {
+			status.ClientCert.Mapping = mp.Name
+		}
+	}
+
+	respondJSON(w, http.StatusOK, status)
+}
@@ -0,0 +1,47 @@
+package admin
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/phil-bot/rsyslox/internal/audit"
+	"github.com/phil-bot/rsyslox/internal/models"
+	"github.com/phil-bot/rsyslox/internal/reload"
+)
+
+// ReloadHandler handles POST /api/admin/config/reload.
+// It re-reads config.toml — e.g. after it was edited by hand or by a
+// configuration management tool — and applies it without a restart.
+type ReloadHandler struct {
+	reloader *reload.Reloader
+	audit    *audit.Logger
+}
+
+// NewReloadHandler creates a new ReloadHandler.
+func NewReloadHandler(rl *reload.Reloader, al *audit.Logger) *ReloadHandler {
+	return &ReloadHandler{reloader: rl, audit: al}
+}
+
+func (h *ReloadHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed,
+			models.NewAPIError("METHOD_NOT_ALLOWED", "Only POST is allowed"))
+		return
+	}
+
+	e := auditEntry(r, audit.ActionConfigReload)
+	res, err := h.reloader.Reload()
+	if err != nil {
+		slog.WarnContext(r.Context(), "Config reload rejected", "err", err)
+		e.Outcome = audit.OutcomeFailure
+		e.Details = err.Error()
+		h.audit.Record(e)
+		respondError(w, http.StatusBadRequest,
+			models.NewAPIError(models.ErrCodeInvalidConfig, "Configuration not reloaded").WithDetails(err.Error()))
+		return
+	}
+
+	e.Changes = res.Changes
+	h.audit.Record(e)
+	respondJSON(w, http.StatusOK, res)
+}
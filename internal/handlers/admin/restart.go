@@ -1,21 +1,25 @@
 package admin
 
 import (
-	"log"
+	"log/slog"
 	"net/http"
-	"os"
-	"syscall"
-	"time"
 
+	"github.com/phil-bot/rsyslox/internal/audit"
 	"github.com/phil-bot/rsyslox/internal/models"
 )
 
 // RestartHandler handles POST /api/admin/restart.
-// It responds immediately, then replaces the current process with a fresh
-// instance of itself via syscall.Exec — no external process manager required.
-type RestartHandler struct{}
+// It responds immediately, then asks the server to restart: in-flight
+// requests are drained and the process re-executes itself, taking over the
+// listening socket — no external process manager required.
+type RestartHandler struct {
+	audit   *audit.Logger
+	restart func()
+}
 
-func NewRestartHandler() *RestartHandler { return &RestartHandler{} }
+func NewRestartHandler(al *audit.Logger, restart func()) *RestartHandler {
+	return &RestartHandler{audit: al, restart: restart}
+}
 
 func (h *RestartHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -24,28 +28,14 @@ func (h *RestartHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	h.audit.Record(auditEntry(r, audit.ActionRestart))
+
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.Header().Set("Connection", "close")
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(`{"status":"restarting"}`))
-	if f, ok := w.(http.Flusher); ok {
-		f.Flush()
-	}
 
-	log.Println("Admin: restart requested — re-executing process in 600ms")
-	go func() {
-		time.Sleep(600 * time.Millisecond)
-
-		exe, err := os.Executable()
-		if err != nil {
-			log.Printf("Admin: restart failed — could not find executable: %v", err)
-			return
-		}
-
-		log.Printf("Admin: exec %s %v", exe, os.Args)
-		if err := syscall.Exec(exe, os.Args, os.Environ()); err != nil {
-			log.Printf("Admin: restart failed — exec error: %v", err)
-		}
-	}()
+	// The server waits for this request to finish before it restarts.
+	slog.InfoContext(r.Context(), "Admin: restart requested")
+	h.restart()
 }
-
@@ -0,0 +1,63 @@
+package admin
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/phil-bot/rsyslox/internal/audit"
+	"github.com/phil-bot/rsyslox/internal/auth"
+	"github.com/phil-bot/rsyslox/internal/models"
+)
+
+// SessionsHandler lists and revokes admin UI sessions.
+//
+//	GET    /api/admin/sessions       — active sessions, current one flagged
+//	DELETE /api/admin/sessions       — revoke all sessions except the current one
+//	DELETE /api/admin/sessions/{id}  — revoke one session
+type SessionsHandler struct {
+	store *auth.SessionStore
+	audit *audit.Logger
+}
+
+// NewSessionsHandler creates a new SessionsHandler.
+func NewSessionsHandler(store *auth.SessionStore, al *audit.Logger) *SessionsHandler {
+	return &SessionsHandler{store: store, audit: al}
+}
+
+func (h *SessionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/admin/sessions"), "/")
+
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		respondJSON(w, http.StatusOK, h.store.List(extractToken(r)))
+
+	case id == "" && r.Method == http.MethodDelete:
+		n := h.store.RevokeOthers(extractToken(r))
+		slog.InfoContext(r.Context(), "Admin: revoked other sessions", "sessions", n)
+		e := auditEntry(r, audit.ActionSessionRevoke)
+		e.Target = "*"
+		e.Details = fmt.Sprintf("%d session(s)", n)
+		h.audit.Record(e)
+		respondJSON(w, http.StatusOK, map[string]string{
+			"message": fmt.Sprintf("%d session(s) revoked", n),
+		})
+
+	case id != "" && r.Method == http.MethodDelete:
+		if !h.store.RevokeID(id) {
+			respondError(w, http.StatusNotFound,
+				models.NewAPIError(models.ErrCodeNotFound, "Session not found"))
+			return
+		}
+		slog.InfoContext(r.Context(), "Admin: session revoked", "session", id)
+		e := auditEntry(r, audit.ActionSessionRevoke)
+		e.Target = id
+		h.audit.Record(e)
+		respondJSON(w, http.StatusOK, map[string]string{"message": "Session revoked"})
+
+	default:
+		respondError(w, http.StatusMethodNotAllowed,
+			models.NewAPIError("METHOD_NOT_ALLOWED", "Method not allowed for this endpoint"))
+	}
+}
@@ -8,8 +8,9 @@ import (
 	"crypto/x509/pkix"
 	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"io"
-	"log"
+	"log/slog"
 	"math/big"
 	"net"
 	"net/http"
@@ -17,23 +18,48 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/phil-bot/rsyslox/internal/audit"
 	"github.com/phil-bot/rsyslox/internal/config"
 	"github.com/phil-bot/rsyslox/internal/models"
+	"github.com/phil-bot/rsyslox/internal/tlscert"
 )
 
 // SSLHandler handles SSL certificate management.
+// GET  /api/admin/ssl           — metadata of the configured certificate
 // POST /api/admin/ssl/generate  — generate a self-signed certificate
 // POST /api/admin/ssl/upload    — upload a custom cert + key (multipart/form-data)
+// New certificates are served immediately when the server runs with TLS.
 type SSLHandler struct {
-	cfg *config.Config
+	live  *config.Live
+	certs *tlscert.Store
+	audit *audit.Logger
 }
 
-func NewSSLHandler(cfg *config.Config) *SSLHandler {
-	return &SSLHandler{cfg: cfg}
+func NewSSLHandler(live *config.Live, certs *tlscert.Store, al *audit.Logger) *SSLHandler {
+	return &SSLHandler{live: live, certs: certs, audit: al}
+}
+
+// SSLStatus is the response of GET /api/admin/ssl.
+type SSLStatus struct {
+	CertPath    string        `json:"cert_path"`
+	KeyPath     string        `json:"key_path"`
+	InUse       bool          `json:"in_use"`          // served by the running server
+	Certificate *tlscert.Info `json:"certificate"`     // null when the file is missing or unreadable
+	Error       string        `json:"error,omitempty"` // why Certificate is null
+
+	// Certificates obtained via ACME, one per domain; omitted without ACME.
+	ACME []tlscert.DomainInfo `json:"acme,omitempty"`
 }
 
 func (h *SSLHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	switch r.URL.Path {
+	case "/api/admin/ssl", "/api/admin/ssl/":
+		if r.Method != http.MethodGet {
+			respondError(w, http.StatusMethodNotAllowed,
+				models.NewAPIError("METHOD_NOT_ALLOWED", "Only GET is allowed"))
+			return
+		}
+		h.handleStatus(w, r)
 	case "/api/admin/ssl/generate":
 		if r.Method != http.MethodPost {
 			respondError(w, http.StatusMethodNotAllowed,
@@ -56,9 +82,10 @@ func (h *SSLHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 // handleGenerate creates a self-signed ECDSA P-256 certificate valid for 10 years
 // and writes it to the configured cert/key paths.
-func (h *SSLHandler) handleGenerate(w http.ResponseWriter, _ *http.Request) {
-	certPath := h.cfg.Server.SSLCertFile
-	keyPath  := h.cfg.Server.SSLKeyFile
+func (h *SSLHandler) handleGenerate(w http.ResponseWriter, r *http.Request) {
+	cfg := h.live.Get()
+	certPath := cfg.Server.SSLCertFile
+	keyPath  := cfg.Server.SSLKeyFile
 
 	if certPath == "" {
 		certPath = "/etc/rsyslox/certs/cert.pem"
@@ -147,8 +174,16 @@ func (h *SSLHandler) handleGenerate(w http.ResponseWriter, _ *http.Request) {
 	}
 	keyFile.Close()
 
+	if err := h.certs.Reload(); err != nil {
+		slog.WarnContext(r.Context(), "SSL: generated certificate not loaded", "err", err)
+	}
+
 	validUntil := now.Add(10 * 365 * 24 * time.Hour).Format(time.RFC3339)
-	log.Printf("Admin: generated self-signed certificate at %s (valid until %s)", certPath, validUntil)
+	slog.InfoContext(r.Context(), "Admin: generated self-signed certificate", "path", certPath, "valid_until", validUntil)
+	e := auditEntry(r, audit.ActionSSLGenerate)
+	e.Target = certPath
+	e.Details = "valid until " + validUntil
+	h.audit.Record(e)
 
 	type sslResponse struct {
 		CertPath   string `json:"cert_path"`
@@ -161,8 +196,27 @@ func (h *SSLHandler) handleGenerate(w http.ResponseWriter, _ *http.Request) {
 	w.Write(body)
 }
 
-// handleUpload accepts a multipart form with fields "cert" and "key"
-// and saves them to the configured paths.
+// handleStatus reports the certificate being served or, without TLS, the
+// one at the configured path.
+func (h *SSLHandler) handleStatus(w http.ResponseWriter, r *http.Request) {
+	cfg := h.live.Get()
+	st := SSLStatus{CertPath: cfg.Server.SSLCertFile, KeyPath: cfg.Server.SSLKeyFile}
+	if info := h.certs.Info(); info != nil {
+		st.InUse = true
+		st.Certificate = info
+	} else if info, err := tlscert.ReadInfo(st.CertPath); err == nil {
+		st.Certificate = info
+	} else if errors.Is(err, os.ErrNotExist) {
+		st.Error = "no certificate file"
+	} else {
+		st.Error = err.Error()
+	}
+	st.ACME = h.certs.ACMEStatus(r.Context())
+	respondJSON(w, http.StatusOK, st)
+}
+
+// handleUpload accepts a multipart form with fields "cert" and "key",
+// checks that they form a valid pair and saves them to the configured paths.
 func (h *SSLHandler) handleUpload(w http.ResponseWriter, r *http.Request) {
 	const maxSize = 1 << 20 // 1 MB
 	if err := r.ParseMultipartForm(maxSize); err != nil {
@@ -171,47 +225,90 @@ func (h *SSLHandler) handleUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	certPath := h.cfg.Server.SSLCertFile
-	keyPath  := h.cfg.Server.SSLKeyFile
+	certPEM, err := readFormFile(r, "cert", maxSize)
+	if err != nil {
+		respondError(w, http.StatusBadRequest,
+			models.NewAPIError("INVALID_PARAMETER", "Missing or unreadable 'cert' field: "+err.Error()))
+		return
+	}
+	keyPEM, err := readFormFile(r, "key", maxSize)
+	if err != nil {
+		respondError(w, http.StatusBadRequest,
+			models.NewAPIError("INVALID_PARAMETER", "Missing or unreadable 'key' field: "+err.Error()))
+		return
+	}
+	// Reject a mismatched or malformed pair before anything is written, so
+	// the files on disk always hold a usable certificate.
+	cert, err := tlscert.ParsePair(certPEM, keyPEM)
+	if err != nil {
+		respondError(w, http.StatusBadRequest,
+			models.NewAPIError(models.ErrCodeInvalidCertificate, "Certificate and key do not form a valid pair").
+				WithDetails(err.Error()))
+		return
+	}
+
+	cfg := h.live.Get()
+	certPath := cfg.Server.SSLCertFile
+	keyPath  := cfg.Server.SSLKeyFile
 
 	if err := os.MkdirAll(filepath.Dir(certPath), 0755); err != nil {
 		respondError(w, http.StatusInternalServerError,
 			models.NewAPIError("INTERNAL_ERROR", "Failed to create certificate directory"))
 		return
 	}
-
-	if err := saveFormFile(r, "cert", certPath, 0644); err != nil {
-		respondError(w, http.StatusBadRequest,
-			models.NewAPIError("INVALID_PARAMETER", "Missing or unreadable 'cert' field: "+err.Error()))
+	if err := replaceFile(keyPath, keyPEM, 0600); err != nil {
+		respondError(w, http.StatusInternalServerError,
+			models.NewAPIError("INTERNAL_ERROR", "Failed to write key file: "+err.Error()))
 		return
 	}
-	if err := saveFormFile(r, "key", keyPath, 0600); err != nil {
-		// Roll back cert if key fails
-		_ = os.Remove(certPath)
-		respondError(w, http.StatusBadRequest,
-			models.NewAPIError("INVALID_PARAMETER", "Missing or unreadable 'key' field: "+err.Error()))
+	if err := replaceFile(certPath, certPEM, 0644); err != nil {
+		respondError(w, http.StatusInternalServerError,
+			models.NewAPIError("INTERNAL_ERROR", "Failed to write certificate file: "+err.Error()))
 		return
 	}
 
-	log.Printf("Admin: uploaded custom SSL certificate to %s", certPath)
+	if err := h.certs.Reload(); err != nil {
+		slog.WarnContext(r.Context(), "SSL: uploaded certificate not loaded", "err", err)
+	}
+
+	slog.InfoContext(r.Context(), "Admin: uploaded custom SSL certificate", "path", certPath)
+	e := auditEntry(r, audit.ActionSSLUpload)
+	e.Target = certPath
+	e.Details = "subject " + cert.Leaf.Subject.String() + ", valid until " + cert.Leaf.NotAfter.Format(time.RFC3339)
+	h.audit.Record(e)
 	respondJSON(w, http.StatusOK, map[string]string{
 		"cert_path": certPath,
 		"key_path":  keyPath,
 	})
 }
 
-func saveFormFile(r *http.Request, field, dest string, mode os.FileMode) error {
+func readFormFile(r *http.Request, field string, limit int64) ([]byte, error) {
 	f, _, err := r.FormFile(field)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer f.Close()
+	return io.ReadAll(io.LimitReader(f, limit))
+}
 
-	out, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+// replaceFile writes data to a temporary file next to dest and renames it
+// into place, so a reader never sees a half-written certificate.
+func replaceFile(dest string, data []byte, mode os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(dest), "."+filepath.Base(dest)+"-*.tmp")
 	if err != nil {
 		return err
 	}
-	defer out.Close()
-	_, err = io.Copy(out, f)
-	return err
+	defer os.Remove(tmp.Name()) // no-op after a successful rename
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dest)
 }
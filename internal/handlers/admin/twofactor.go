@@ -0,0 +1,284 @@
+package admin
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	qrcode "github.com/skip2/go-qrcode"
+
+	"github.com/phil-bot/rsyslox/internal/audit"
+	"github.com/phil-bot/rsyslox/internal/auth"
+	"github.com/phil-bot/rsyslox/internal/config"
+	"github.com/phil-bot/rsyslox/internal/models"
+)
+
+// enrollmentTTL bounds how long a generated but unconfirmed secret is kept.
+const enrollmentTTL = 10 * time.Minute
+
+// TwoFactorHandler manages the TOTP second factor of the local admin account.
+//
+//	GET    /api/admin/2fa                 — status
+//	POST   /api/admin/2fa/enroll          — generate a secret, returns otpauth URI + QR code
+//	POST   /api/admin/2fa/confirm         — activate the secret with a first code, returns recovery codes
+//	POST   /api/admin/2fa/recovery-codes  — replace recovery codes (requires a current code)
+//	DELETE /api/admin/2fa                 — disable (requires a current or recovery code)
+type TwoFactorHandler struct {
+	live  *config.Live
+	mgr   *auth.Manager
+	audit *audit.Logger
+
+	mu            sync.Mutex
+	pendingSecret string // plaintext, only kept in memory until confirmed
+	pendingUntil  time.Time
+}
+
+// NewTwoFactorHandler creates a new TwoFactorHandler.
+func NewTwoFactorHandler(live *config.Live, mgr *auth.Manager, al *audit.Logger) *TwoFactorHandler {
+	return &TwoFactorHandler{live: live, mgr: mgr, audit: al}
+}
+
+// TwoFactorStatus is returned by GET /api/admin/2fa.
+type TwoFactorStatus struct {
+	Enabled                bool `json:"enabled"`
+	RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+}
+
+// EnrollResponse carries the new secret in every format an app may need.
+type EnrollResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+	QRCode     string `json:"qr_code"` // data:image/png;base64,…
+}
+
+// RecoveryCodesResponse includes the plaintext codes, shown exactly once.
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+	Message       string   `json:"message"`
+}
+
+type codeRequest struct {
+	Code string `json:"code"`
+}
+
+func (h *TwoFactorHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	action := strings.TrimPrefix(r.URL.Path, "/api/admin/2fa")
+	action = strings.Trim(action, "/")
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		h.handleStatus(w)
+	case action == "" && r.Method == http.MethodDelete:
+		h.handleDisable(w, r)
+	case action == "enroll" && r.Method == http.MethodPost:
+		h.handleEnroll(w, r)
+	case action == "confirm" && r.Method == http.MethodPost:
+		h.handleConfirm(w, r)
+	case action == "recovery-codes" && r.Method == http.MethodPost:
+		h.handleRegenerate(w, r)
+	case action == "" || action == "enroll" || action == "confirm" || action == "recovery-codes":
+		respondError(w, http.StatusMethodNotAllowed,
+			models.NewAPIError("METHOD_NOT_ALLOWED", "Method not allowed for this endpoint"))
+	default:
+		respondError(w, http.StatusNotFound,
+			models.NewAPIError(models.ErrCodeNotFound, "Unknown 2FA endpoint"))
+	}
+}
+
+func (h *TwoFactorHandler) handleStatus(w http.ResponseWriter) {
+	cfg := h.live.Get()
+	respondJSON(w, http.StatusOK, TwoFactorStatus{
+		Enabled:                cfg.Auth.TOTPSecret != "",
+		RecoveryCodesRemaining: len(cfg.Auth.TOTPRecoveryCodes),
+	})
+}
+
+func (h *TwoFactorHandler) handleEnroll(w http.ResponseWriter, r *http.Request) {
+	if h.mgr.TOTPEnabled() {
+		respondError(w, http.StatusConflict,
+			models.NewAPIError("CONFLICT", "Two-factor authentication is already enabled"))
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "2FA", "err", err)
+		respondError(w, http.StatusInternalServerError,
+			models.NewAPIError("INTERNAL_ERROR", "Failed to generate secret"))
+		return
+	}
+
+	uri := auth.TOTPURI(secret, auth.LocalAdminUser)
+	png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "2FA: failed to render QR code", "err", err)
+		respondError(w, http.StatusInternalServerError,
+			models.NewAPIError("INTERNAL_ERROR", "Failed to render QR code"))
+		return
+	}
+
+	h.mu.Lock()
+	h.pendingSecret = secret
+	h.pendingUntil = time.Now().Add(enrollmentTTL)
+	h.mu.Unlock()
+
+	respondJSON(w, http.StatusOK, EnrollResponse{
+		Secret:     secret,
+		OTPAuthURI: uri,
+		QRCode:     "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+	})
+}
+
+func (h *TwoFactorHandler) handleConfirm(w http.ResponseWriter, r *http.Request) {
+	var req codeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest,
+			models.NewAPIError(models.ErrCodeInvalidParameter, "Invalid JSON body"))
+		return
+	}
+
+	h.mu.Lock()
+	secret := h.pendingSecret
+	expired := time.Now().After(h.pendingUntil)
+	h.mu.Unlock()
+
+	if secret == "" || expired {
+		respondError(w, http.StatusBadRequest,
+			models.NewAPIError(models.ErrCodeInvalidParameter, "No enrollment in progress — start again"))
+		return
+	}
+	if _, ok := auth.VerifyTOTP(secret, req.Code, time.Now()); !ok {
+		respondError(w, http.StatusBadRequest,
+			models.NewValidationError("code", "Code does not match — check the device clock"))
+		return
+	}
+
+	encrypted, err := config.EncryptPassword(secret)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "2FA: failed to encrypt secret", "err", err)
+		respondError(w, http.StatusInternalServerError,
+			models.NewAPIError("INTERNAL_ERROR", "Failed to encrypt secret"))
+		return
+	}
+	codes, hashes, err := auth.GenerateRecoveryCodes()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "2FA", "err", err)
+		respondError(w, http.StatusInternalServerError,
+			models.NewAPIError("INTERNAL_ERROR", "Failed to generate recovery codes"))
+		return
+	}
+
+	err = h.live.Update(func(next *config.Config) error {
+		next.Auth.TOTPSecret = encrypted
+		next.Auth.TOTPRecoveryCodes = hashes
+		return config.Save(next, origin(r, audit.ActionTwoFactorEnable))
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "2FA: failed to save config", "err", err)
+		respondError(w, http.StatusInternalServerError,
+			models.NewAPIError("INTERNAL_ERROR", "Failed to save configuration"))
+		return
+	}
+
+	h.mu.Lock()
+	h.pendingSecret = ""
+	h.mu.Unlock()
+
+	slog.InfoContext(r.Context(), "Admin: two-factor authentication enabled")
+	h.audit.Record(auditEntry(r, audit.ActionTwoFactorEnable))
+	respondJSON(w, http.StatusOK, RecoveryCodesResponse{
+		RecoveryCodes: codes,
+		Message:       "Store these recovery codes securely — they will not be shown again.",
+	})
+}
+
+func (h *TwoFactorHandler) handleRegenerate(w http.ResponseWriter, r *http.Request) {
+	if !h.requireCode(w, r, audit.ActionTwoFactorRecovery) {
+		return
+	}
+
+	codes, hashes, err := auth.GenerateRecoveryCodes()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "2FA", "err", err)
+		respondError(w, http.StatusInternalServerError,
+			models.NewAPIError("INTERNAL_ERROR", "Failed to generate recovery codes"))
+		return
+	}
+	err = h.live.Update(func(next *config.Config) error {
+		next.Auth.TOTPRecoveryCodes = hashes
+		return config.Save(next, origin(r, audit.ActionTwoFactorRecovery))
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "2FA: failed to save config", "err", err)
+		respondError(w, http.StatusInternalServerError,
+			models.NewAPIError("INTERNAL_ERROR", "Failed to save configuration"))
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Admin: two-factor recovery codes regenerated")
+	h.audit.Record(auditEntry(r, audit.ActionTwoFactorRecovery))
+	respondJSON(w, http.StatusOK, RecoveryCodesResponse{
+		RecoveryCodes: codes,
+		Message:       "Store these recovery codes securely — they will not be shown again.",
+	})
+}
+
+func (h *TwoFactorHandler) handleDisable(w http.ResponseWriter, r *http.Request) {
+	if !h.requireCode(w, r, audit.ActionTwoFactorDisable) {
+		return
+	}
+
+	err := h.live.Update(func(next *config.Config) error {
+		next.Auth.TOTPSecret = ""
+		next.Auth.TOTPRecoveryCodes = nil
+		return config.Save(next, origin(r, audit.ActionTwoFactorDisable))
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "2FA: failed to save config", "err", err)
+		respondError(w, http.StatusInternalServerError,
+			models.NewAPIError("INTERNAL_ERROR", "Failed to save configuration"))
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Admin: two-factor authentication disabled")
+	h.audit.Record(auditEntry(r, audit.ActionTwoFactorDisable))
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Two-factor authentication disabled"})
+}
+
+// requireCode decodes {"code": "..."} and verifies it as a second factor.
+// A used recovery code is removed and saved as part of action. Writes the
+// error response and returns false when the check fails.
+func (h *TwoFactorHandler) requireCode(w http.ResponseWriter, r *http.Request, action string) bool {
+	if !h.mgr.TOTPEnabled() {
+		respondError(w, http.StatusConflict,
+			models.NewAPIError("CONFLICT", "Two-factor authentication is not enabled"))
+		return false
+	}
+
+	var req codeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest,
+			models.NewAPIError(models.ErrCodeInvalidParameter, "Invalid JSON body"))
+		return false
+	}
+	_, err := h.mgr.VerifySecondFactor(req.Code, func(next *config.Config) error {
+		return config.Save(next, origin(r, action))
+	})
+	if errors.Is(err, auth.ErrInvalidCredentials) {
+		respondError(w, http.StatusBadRequest,
+			models.NewValidationError("code", "Invalid code"))
+		return false
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "2FA: code check failed", "err", err)
+		respondError(w, http.StatusInternalServerError,
+			models.NewAPIError("INTERNAL_ERROR", "Failed to verify code"))
+		return false
+	}
+	return true
+}
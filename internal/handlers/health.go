@@ -2,7 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"time"
@@ -36,12 +36,12 @@ type HealthResponse struct {
 type HealthHandler struct {
 	db      *database.DB
 	version string
-	cfg     *config.Config
+	live    *config.Live
 }
 
 // NewHealthHandler creates a HealthHandler.
-func NewHealthHandler(db *database.DB, version string, cfg *config.Config) *HealthHandler {
-	return &HealthHandler{db: db, version: version, cfg: cfg}
+func NewHealthHandler(db *database.DB, version string, live *config.Live) *HealthHandler {
+	return &HealthHandler{db: db, version: version, live: live}
 }
 
 func (h *HealthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -61,7 +61,7 @@ func (h *HealthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			Timestamp: time.Now().Format(time.RFC3339),
 			SetupMode: true,
 		}); encErr != nil {
-			log.Printf("health: encode error: %v", encErr)
+			slog.Warn("Health: failed to encode response", "err", encErr)
 		}
 		return
 	}
@@ -73,33 +73,50 @@ func (h *HealthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			Version:   h.version,
 			Timestamp: time.Now().Format(time.RFC3339),
 		}); encErr != nil {
-			log.Printf("health: encode error: %v", encErr)
+			slog.Warn("Health: failed to encode response", "err", encErr)
 		}
 		return
 	}
 
-	if err := h.db.Health(); err != nil {
+	var defaults *ServerDefaults
+	if h.live != nil {
+		cfg := h.live.Get()
+		defaults = &ServerDefaults{
+			TimeRange:           cfg.Server.DefaultTimeRange,
+			AutoRefreshInterval: cfg.Server.AutoRefreshInterval,
+			Language:            cfg.Server.DefaultLanguage,
+			FontSize:            cfg.Server.DefaultFontSize,
+			TimeFormat:          cfg.Server.DefaultTimeFormat,
+		}
+	}
+
+	// Not connected since startup: the admin panel works, the log
+	// endpoints answer 503 until the background reconnect succeeds.
+	if !h.db.Ready() {
 		w.WriteHeader(http.StatusServiceUnavailable)
 		if encErr := json.NewEncoder(w).Encode(HealthResponse{
-			Status:    "unhealthy",
+			Status:    "degraded",
 			Database:  "disconnected",
 			Version:   h.version,
 			Timestamp: time.Now().Format(time.RFC3339),
+			Defaults:  defaults,
 		}); encErr != nil {
-			log.Printf("health: encode error: %v", encErr)
+			slog.Warn("Health: failed to encode response", "err", encErr)
 		}
 		return
 	}
 
-	var defaults *ServerDefaults
-	if h.cfg != nil {
-		defaults = &ServerDefaults{
-			TimeRange:           h.cfg.Server.DefaultTimeRange,
-			AutoRefreshInterval: h.cfg.Server.AutoRefreshInterval,
-			Language:            h.cfg.Server.DefaultLanguage,
-			FontSize:            h.cfg.Server.DefaultFontSize,
-			TimeFormat:          h.cfg.Server.DefaultTimeFormat,
+	if err := h.db.Health(); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		if encErr := json.NewEncoder(w).Encode(HealthResponse{
+			Status:    "unhealthy",
+			Database:  "disconnected",
+			Version:   h.version,
+			Timestamp: time.Now().Format(time.RFC3339),
+		}); encErr != nil {
+			slog.Warn("Health: failed to encode response", "err", encErr)
 		}
+		return
 	}
 
 	w.WriteHeader(http.StatusOK)
@@ -110,6 +127,6 @@ func (h *HealthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		Timestamp: time.Now().Format(time.RFC3339),
 		Defaults:  defaults,
 	}); encErr != nil {
-		log.Printf("health: encode error: %v", encErr)
+		slog.Warn("Health: failed to encode response", "err", encErr)
 	}
 }
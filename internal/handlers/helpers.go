@@ -1,11 +1,17 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"time"
 
+	"github.com/phil-bot/rsyslox/internal/database"
 	"github.com/phil-bot/rsyslox/internal/models"
+	"github.com/phil-bot/rsyslox/internal/ratelimit"
 )
 
 // respondJSON sends a JSON response with proper headers
@@ -15,17 +21,90 @@ func respondJSON(w http.ResponseWriter, status int, data interface{}) {
 	w.WriteHeader(status)
 
 	if err := json.NewEncoder(w).Encode(data); err != nil {
-		log.Printf("Error encoding JSON response: %v", err)
+		slog.Warn("Failed to encode JSON response", "err", err)
 	}
 }
 
-// respondError sends a JSON error response
+// respondError sends a JSON error response carrying the request ID
 func respondError(w http.ResponseWriter, status int, err *models.APIError) {
+	body := *err
+	body.RequestID = w.Header().Get(models.RequestIDHeader)
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.Header().Set("X-Content-Type-Options", "nosniff")
 	w.WriteHeader(status)
 
-	if encodeErr := json.NewEncoder(w).Encode(err); encodeErr != nil {
-		log.Printf("Error encoding error response: %v", encodeErr)
+	if encodeErr := json.NewEncoder(w).Encode(&body); encodeErr != nil {
+		slog.Warn("Failed to encode error response", "err", encodeErr)
+	}
+}
+
+// admitQuery passes a query of the given estimated cost through guard.
+// On success the caller must call release once the query has finished.
+// Otherwise the error response has been written and ok is false.
+//
+// A query above rate_limit.max_query_cost is answered with 400 rather
+// than 429: the same query would be rejected again after any wait, so
+// there is no Retry-After to give. The client has to narrow it instead.
+func admitQuery(w http.ResponseWriter, r *http.Request, guard *ratelimit.Guard, cost float64) (release func(), ok bool) {
+	release, err := guard.Acquire(r.Context(), cost)
+	switch {
+	case err == nil:
+		return release, true
+	case errors.Is(err, ratelimit.ErrTooExpensive):
+		respondError(w, http.StatusBadRequest,
+			models.NewAPIError(models.ErrCodeQueryTooExpensive, "Query is too expensive").
+				WithDetails(fmt.Sprintf("Estimated cost %.0f exceeds the limit; narrow the date range or add a FromHost or SysLogTag filter", cost)))
+	case errors.Is(err, ratelimit.ErrBusy):
+		w.Header().Set("Retry-After", "10")
+		respondError(w, http.StatusTooManyRequests,
+			models.NewAPIError(models.ErrCodeTooManyRequests, "Too many expensive queries running").
+				WithDetails("retry after 10 seconds, or narrow the query"))
+	default:
+		// The client went away while waiting for a slot; nobody reads the response.
+		slog.DebugContext(r.Context(), "Query admission", "err", err)
+	}
+	return nil, false
+}
+
+// requireDB returns the current connection pool of db for the queries of
+// a request. While db has not been connected since startup it writes 503
+// DATABASE_UNAVAILABLE and returns nil.
+func requireDB(w http.ResponseWriter, db *database.DB) *database.Pool {
+	if p := db.Pool(); p != nil {
+		return p
+	}
+	w.Header().Set("Retry-After", "10")
+	respondError(w, http.StatusServiceUnavailable,
+		models.NewAPIError(models.ErrCodeDatabaseUnavailable, "The database is not reachable").
+			WithDetails("rsyslox keeps reconnecting in the background; retry later"))
+	return nil
+}
+
+// queryContext returns the context for the database calls of r: canceled
+// when the client goes away and, if d > 0, after d.
+func queryContext(r *http.Request, d time.Duration) (context.Context, context.CancelFunc) {
+	if d > 0 {
+		return context.WithTimeout(r.Context(), d)
+	}
+	return context.WithCancel(r.Context())
+}
+
+// respondQueryError writes the response for a failed database query of r.
+// Timeouts get QUERY_TIMEOUT; canceled requests get no response since the
+// client is gone. Everything else is a DATABASE_ERROR with message msg.
+func respondQueryError(w http.ResponseWriter, r *http.Request, err error, timeout time.Duration, msg string) {
+	switch {
+	case errors.Is(err, database.ErrQueryTimeout):
+		slog.WarnContext(r.Context(), "Query timed out", "timeout", timeout.String())
+		respondError(w, http.StatusGatewayTimeout,
+			models.NewAPIError(models.ErrCodeQueryTimeout,
+				fmt.Sprintf("Query exceeded the time limit of %s", timeout)).
+				WithDetails("Narrow the date range or add filters"))
+	case errors.Is(err, context.Canceled):
+		slog.DebugContext(r.Context(), "Query canceled: client went away")
+	default:
+		slog.ErrorContext(r.Context(), "Query failed", "err", err)
+		respondError(w, http.StatusInternalServerError,
+			models.NewAPIError(models.ErrCodeDatabaseError, msg))
 	}
 }
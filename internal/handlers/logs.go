@@ -1,22 +1,25 @@
 package handlers
 
 import (
-	"log"
 	"net/http"
 
+	"github.com/phil-bot/rsyslox/internal/config"
 	"github.com/phil-bot/rsyslox/internal/database"
 	"github.com/phil-bot/rsyslox/internal/filters"
 	"github.com/phil-bot/rsyslox/internal/models"
+	"github.com/phil-bot/rsyslox/internal/ratelimit"
 )
 
 // LogsHandler handles GET /api/logs.
 type LogsHandler struct {
-	db *database.DB
+	db    *database.DB
+	live  *config.Live
+	guard *ratelimit.Guard // nil: no cost limit
 }
 
 // NewLogsHandler creates a new LogsHandler.
-func NewLogsHandler(db *database.DB) *LogsHandler {
-	return &LogsHandler{db: db}
+func NewLogsHandler(db *database.DB, live *config.Live, guard *ratelimit.Guard) *LogsHandler {
+	return &LogsHandler{db: db, live: live, guard: guard}
 }
 
 // ServeHTTP handles the /api/logs endpoint.
@@ -26,6 +29,10 @@ func (h *LogsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			models.NewAPIError("METHOD_NOT_ALLOWED", "Only GET method is allowed"))
 		return
 	}
+	pool := requireDB(w, h.db)
+	if pool == nil {
+		return
+	}
 
 	query := r.URL.Query()
 
@@ -41,6 +48,19 @@ func (h *LogsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Count mode — exact (default), estimate or none
+	countMode := database.CountExact
+	if c := query.Get("count"); c != "" {
+		countMode = database.CountMode(c)
+		switch countMode {
+		case database.CountExact, database.CountEstimate, database.CountNone:
+		default:
+			respondError(w, http.StatusBadRequest,
+				models.NewValidationError("count", "Must be one of exact, estimate, none"))
+			return
+		}
+	}
+
 	// Date range
 	startDate, endDate, err := filters.ValidateDateRange(query.Get("start_date"), query.Get("end_date"))
 	if err != nil {
@@ -138,20 +158,38 @@ func (h *LogsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	whereClause, args := builder.Build()
 
-	// Run CountLogs, QueryLogs and TotalCount in parallel.
-	entries, total, dbTotal, err := h.db.QueryLogsWithTotal(whereClause, args, limit, offset)
+	release, ok := admitQuery(w, r, h.guard, filters.EstimateCost(filters.CostParams{
+		Start:        startDate,
+		End:          endDate,
+		MessageTerms: len(messages),
+		Hosts:        len(query["FromHost"]),
+		Tags:         len(query["SysLogTag"]),
+		Limit:        limit,
+	}))
+	if !ok {
+		return
+	}
+	defer release()
+
+	timeout := h.live.Get().Database.QueryTimeouts.Logs
+	ctx, cancel := queryContext(r, timeout)
+	defer cancel()
+
+	// Run the count and the page query in parallel.
+	res, err := pool.QueryLogsWithTotal(ctx, whereClause, args, limit, offset, countMode)
 	if err != nil {
-		log.Printf("Query error: %v", err)
-		respondError(w, http.StatusInternalServerError,
-			models.NewAPIError(models.ErrCodeDatabaseError, "Failed to query logs"))
+		respondQueryError(w, r, err, timeout, "Failed to query logs")
 		return
 	}
 
 	respondJSON(w, http.StatusOK, models.LogsResponse{
-		Total:   total,
-		DBTotal: dbTotal,
-		Offset:  offset,
-		Limit:   limit,
-		Rows:    entries,
+		Total:        res.Total,
+		TotalExact:   res.TotalExact,
+		DBTotal:      res.DBTotal,
+		DBTotalExact: res.DBTotalExact,
+		HasMore:      res.HasMore,
+		Offset:       offset,
+		Limit:        limit,
+		Rows:         res.Entries,
 	})
 }
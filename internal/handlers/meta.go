@@ -1,23 +1,28 @@
 package handlers
 
 import (
-	"log"
+	"log/slog"
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/phil-bot/rsyslox/internal/config"
 	"github.com/phil-bot/rsyslox/internal/database"
 	"github.com/phil-bot/rsyslox/internal/filters"
 	"github.com/phil-bot/rsyslox/internal/models"
+	"github.com/phil-bot/rsyslox/internal/ratelimit"
 )
 
 // MetaHandler handles GET /api/meta and GET /api/meta/{column}.
 type MetaHandler struct {
-	db *database.DB
+	db    *database.DB
+	live  *config.Live
+	guard *ratelimit.Guard // nil: no cost limit
 }
 
 // NewMetaHandler creates a new MetaHandler.
-func NewMetaHandler(db *database.DB) *MetaHandler {
-	return &MetaHandler{db: db}
+func NewMetaHandler(db *database.DB, live *config.Live, guard *ratelimit.Guard) *MetaHandler {
+	return &MetaHandler{db: db, live: live, guard: guard}
 }
 
 func (h *MetaHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -26,6 +31,10 @@ func (h *MetaHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			models.NewAPIError("METHOD_NOT_ALLOWED", "Only GET method is allowed"))
 		return
 	}
+	pool := requireDB(w, h.db)
+	if pool == nil {
+		return
+	}
 
 	// Strip /api/meta prefix to get the column name
 	// Handles both /api/meta  and  /api/meta/ColumnName
@@ -34,40 +43,39 @@ func (h *MetaHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	column = strings.TrimSpace(column)
 
 	if column == "" {
-		h.handleList(w, r)
+		h.handleList(w, r, pool)
 		return
 	}
 
-	h.handleColumnValues(w, r, column)
+	h.handleColumnValues(w, r, pool, column)
 }
 
-func (h *MetaHandler) handleList(w http.ResponseWriter, r *http.Request) {
-	dbTotal, err := h.db.TotalCount()
-	if err != nil {
-		log.Printf("Meta list: TotalCount error: %v", err)
-		dbTotal = 0
-	}
+func (h *MetaHandler) handleList(w http.ResponseWriter, r *http.Request, pool *database.Pool) {
+	ctx, cancel := queryContext(r, h.live.Get().Database.QueryTimeouts.Meta)
+	defer cancel()
+
+	dbTotal, _ := pool.DBTotal(ctx)
 
-	oldest, err := h.db.OldestEntryTime()
+	oldest, err := pool.OldestEntryTime(ctx)
 	if err != nil {
-		log.Printf("Meta list: OldestEntryTime error: %v", err)
+		slog.WarnContext(r.Context(), "Meta: failed to read the oldest entry time", "err", err)
 		oldest = nil
 	}
 
 	respondJSON(w, http.StatusOK, models.MetaResponse{
-		AvailableColumns: h.db.AvailableColumns,
+		AvailableColumns: pool.AvailableColumns,
 		Usage:            "GET /api/meta/{column} to get distinct values for a column",
 		DBTotal:          dbTotal,
 		OldestEntry:      oldest,
 	})
 }
 
-func (h *MetaHandler) handleColumnValues(w http.ResponseWriter, r *http.Request, column string) {
-	if !h.db.IsValidColumn(column) {
+func (h *MetaHandler) handleColumnValues(w http.ResponseWriter, r *http.Request, pool *database.Pool, column string) {
+	if !pool.IsValidColumn(column) {
 		respondError(w, http.StatusBadRequest,
 			models.NewAPIError(models.ErrCodeInvalidColumn,
 				"Invalid column: "+column).
-				WithDetails("Available columns: "+strings.Join(h.db.AvailableColumns, ", ")))
+				WithDetails("Available columns: "+strings.Join(pool.AvailableColumns, ", ")))
 		return
 	}
 
@@ -75,10 +83,12 @@ func (h *MetaHandler) handleColumnValues(w http.ResponseWriter, r *http.Request,
 	builder := filters.New()
 
 	// Date range is optional for meta queries
+	var startDate, endDate time.Time
 	startDateStr := query.Get("start_date")
 	endDateStr := query.Get("end_date")
 	if startDateStr != "" || endDateStr != "" {
-		startDate, endDate, err := filters.ValidateDateRange(startDateStr, endDateStr)
+		var err error
+		startDate, endDate, err = filters.ValidateDateRange(startDateStr, endDateStr)
 		if err != nil {
 			if apiErr, ok := err.(*models.APIError); ok {
 				respondError(w, http.StatusBadRequest, apiErr)
@@ -155,11 +165,29 @@ func (h *MetaHandler) handleColumnValues(w http.ResponseWriter, r *http.Request,
 
 	whereClause, args := builder.Build()
 
-	values, err := h.db.QueryDistinctValues(column, whereClause, args)
+	// DISTINCT over an indexed column is answered from the index; only a
+	// Message search forces MySQL to read the rows themselves.
+	if len(messages) > 0 {
+		release, ok := admitQuery(w, r, h.guard, filters.EstimateCost(filters.CostParams{
+			Start:        startDate,
+			End:          endDate,
+			MessageTerms: len(messages),
+			Hosts:        len(query["FromHost"]),
+			Tags:         len(query["SysLogTag"]),
+		}))
+		if !ok {
+			return
+		}
+		defer release()
+	}
+
+	timeout := h.live.Get().Database.QueryTimeouts.Meta
+	ctx, cancel := queryContext(r, timeout)
+	defer cancel()
+
+	values, err := pool.QueryDistinctValues(ctx, column, whereClause, args)
 	if err != nil {
-		log.Printf("Meta query error: %v", err)
-		respondError(w, http.StatusInternalServerError,
-			models.NewAPIError(models.ErrCodeDatabaseError, "Failed to query metadata"))
+		respondQueryError(w, r, err, timeout, "Failed to query metadata")
 		return
 	}
 
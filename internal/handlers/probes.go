@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/phil-bot/rsyslox/internal/database"
+	"github.com/phil-bot/rsyslox/internal/models"
+)
+
+// readyPingTimeout bounds the database ping of GET /readyz, so a hanging
+// server fails the probe instead of stalling it.
+const readyPingTimeout = 2 * time.Second
+
+// ProbeResponse is the JSON body returned by GET /livez and GET /readyz.
+type ProbeResponse struct {
+	Status string            `json:"status"`           // alive, ready, not_ready or setup
+	Checks map[string]string `json:"checks,omitempty"` // check → "ok" or the reason it failed
+}
+
+// LivezHandler handles GET /livez: it answers 200 as long as the process
+// serves HTTP, whatever the state of the database.
+type LivezHandler struct{}
+
+// NewLivezHandler creates a LivezHandler.
+func NewLivezHandler() *LivezHandler { return &LivezHandler{} }
+
+func (h *LivezHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		respondError(w, http.StatusMethodNotAllowed,
+			models.NewAPIError("METHOD_NOT_ALLOWED", "Only GET is allowed"))
+		return
+	}
+	respondJSON(w, http.StatusOK, ProbeResponse{Status: "alive"})
+}
+
+// ReadyzHandler handles GET /readyz: 200 when the database answers, the
+// columns of SystemEvents are loaded and the server is not draining for
+// a shutdown or restart; 503 otherwise.
+type ReadyzHandler struct {
+	db       *database.DB // nil in setup mode
+	draining func() bool
+}
+
+// NewReadyzHandler creates a ReadyzHandler. draining reports whether the
+// server has started to shut down.
+func NewReadyzHandler(db *database.DB, draining func() bool) *ReadyzHandler {
+	return &ReadyzHandler{db: db, draining: draining}
+}
+
+func (h *ReadyzHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		respondError(w, http.StatusMethodNotAllowed,
+			models.NewAPIError("METHOD_NOT_ALLOWED", "Only GET is allowed"))
+		return
+	}
+
+	// The setup wizard has no database yet but must stay reachable
+	// through the load balancer to be completed.
+	if h.db == nil {
+		respondJSON(w, http.StatusOK, ProbeResponse{Status: "setup"})
+		return
+	}
+
+	ready := true
+	checks := make(map[string]string, 3)
+	fail := func(check, reason string) {
+		checks[check] = reason
+		ready = false
+	}
+
+	pool := h.db.Pool()
+	switch {
+	case pool == nil:
+		fail("database", "not connected")
+	default:
+		ctx, cancel := context.WithTimeout(r.Context(), readyPingTimeout)
+		err := pool.PingContext(ctx)
+		cancel()
+		if err != nil {
+			fail("database", "ping failed")
+		} else {
+			checks["database"] = "ok"
+		}
+	}
+
+	if pool != nil && len(pool.AvailableColumns) > 0 {
+		checks["columns"] = "ok"
+	} else {
+		fail("columns", "not loaded")
+	}
+
+	if h.draining() {
+		fail("draining", "shutting down")
+	} else {
+		checks["draining"] = "ok"
+	}
+
+	if !ready {
+		respondJSON(w, http.StatusServiceUnavailable, ProbeResponse{Status: "not_ready", Checks: checks})
+		return
+	}
+	respondJSON(w, http.StatusOK, ProbeResponse{Status: "ready", Checks: checks})
+}
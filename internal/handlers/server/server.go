@@ -29,6 +29,7 @@ import (
 	"github.com/phil-bot/rsyslox/internal/handlers/admin"
 	"github.com/phil-bot/rsyslox/internal/handlers/setup"
 	"github.com/phil-bot/rsyslox/internal/middleware"
+	"github.com/phil-bot/rsyslox/internal/tlscert"
 )
 
 // frontendFS and docsFS are injected at build time via go:embed in embed.go.
@@ -40,6 +41,7 @@ var (
 // Server represents the HTTP server.
 type Server struct {
 	cfg          *config.Config
+	live         *config.Live
 	db           *database.DB
 	router       *http.ServeMux
 	version      string
@@ -52,24 +54,26 @@ type Server struct {
 // New creates a new Server instance.
 // setupMode=true means no config file was found; only the setup wizard is enabled.
 func New(cfg *config.Config, db *database.DB, version string, setupMode bool, cleaner *cleanup.Cleaner) *Server {
+	live := config.NewLive(cfg)
 	return &Server{
 		cfg:          cfg,
+		live:         live,
 		db:           db,
 		router:       http.NewServeMux(),
 		version:      version,
 		setupMode:    setupMode,
-		authMgr:      auth.New(cfg),
-		sessionStore: auth.NewSessionStore(),
+		authMgr:      auth.New(live),
+		sessionStore: auth.NewSessionStore(live),
 		cleaner:      cleaner,
 	}
 }
 
 // SetupRoutes configures all HTTP routes and middleware.
 func (s *Server) SetupRoutes() {
-	cors := middleware.CORS(s.cfg.Server.AllowedOrigins)
+	cors := middleware.CORS(s.live)
 	logging := middleware.Logging()
 	authRO := middleware.AuthReadOnly(s.authMgr, s.sessionStore)
-	authAdmin := middleware.AuthAdmin(s.sessionStore)
+	authAdmin := middleware.AuthAdmin(s.authMgr, s.sessionStore)
 	localhostOnly := middleware.LocalhostOnly()
 
 	// --- Frontend ---
@@ -82,11 +86,11 @@ func (s *Server) SetupRoutes() {
 	s.router.Handle("/docs/", cors(logging(docsHandler)))
 
 	// --- Health (public) ---
-	healthHandler := handlers.NewHealthHandler(s.db, s.version, s.cfg)
+	healthHandler := handlers.NewHealthHandler(s.db, s.version, s.live)
 	s.router.Handle("/health", cors(logging(healthHandler)))
 
 	// --- Setup wizard (localhost only, only in setup mode) ---
-	setupHandler := setup.New(s.cfg, s.sessionStore)
+	setupHandler := setup.New(s.live, s.sessionStore, nil)
 	s.router.Handle("/api/setup", cors(logging(localhostOnly(setupHandler))))
 
 	if s.setupMode {
@@ -96,23 +100,23 @@ func (s *Server) SetupRoutes() {
 	}
 
 	// --- Admin: login / logout (public, rate-limited by bcrypt cost) ---
-	loginHandler := admin.NewLoginHandler(s.authMgr, s.sessionStore)
-	logoutHandler := admin.NewLogoutHandler(s.sessionStore)
+	loginHandler := admin.NewLoginHandler(s.live, s.authMgr, s.sessionStore, auth.NewLoginLimiter(s.live), nil)
+	logoutHandler := admin.NewLogoutHandler(s.sessionStore, nil)
 	s.router.Handle("/api/admin/login", cors(logging(loginHandler)))
 	s.router.Handle("/api/admin/logout", cors(logging(authAdmin(logoutHandler))))
 
 	// --- Admin: config and key management (admin token required) ---
-	configHandler := admin.NewConfigHandler(s.cfg, s.cleaner)
-	keysHandler   := admin.NewKeysHandler(s.cfg)
-	sslHandler    := admin.NewSSLHandler(s.cfg)
+	configHandler := admin.NewConfigHandler(s.live, nil, nil)
+	keysHandler   := admin.NewKeysHandler(s.live, s.authMgr, nil)
+	sslHandler    := admin.NewSSLHandler(s.live, tlscert.NewStore(s.live), nil)
 	s.router.Handle("/api/admin/config", cors(logging(authAdmin(configHandler))))
 	s.router.Handle("/api/admin/keys",   cors(logging(authAdmin(keysHandler))))
 	s.router.Handle("/api/admin/keys/",  cors(logging(authAdmin(keysHandler))))
 	s.router.Handle("/api/admin/ssl/",   cors(logging(authAdmin(sslHandler))))
 
 	// --- API: logs and meta (read-only key or admin token) ---
-	logsHandler := handlers.NewLogsHandler(s.db)
-	metaHandler := handlers.NewMetaHandler(s.db)
+	logsHandler := handlers.NewLogsHandler(s.db, s.live, nil)
+	metaHandler := handlers.NewMetaHandler(s.db, s.live, nil)
 	s.router.Handle("/api/logs", cors(logging(authRO(logsHandler))))
 	s.router.Handle("/api/meta", cors(logging(authRO(metaHandler))))
 	s.router.Handle("/api/meta/", cors(logging(authRO(metaHandler))))
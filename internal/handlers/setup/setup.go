@@ -4,28 +4,40 @@
 package setup
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
-	"syscall"
 	"time"
 
 	"github.com/phil-bot/rsyslox/internal/auth"
 	"github.com/phil-bot/rsyslox/internal/config"
+	"github.com/phil-bot/rsyslox/internal/database"
 	"github.com/phil-bot/rsyslox/internal/models"
 )
 
-// SetupRequest is the payload sent by the setup wizard on first run.
-type SetupRequest struct {
-	// Database connection
+// DatabaseRequest holds the database connection settings of the wizard,
+// sent alone to POST /api/setup/test-db.
+type DatabaseRequest struct {
 	DBHost     string `json:"db_host"`
 	DBPort     int    `json:"db_port"`
 	DBName     string `json:"db_name"`
 	DBUser     string `json:"db_user"`
 	DBPassword string `json:"db_password"`
 
+	// UseRsyslogPassword takes the password from the ommysql action of the
+	// local rsyslog that writes to the same host, database and user, when
+	// db_password is empty. The prefill never returns it.
+	UseRsyslogPassword bool `json:"use_rsyslog_password,omitempty"`
+}
+
+// SetupRequest is the payload sent by the setup wizard on first run.
+type SetupRequest struct {
+	// Database connection
+	DatabaseRequest
+
 	// Admin credentials
 	AdminPassword string `json:"admin_password"`
 
@@ -40,21 +52,24 @@ type SetupResponse struct {
 	Message string `json:"message"`
 }
 
-// Handler handles the POST /api/setup endpoint.
+// Handler handles the /api/setup and POST /api/setup/test-db endpoints.
 type Handler struct {
-	cfg          *config.Config
+	live         *config.Live
 	sessionStore *auth.SessionStore
+	restart      func()
 }
 
-// New creates a new setup Handler.
-func New(cfg *config.Config, store *auth.SessionStore) *Handler {
-	return &Handler{cfg: cfg, sessionStore: store}
+// New creates a new setup Handler. restart is called once the
+// configuration has been saved, so the server comes back in normal mode.
+func New(live *config.Live, store *auth.SessionStore, restart func()) *Handler {
+	return &Handler{live: live, sessionStore: store, restart: restart}
 }
 
 // PrefillResponse contains database defaults for the setup wizard.
-// Values are read from RSYSLOX_PREFILL_* environment variables,
-// which the Docker entrypoint sets so the operator does not have to
-// type the credentials manually.
+// Values are taken from the ommysql action of a local rsyslog and can be
+// overridden with RSYSLOX_PREFILL_* environment variables, which the
+// Docker entrypoint sets so the operator does not have to type the
+// credentials manually.
 type PrefillResponse struct {
 	DBHost       string `json:"db_host"`
 	DBPort       int    `json:"db_port"`
@@ -62,10 +77,30 @@ type PrefillResponse struct {
 	DBUser       string `json:"db_user"`
 	ServerHost   string `json:"server_host"`
 	ServerPort   int    `json:"server_port"`
+
+	Rsyslog       *RsyslogSource `json:"rsyslog,omitempty"`        // where the database settings were found
+	RsyslogErrors []string       `json:"rsyslog_errors,omitempty"` // "file:line: message"
+}
+
+// RsyslogSource is the ommysql action the prefilled database settings
+// come from.
+type RsyslogSource struct {
+	File          string `json:"file"`
+	Line          int    `json:"line"`
+	PasswordFound bool   `json:"password_found"` // use_rsyslog_password can be set
 }
 
 // ServeHTTP processes GET (prefill) and POST (submit) requests for the setup wizard.
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/api/setup/test-db" {
+		if r.Method != http.MethodPost {
+			respondError(w, http.StatusMethodNotAllowed,
+				models.NewAPIError("METHOD_NOT_ALLOWED", "Only POST is allowed"))
+			return
+		}
+		h.handleTestDB(w, r)
+		return
+	}
 	switch r.Method {
 	case http.MethodGet:
 		h.handlePrefill(w, r)
@@ -77,25 +112,74 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// handlePrefill returns database defaults from environment variables.
+// handlePrefill returns database defaults from the rsyslog configuration
+// and environment variables.
 func (h *Handler) handlePrefill(w http.ResponseWriter, r *http.Request) {
-	port := 3306
+	resp := PrefillResponse{DBHost: "localhost", DBPort: 3306, DBName: "Syslog"}
+
+	actions, err := config.FindRsyslogDatabases()
+	if err != nil {
+		resp.RsyslogErrors = errorLines(err)
+		for _, line := range resp.RsyslogErrors {
+			slog.Warn("rsyslog config", "err", line)
+		}
+	}
+	if len(actions) > 0 {
+		a := actions[0]
+		resp.DBHost, resp.DBName, resp.DBUser = a.Host, a.Name, a.User
+		if a.Port > 0 {
+			resp.DBPort = a.Port
+		}
+		resp.Rsyslog = &RsyslogSource{File: a.File, Line: a.Line, PasswordFound: a.Password != ""}
+	}
+
 	if p := os.Getenv("RSYSLOX_PREFILL_DB_PORT"); p != "" {
-		fmt.Sscanf(p, "%d", &port)
+		fmt.Sscanf(p, "%d", &resp.DBPort)
 	}
-	srvPort := h.cfg.Server.Port
-	if srvPort == 0 {
-		srvPort = 8000
+	resp.DBHost = getEnv("RSYSLOX_PREFILL_DB_HOST", resp.DBHost)
+	resp.DBName = getEnv("RSYSLOX_PREFILL_DB_NAME", resp.DBName)
+	resp.DBUser = getEnv("RSYSLOX_PREFILL_DB_USER", resp.DBUser)
+
+	cfg := h.live.Get()
+	resp.ServerHost = cfg.Server.Host
+	resp.ServerPort = cfg.Server.Port
+	if resp.ServerPort == 0 {
+		resp.ServerPort = 8000
 	}
+	respondJSON(w, http.StatusOK, resp)
+}
 
-	respondJSON(w, http.StatusOK, PrefillResponse{
-		DBHost:     getEnv("RSYSLOX_PREFILL_DB_HOST", "localhost"),
-		DBPort:     port,
-		DBName:     getEnv("RSYSLOX_PREFILL_DB_NAME", "Syslog"),
-		DBUser:     getEnv("RSYSLOX_PREFILL_DB_USER", ""),
-		ServerHost: h.cfg.Server.Host,
-		ServerPort: srvPort,
-	})
+// errorLines splits an error joined by errors.Join into its messages.
+func errorLines(err error) []string {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var lines []string
+		for _, e := range joined.Unwrap() {
+			lines = append(lines, e.Error())
+		}
+		return lines
+	}
+	return []string{err.Error()}
+}
+
+// rsyslogPassword returns the password of the local rsyslog's ommysql
+// action for the host, port, database and user of req. Matching all of
+// them keeps the password from being sent to any other server.
+func rsyslogPassword(req *DatabaseRequest) (string, bool) {
+	actions, _ := config.FindRsyslogDatabases()
+	port := req.DBPort
+	if port == 0 {
+		port = 3306
+	}
+	for _, a := range actions {
+		aPort := a.Port
+		if aPort == 0 {
+			aPort = 3306
+		}
+		if a.Host == req.DBHost && aPort == port && a.Name == req.DBName && a.User == req.DBUser && a.Password != "" {
+			return a.Password, true
+		}
+	}
+	return "", false
 }
 
 func getEnv(key, fallback string) string {
@@ -123,69 +207,115 @@ func (h *Handler) handleSubmit(w http.ResponseWriter, r *http.Request) {
 	// Hash admin password
 	hash, err := auth.HashAdminPassword(req.AdminPassword)
 	if err != nil {
-		log.Printf("Setup: failed to hash password: %v", err)
+		slog.ErrorContext(r.Context(), "Setup: failed to hash password", "err", err)
 		respondError(w, http.StatusInternalServerError,
 			models.NewAPIError("INTERNAL_ERROR", "Failed to hash password"))
 		return
 	}
 
-	// Encrypt database password
-	encPass, err := config.EncryptPassword(req.DBPassword)
-	if err != nil {
-		log.Printf("Setup: failed to encrypt DB password: %v", err)
+	// Apply setup values to config; the database password is encrypted
+	db := h.live.Get().Database
+	if err := applyDatabase(&db, &req.DatabaseRequest); err != nil {
+		slog.ErrorContext(r.Context(), "Setup: failed to encrypt DB password", "err", err)
 		respondError(w, http.StatusInternalServerError,
 			models.NewAPIError("INTERNAL_ERROR", "Failed to encrypt database password"))
 		return
 	}
 
-	// Apply setup values to config
-	h.cfg.Database.Host = req.DBHost
-	h.cfg.Database.Port = req.DBPort
-	h.cfg.Database.Name = req.DBName
-	h.cfg.Database.User = req.DBUser
-	h.cfg.Database.Password = encPass
-	h.cfg.Auth.AdminPasswordHash = hash
-
-	if req.ServerHost != "" {
-		h.cfg.Server.Host = req.ServerHost
-	}
-	if req.ServerPort > 0 {
-		h.cfg.Server.Port = req.ServerPort
-	}
-	h.cfg.Server.UseSSL = req.UseSSL
-
 	// Persist configuration
-	if err := config.Save(h.cfg); err != nil {
-		log.Printf("Setup: failed to save config: %v", err)
+	err = h.live.Update(func(next *config.Config) error {
+		next.Database = db
+		next.Auth.AdminPasswordHash = hash
+		if req.ServerHost != "" {
+			next.Server.Host = req.ServerHost
+		}
+		if req.ServerPort > 0 {
+			next.Server.Port = req.ServerPort
+		}
+		next.Server.UseSSL = req.UseSSL
+		return config.Save(next, config.Origin{User: "setup", Action: "setup"})
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Setup: failed to save config", "err", err)
 		respondError(w, http.StatusInternalServerError,
 			models.NewAPIError("INTERNAL_ERROR", "Failed to save configuration: "+err.Error()))
 		return
 	}
 
-	log.Println("✓ Setup completed, configuration saved to", h.cfg.ConfigPath)
+	slog.InfoContext(r.Context(), "Setup completed, configuration saved", "path", h.live.Get().ConfigPath)
 
 	respondJSON(w, http.StatusOK, SetupResponse{
 		Message: "Setup complete. Restarting…",
 	})
 
 	// Restart the process so it picks up the new config and registers all routes.
-	// syscall.Exec replaces the current process image — the Docker container /
-	// systemd unit keeps the same PID and stays alive.
-	go func() {
-		time.Sleep(500 * time.Millisecond)
-		exe, err := os.Executable()
-		if err != nil {
-			log.Printf("Setup: failed to determine executable path: %v — please restart manually", err)
-			return
-		}
-		log.Println("Restarting rsyslox with new configuration…")
-		if err := syscall.Exec(exe, os.Args, os.Environ()); err != nil {
-			log.Printf("Setup: exec restart failed: %v — please restart manually", err)
-		}
-	}()
+	// The process re-executes itself — the Docker container / systemd unit
+	// keeps the same PID and stays alive.
+	if h.restart != nil {
+		slog.Info("Restarting rsyslox with new configuration")
+		h.restart()
+	} else {
+		slog.Warn("Please restart rsyslox to apply the new configuration")
+	}
+}
+
+// handleTestDB runs the database checklist for the settings in the body,
+// so the wizard can catch mistakes before they are saved: with settings
+// that do not work, the server fails to start after the restart.
+func (h *Handler) handleTestDB(w http.ResponseWriter, r *http.Request) {
+	var req DatabaseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest,
+			models.NewAPIError(models.ErrCodeInvalidParameter, "Invalid JSON body"))
+		return
+	}
+	if err := validateDatabase(&req); err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	cfg := h.live.Get().Clone()
+	if err := applyDatabase(&cfg.Database, &req); err != nil {
+		slog.ErrorContext(r.Context(), "Setup: failed to encrypt DB password", "err", err)
+		respondError(w, http.StatusInternalServerError,
+			models.NewAPIError("INTERNAL_ERROR", "Failed to encrypt database password"))
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), testDBTimeout)
+	defer cancel()
+	respondJSON(w, http.StatusOK, database.Diagnose(ctx, cfg))
+}
+
+// testDBTimeout bounds the database checklist.
+const testDBTimeout = 10 * time.Second
+
+// applyDatabase copies the connection settings of req into d.
+func applyDatabase(d *config.DatabaseConfig, req *DatabaseRequest) error {
+	encPass, err := config.EncryptPassword(req.DBPassword)
+	if err != nil {
+		return err
+	}
+	d.Host = req.DBHost
+	d.Port = req.DBPort
+	d.Name = req.DBName
+	d.User = req.DBUser
+	d.Password = encPass
+	return nil
 }
 
 func validateSetupRequest(req *SetupRequest) *models.APIError {
+	if err := validateDatabase(&req.DatabaseRequest); err != nil {
+		return err
+	}
+	if len(req.AdminPassword) < 12 {
+		return models.NewValidationError("admin_password", "Admin password must be at least 12 characters")
+	}
+	return nil
+}
+
+// validateDatabase checks the connection settings of req and fills in the
+// password of the rsyslog action if requested.
+func validateDatabase(req *DatabaseRequest) *models.APIError {
 	if req.DBHost == "" {
 		return models.NewValidationError("db_host", "Database host is required")
 	}
@@ -195,12 +325,17 @@ func validateSetupRequest(req *SetupRequest) *models.APIError {
 	if req.DBUser == "" {
 		return models.NewValidationError("db_user", "Database user is required")
 	}
+	if req.DBPassword == "" && req.UseRsyslogPassword {
+		pass, ok := rsyslogPassword(req)
+		if !ok {
+			return models.NewValidationError("db_password",
+				"No rsyslog ommysql action writes to this host, database and user; enter the password")
+		}
+		req.DBPassword = pass
+	}
 	if req.DBPassword == "" {
 		return models.NewValidationError("db_password", "Database password is required")
 	}
-	if len(req.AdminPassword) < 12 {
-		return models.NewValidationError("admin_password", "Admin password must be at least 12 characters")
-	}
 	return nil
 }
 
@@ -211,7 +346,9 @@ func respondJSON(w http.ResponseWriter, status int, data interface{}) {
 }
 
 func respondError(w http.ResponseWriter, status int, err *models.APIError) {
+	body := *err
+	body.RequestID = w.Header().Get(models.RequestIDHeader)
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(err)
+	json.NewEncoder(w).Encode(&body)
 }
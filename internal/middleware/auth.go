@@ -1,8 +1,11 @@
 package middleware
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"log/slog"
+	"net"
 	"net/http"
 	"strings"
 
@@ -13,14 +16,59 @@ import (
 // contextKey is an unexported type for context keys in this package.
 type contextKey string
 
-const roleKey contextKey = "auth_role"
+const (
+	roleKey     contextKey = "auth_role"
+	identityKey contextKey = "auth_identity"
+	keyNameKey  contextKey = "auth_key_name"
+)
+
+// IdentityFromContext returns the session or client certificate identity
+// attached by AuthAdmin or AuthReadOnly. ok is false for API-key requests
+// and unauthenticated routes.
+func IdentityFromContext(ctx context.Context) (auth.Identity, bool) {
+	id, ok := ctx.Value(identityKey).(auth.Identity)
+	return id, ok
+}
 
-// AuthReadOnly returns a middleware that accepts both admin session tokens
-// and read-only API keys. It rejects unauthenticated requests.
+// KeyNameFromContext returns the name of the read-only API key that
+// authenticated the request. ok is false for session requests.
+func KeyNameFromContext(ctx context.Context) (string, bool) {
+	name, ok := ctx.Value(keyNameKey).(string)
+	return name, ok
+}
+
+// AuthReadOnly returns a middleware that accepts admin session tokens,
+// read-only API keys and mapped client certificates (auth.mtls). It rejects
+// unauthenticated requests.
 func AuthReadOnly(mgr *auth.Manager, store *auth.SessionStore) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			role := resolveRole(r, mgr, store)
+			if token := extractToken(r); token != "" {
+				if id, ok := store.Lookup(token); ok {
+					next.ServeHTTP(w, withIdentity(r, id))
+					return
+				}
+			}
+			role, keyName, err := resolveRole(r, mgr, store)
+			if role == auth.RoleNone && err == nil && r.Header.Get("X-API-Key") == "" {
+				var id *auth.Identity
+				id, keyName, err = clientCert(r, mgr)
+				if id != nil {
+					next.ServeHTTP(w, withIdentity(r, *id))
+					return
+				}
+				if err == nil && keyName != "" {
+					mgr.KeyUsage().Record(keyName, ClientIP(r))
+					role = auth.RoleReadOnly
+				}
+			}
+			if errors.Is(err, auth.ErrKeyExpired) {
+				respondError(w, http.StatusUnauthorized, models.NewAPIError(
+					models.ErrCodeKeyExpired,
+					"API key has expired").
+					WithDetails("Ask an administrator to rotate or renew the key"))
+				return
+			}
 			if role == auth.RoleNone {
 				respondError(w, http.StatusUnauthorized, models.NewAPIError(
 					models.ErrCodeUnauthorized,
@@ -28,31 +76,59 @@ func AuthReadOnly(mgr *auth.Manager, store *auth.SessionStore) func(http.Handler
 					WithDetails("Provide X-API-Key header or X-Session-Token header"))
 				return
 			}
+			if keyName != "" {
+				setCaller(r.Context(), "", keyName)
+				r = r.WithContext(context.WithValue(r.Context(), keyNameKey, keyName))
+			}
 			next.ServeHTTP(w, r)
 		})
 	}
 }
 
-// AuthAdmin returns a middleware that only accepts admin session tokens.
-// Read-only keys are rejected.
-func AuthAdmin(store *auth.SessionStore) func(http.Handler) http.Handler {
+// AuthAdmin returns a middleware that only accepts admin session tokens and
+// client certificates mapped to the admin role. Read-only keys are
+// rejected, as are sessions of LDAP users that were only granted the
+// read-only role.
+func AuthAdmin(mgr *auth.Manager, store *auth.SessionStore) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			token := extractToken(r)
-			if token == "" || !store.Validate(token) {
+			id, ok := store.Lookup(token)
+			if token == "" {
+				if cid, _, err := clientCert(r, mgr); err == nil && cid != nil {
+					id, ok = *cid, true
+				}
+			}
+			if !ok {
 				respondError(w, http.StatusUnauthorized, models.NewAPIError(
 					models.ErrCodeUnauthorized,
 					"Admin authentication required").
 					WithDetails("Provide a valid X-Session-Token header"))
 				return
 			}
-			next.ServeHTTP(w, r)
+			if id.Role != auth.RoleAdmin {
+				respondError(w, http.StatusForbidden, models.NewAPIError(
+					"FORBIDDEN",
+					"Admin role required"))
+				return
+			}
+			next.ServeHTTP(w, withIdentity(r, id))
 		})
 	}
 }
 
+// withIdentity returns r with the session identity attached to its context.
+func withIdentity(r *http.Request, id auth.Identity) *http.Request {
+	setCaller(r.Context(), id.Username, "")
+	ctx := context.WithValue(r.Context(), identityKey, id)
+	ctx = context.WithValue(ctx, roleKey, id.Role)
+	return r.WithContext(ctx)
+}
+
 // LocalhostOnly returns a middleware that restricts access to localhost.
-// Used to protect /api/setup in normal (post-config) mode.
+// Used to protect /api/setup in normal (post-config) mode. The client IP
+// comes from RealIP, so requests relayed by a local reverse proxy on behalf
+// of a remote client are rejected.
 // In setup mode (no config yet) the server registers /api/setup without
 // this middleware so headless servers can be configured remotely.
 func LocalhostOnly() func(http.Handler) http.Handler {
@@ -69,16 +145,33 @@ func LocalhostOnly() func(http.Handler) http.Handler {
 	}
 }
 
-// resolveRole determines the auth.Role for a request.
-func resolveRole(r *http.Request, mgr *auth.Manager, store *auth.SessionStore) auth.Role {
+// resolveRole determines the auth.Role for a request and, for read-only
+// keys, the key name. A valid key has its use recorded; an expired one
+// yields auth.ErrKeyExpired so the caller can say so.
+func resolveRole(r *http.Request, mgr *auth.Manager, store *auth.SessionStore) (auth.Role, string, error) {
 	if token := extractToken(r); token != "" && store.Validate(token) {
-		return auth.RoleAdmin
+		return auth.RoleAdmin, "", nil
 	}
 	apiKey := r.Header.Get("X-API-Key")
-	if apiKey != "" && mgr.VerifyReadOnlyKey(apiKey) != "" {
-		return auth.RoleReadOnly
+	if apiKey == "" {
+		return auth.RoleNone, "", nil
+	}
+	name, err := mgr.VerifyReadOnlyKey(apiKey)
+	if err != nil {
+		return auth.RoleNone, "", err
+	}
+	mgr.KeyUsage().Record(name, ClientIP(r))
+	return auth.RoleReadOnly, name, nil
+}
+
+// clientCert authenticates r by its verified TLS client certificate. It
+// returns nothing when the connection presented none; see
+// auth.Manager.VerifyClientCert for the results otherwise.
+func clientCert(r *http.Request, mgr *auth.Manager) (*auth.Identity, string, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return nil, "", nil
 	}
-	return auth.RoleNone
+	return mgr.VerifyClientCert(r.TLS.VerifiedChains[0][0])
 }
 
 // extractToken extracts the session token from the request headers.
@@ -94,21 +187,19 @@ func extractToken(r *http.Request) string {
 
 // isLocalhost reports whether the request originates from localhost.
 func isLocalhost(r *http.Request) bool {
-	host := r.RemoteAddr
-	if idx := strings.LastIndex(host, ":"); idx != -1 {
-		host = host[:idx]
-	}
-	host = strings.Trim(host, "[]")
-	return host == "127.0.0.1" || host == "::1" || host == "localhost"
+	ip := net.ParseIP(ClientIP(r))
+	return ip != nil && ip.IsLoopback()
 }
 
-// respondError writes a JSON error response. Defined locally to avoid
-// import cycles with the handlers package.
+// respondError writes a JSON error response carrying the request ID.
+// Defined locally to avoid import cycles with the handlers package.
 func respondError(w http.ResponseWriter, status int, err *models.APIError) {
+	body := *err
+	body.RequestID = w.Header().Get(models.RequestIDHeader)
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.Header().Set("X-Content-Type-Options", "nosniff")
 	w.WriteHeader(status)
-	if encErr := json.NewEncoder(w).Encode(err); encErr != nil {
-		log.Printf("middleware: failed to encode error response: %v", encErr)
+	if encErr := json.NewEncoder(w).Encode(&body); encErr != nil {
+		slog.Warn("Failed to encode error response", "err", encErr)
 	}
 }
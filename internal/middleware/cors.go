@@ -3,13 +3,18 @@ package middleware
 import (
 	"net/http"
 	"strings"
+
+	"github.com/phil-bot/rsyslox/internal/config"
 )
 
-// CORS returns a middleware that handles CORS
-func CORS(allowedOrigins []string) func(http.Handler) http.Handler {
+// CORS returns a middleware that handles CORS.
+// The origin list is read from live on every request, so configuration
+// changes apply without a restart.
+func CORS(live *config.Live) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			origin := r.Header.Get("Origin")
+			allowedOrigins := live.Get().Server.AllowedOrigins
 
 			// Check if origin is allowed
 			allowed := false
@@ -1,16 +1,20 @@
 package middleware
 
 import (
-	"log"
+	"context"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 )
 
-// responseWriter wraps http.ResponseWriter to capture status code
+// responseWriter wraps http.ResponseWriter to capture status code and size
 type responseWriter struct {
 	http.ResponseWriter
 	statusCode int
 	written    bool
+	bytes      int64
 }
 
 // WriteHeader captures the status code
@@ -22,15 +26,48 @@ func (rw *responseWriter) WriteHeader(code int) {
 	}
 }
 
-// Write ensures WriteHeader is called
+// Write ensures WriteHeader is called and counts the bytes sent
 func (rw *responseWriter) Write(b []byte) (int, error) {
 	if !rw.written {
 		rw.WriteHeader(http.StatusOK)
 	}
-	return rw.ResponseWriter.Write(b)
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += int64(n)
+	return n, err
 }
 
-// Logging returns a middleware that logs HTTP requests
+// caller is filled in by the auth middlewares, which run inside Logging,
+// so the access log can name who made the request.
+type caller struct {
+	user string // session, LDAP or client certificate user
+	key  string // read-only API key
+}
+
+const callerKey contextKey = "access_caller"
+
+// setCaller records the user or key of r for the access log.
+func setCaller(ctx context.Context, user, key string) {
+	if c, ok := ctx.Value(callerKey).(*caller); ok {
+		if user != "" {
+			c.user = user
+		}
+		if key != "" {
+			c.key = key
+		}
+	}
+}
+
+// redacted replaces the values of secret query parameters in the access log.
+const redacted = "[redacted]"
+
+// secretParams are substrings of query parameter names whose values are
+// not logged.
+var secretParams = []string{"key", "token", "password", "secret", "auth", "signature"}
+
+// Logging returns a middleware that writes an access log record per
+// request: client IP, method, path, query (secrets redacted), status,
+// bytes sent, duration, scheme, and the user or API key when known. The
+// request ID is added by the logger (see RequestID).
 func Logging() func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -41,18 +78,61 @@ func Logging() func(http.Handler) http.Handler {
 				ResponseWriter: w,
 				statusCode:     http.StatusOK,
 			}
+			who := &caller{}
+			r = r.WithContext(context.WithValue(r.Context(), callerKey, who))
 
 			// Call next handler
 			next.ServeHTTP(wrapped, r)
 
 			// Log request
-			duration := time.Since(start)
-			log.Printf("%s %s %d %v",
-				r.Method,
-				r.URL.Path,
-				wrapped.statusCode,
-				duration,
+			attrs := []slog.Attr{
+				slog.String("ip", ClientIP(r)),
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+			}
+			if r.URL.RawQuery != "" {
+				attrs = append(attrs, slog.String("query", redactQuery(r.URL.RawQuery)))
+			}
+			attrs = append(attrs,
+				slog.Int("status", wrapped.statusCode),
+				slog.Int64("bytes", wrapped.bytes),
+				slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+				slog.String("scheme", Scheme(r)),
 			)
+			if who.user != "" {
+				attrs = append(attrs, slog.String("user", who.user))
+			}
+			if who.key != "" {
+				attrs = append(attrs, slog.String("key", who.key))
+			}
+			slog.LogAttrs(r.Context(), slog.LevelInfo, "HTTP request", attrs...)
 		})
 	}
 }
+
+// redactQuery returns the raw query with the values of secret parameters
+// replaced, keeping the order and encoding of everything else.
+func redactQuery(raw string) string {
+	pairs := strings.Split(raw, "&")
+	for i, p := range pairs {
+		rawName, _, hasValue := strings.Cut(p, "=")
+		name, err := url.QueryUnescape(rawName)
+		if err != nil {
+			name = rawName
+		}
+		if hasValue && isSecretParam(name) {
+			pairs[i] = rawName + "=" + redacted
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+func isSecretParam(name string) bool {
+	name = strings.ToLower(name)
+	for _, s := range secretParams {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
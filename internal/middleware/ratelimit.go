@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+
+	"github.com/phil-bot/rsyslox/internal/auth"
+	"github.com/phil-bot/rsyslox/internal/models"
+	"github.com/phil-bot/rsyslox/internal/ratelimit"
+)
+
+// RateLimit returns a middleware that applies the per-IP and per-caller
+// token buckets of l. It must run after AuthReadOnly, which identifies the
+// API key or session. Rejected requests get 429 with a Retry-After header.
+func RateLimit(l *ratelimit.Limiter, mgr *auth.Manager) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := ClientIP(r)
+			caller, limit := "", 0
+			if name, ok := KeyNameFromContext(r.Context()); ok {
+				caller, limit = "key:"+name, mgr.KeyRateLimit(name)
+			} else if token := extractToken(r); token != "" {
+				caller = "session:" + auth.SessionID(token)
+			} else if id, ok := IdentityFromContext(r.Context()); ok && id.Source == "mtls" {
+				caller = "cert:" + id.Username
+			}
+
+			if wait := l.AllowRequest(ip, caller, limit); wait > 0 {
+				secs := int(math.Ceil(wait.Seconds()))
+				slog.WarnContext(r.Context(), "Rate limit exceeded", "caller", caller, "path", r.URL.Path, "ip", ip)
+				w.Header().Set("Retry-After", fmt.Sprint(secs))
+				respondError(w, http.StatusTooManyRequests,
+					models.NewAPIError(models.ErrCodeTooManyRequests, "Rate limit exceeded").
+						WithDetails(fmt.Sprintf("retry after %d seconds", secs)))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const (
+	clientIPKey contextKey = "client_ip"
+	schemeKey   contextKey = "scheme"
+)
+
+// UnixPeer is the address reported for connections on a Unix socket. It is
+// not an IP address, so such a peer never counts as localhost; listing
+// "unix" in trusted_proxies trusts its forwarded headers.
+const UnixPeer = "unix"
+
+// trustedProxies is the parsed form of server.trusted_proxies.
+type trustedProxies struct {
+	nets []*net.IPNet
+	unix bool // peers on a Unix socket, see UnixPeer
+}
+
+// RealIP returns a middleware that determines the client IP address and
+// the scheme the client used, and stores them in the request context (see
+// ClientIP and Scheme).
+//
+// X-Forwarded-For and X-Forwarded-Proto are only honoured when the direct
+// peer is one of the trusted proxies. The header is then walked from right to left, skipping
+// further trusted hops, and the first untrusted address is the client.
+// Requests from untrusted peers always use RemoteAddr, so a client cannot
+// spoof its address by sending the header itself.
+//
+// trusted accepts single IPs ("10.0.0.5"), CIDR ranges ("10.0.0.0/8") and
+// "unix" for proxies connecting through a Unix socket.
+func RealIP(trusted []string) func(http.Handler) http.Handler {
+	proxies := parseTrustedProxies(trusted)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), clientIPKey, resolveClientIP(r, proxies))
+			ctx = context.WithValue(ctx, schemeKey, resolveScheme(r, proxies))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// ClientIP returns the client IP determined by RealIP, or the host part of
+// RemoteAddr when the middleware is not installed.
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey).(string); ok && ip != "" {
+		return ip
+	}
+	return remoteHost(r)
+}
+
+// Scheme returns "https" or "http" as determined by RealIP, or from the
+// connection itself when the middleware is not installed.
+func Scheme(r *http.Request) string {
+	if s, ok := r.Context().Value(schemeKey).(string); ok {
+		return s
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// resolveScheme returns the scheme of the connection, or the one a trusted
+// proxy reports in X-Forwarded-Proto. With several comma-separated values
+// the last one, set by the proxy nearest to rsyslox, is used.
+func resolveScheme(r *http.Request, trusted trustedProxies) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if !trusted.contains(remoteHost(r)) {
+		return scheme
+	}
+	h := r.Header.Get("X-Forwarded-Proto")
+	if i := strings.LastIndex(h, ","); i != -1 {
+		h = h[i+1:]
+	}
+	switch p := strings.ToLower(strings.TrimSpace(h)); p {
+	case "http", "https":
+		return p
+	}
+	return scheme
+}
+
+func resolveClientIP(r *http.Request, trusted trustedProxies) string {
+	peer := remoteHost(r)
+	if !trusted.contains(peer) {
+		return peer
+	}
+
+	var hops []string
+	for _, h := range r.Header.Values("X-Forwarded-For") {
+		for _, part := range strings.Split(h, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				hops = append(hops, part)
+			}
+		}
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(hops[i])
+		if ip == nil {
+			// Garbage in the chain — stop at the last hop we could verify.
+			break
+		}
+		if !trusted.contains(hops[i]) {
+			return ip.String()
+		}
+	}
+	return peer
+}
+
+// remoteHost returns RemoteAddr without the port.
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return strings.Trim(r.RemoteAddr, "[]")
+	}
+	return host
+}
+
+// contains reports whether addr, an IP address or UnixPeer, is a trusted
+// proxy.
+func (t trustedProxies) contains(addr string) bool {
+	if addr == UnixPeer {
+		return t.unix
+	}
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range t.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseTrustedProxies(entries []string) trustedProxies {
+	var t trustedProxies
+	for _, e := range entries {
+		e = strings.TrimSpace(e)
+		if e == "" {
+			continue
+		}
+		if e == UnixPeer {
+			t.unix = true
+			continue
+		}
+		if !strings.Contains(e, "/") {
+			if ip := net.ParseIP(e); ip != nil {
+				bits := 128
+				if ip.To4() != nil {
+					ip, bits = ip.To4(), 32
+				}
+				t.nets = append(t.nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+				continue
+			}
+		}
+		_, n, err := net.ParseCIDR(e)
+		if err != nil {
+			slog.Warn("Ignoring invalid trusted proxy", "proxy", e, "err", err)
+			continue
+		}
+		t.nets = append(t.nets, n)
+	}
+	return t
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/phil-bot/rsyslox/internal/logging"
+	"github.com/phil-bot/rsyslox/internal/models"
+)
+
+// maxRequestIDLen bounds request IDs taken over from the client.
+const maxRequestIDLen = 128
+
+// RequestID returns a middleware that gives every request an ID: the
+// X-Request-ID header of the request when it is a plausible ID — set by a
+// reverse proxy, say — and a random one otherwise. The ID is returned in
+// the X-Request-ID response header, repeated in error responses and added
+// to every log record written with the request's context.
+func RequestID() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(models.RequestIDHeader)
+			if !validRequestID(id) {
+				id = newRequestID()
+			}
+			w.Header().Set(models.RequestIDHeader, id)
+			next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
+		})
+	}
+}
+
+// validRequestID accepts IDs of letters, digits and -_.:, which covers
+// UUIDs and the formats of common proxies and cannot forge log lines.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-' || c == '_' || c == '.' || c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns 16 random hex digits.
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b) //nolint:errcheck // crypto/rand does not fail on supported platforms
+	return hex.EncodeToString(b)
+}
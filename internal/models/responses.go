@@ -3,12 +3,18 @@ package models
 import "time"
 
 // LogsResponse is the response for the /api/logs endpoint.
+//
+// Total and DBTotal may be estimates (see the count parameter); TotalExact
+// and DBTotalExact say which, so clients can show e.g. "~1.2M".
 type LogsResponse struct {
-	Total   int        `json:"total"`    // entries matching the active filters
-	DBTotal int        `json:"db_total"` // total entries in SystemEvents (no filter)
-	Offset  int        `json:"offset"`
-	Limit   int        `json:"limit"`
-	Rows    []LogEntry `json:"rows"`
+	Total        int        `json:"total"` // entries matching the active filters
+	TotalExact   bool       `json:"total_exact"`
+	DBTotal      int        `json:"db_total"` // total entries in SystemEvents (no filter), cached
+	DBTotalExact bool       `json:"db_total_exact"`
+	HasMore      bool       `json:"has_more"` // another page follows
+	Offset       int        `json:"offset"`
+	Limit        int        `json:"limit"`
+	Rows         []LogEntry `json:"rows"`
 }
 
 // MetaValue represents a meta value with optional label (for Severity/Facility).
@@ -35,12 +41,18 @@ type HealthResponse struct {
 
 // APIError represents a structured API error response.
 type APIError struct {
-	Code    string `json:"code"`
-	Message string `json:"message"`
-	Details string `json:"details,omitempty"`
-	Field   string `json:"field,omitempty"`
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Details   string `json:"details,omitempty"`
+	Field     string `json:"field,omitempty"`
+	RequestID string `json:"request_id,omitempty"` // set by respondError from RequestIDHeader
 }
 
+// RequestIDHeader carries the ID of each request in the request (from a
+// proxy) and in the response. Error responses repeat it in request_id so
+// users can quote it when reporting a problem.
+const RequestIDHeader = "X-Request-ID"
+
 // Error implements the error interface.
 func (e *APIError) Error() string {
 	if e.Field != "" {
@@ -51,16 +63,24 @@ func (e *APIError) Error() string {
 
 // Common API error codes.
 const (
-	ErrCodeInvalidParameter = "INVALID_PARAMETER"
-	ErrCodeMissingParameter = "MISSING_PARAMETER"
-	ErrCodeDatabaseError    = "DATABASE_ERROR"
-	ErrCodeUnauthorized     = "UNAUTHORIZED"
-	ErrCodeNotFound         = "NOT_FOUND"
-	ErrCodeInvalidColumn    = "INVALID_COLUMN"
-	ErrCodeInvalidDateRange = "INVALID_DATE_RANGE"
-	ErrCodeInvalidSeverity  = "INVALID_SEVERITY"
-	ErrCodeInvalidFacility  = "INVALID_FACILITY"
-	ErrCodeInvalidPriority  = ErrCodeInvalidSeverity // backward compat
+	ErrCodeInvalidParameter    = "INVALID_PARAMETER"
+	ErrCodeMissingParameter    = "MISSING_PARAMETER"
+	ErrCodeDatabaseError       = "DATABASE_ERROR"
+	ErrCodeUnauthorized        = "UNAUTHORIZED"
+	ErrCodeNotFound            = "NOT_FOUND"
+	ErrCodeInvalidColumn       = "INVALID_COLUMN"
+	ErrCodeInvalidDateRange    = "INVALID_DATE_RANGE"
+	ErrCodeInvalidSeverity     = "INVALID_SEVERITY"
+	ErrCodeInvalidFacility     = "INVALID_FACILITY"
+	ErrCodeInvalidPriority     = ErrCodeInvalidSeverity // backward compat
+	ErrCodeTooManyRequests     = "TOO_MANY_REQUESTS"
+	ErrCodeKeyExpired          = "KEY_EXPIRED"
+	ErrCodeQueryTooExpensive   = "QUERY_TOO_EXPENSIVE"
+	ErrCodeQueryTimeout        = "QUERY_TIMEOUT"
+	ErrCodeInvalidConfig       = "INVALID_CONFIG"
+	ErrCodeInvalidCertificate  = "INVALID_CERTIFICATE"
+	ErrCodeDatabaseConnection  = "DATABASE_CONNECTION_FAILED"
+	ErrCodeDatabaseUnavailable = "DATABASE_UNAVAILABLE"
 )
 
 // NewAPIError creates a new APIError.
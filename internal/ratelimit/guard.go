@@ -0,0 +1,65 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/phil-bot/rsyslox/internal/config"
+)
+
+var (
+	// ErrTooExpensive is returned for queries above rate_limit.max_query_cost.
+	ErrTooExpensive = errors.New("query too expensive")
+
+	// ErrBusy is returned when a heavy query found no free slot within
+	// rate_limit.heavy_query_wait.
+	ErrBusy = errors.New("too many expensive queries running")
+)
+
+// Guard limits how many expensive queries run at the same time.
+type Guard struct {
+	live  *config.Live
+	slots chan struct{}
+}
+
+// NewGuard creates a Guard with rate_limit.heavy_query_slots slots.
+// The other thresholds are read from live on every call.
+func NewGuard(live *config.Live) *Guard {
+	n := live.Get().RateLimit.HeavyQuerySlots
+	if n < 1 {
+		n = 1
+	}
+	return &Guard{live: live, slots: make(chan struct{}, n)}
+}
+
+// Acquire admits a query of the given estimated cost. Cheap queries pass
+// straight through; heavy ones wait for a slot. The returned release
+// function must be called once the query has finished.
+func (g *Guard) Acquire(ctx context.Context, cost float64) (release func(), err error) {
+	noop := func() {}
+	if g == nil {
+		return noop, nil
+	}
+	cfg := g.live.Get().RateLimit
+	if !cfg.Enabled {
+		return noop, nil
+	}
+	if cfg.MaxQueryCost > 0 && cost > cfg.MaxQueryCost {
+		return nil, ErrTooExpensive
+	}
+	if cost <= cfg.HeavyQueryCost {
+		return noop, nil
+	}
+
+	timer := time.NewTimer(cfg.HeavyQueryWait)
+	defer timer.Stop()
+	select {
+	case g.slots <- struct{}{}:
+		return func() { <-g.slots }, nil
+	case <-timer.C:
+		return nil, ErrBusy
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,136 @@
+// Package ratelimit protects the database from clients that send too many
+// or too expensive queries: token buckets per API key, session and client
+// IP, and a guard that rejects or queues queries by their estimated cost.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/phil-bot/rsyslox/internal/config"
+)
+
+// idleBucketTTL is how long an untouched bucket is kept. After this long
+// it would be full again anyway, so dropping it changes nothing.
+const idleBucketTTL = 10 * time.Minute
+
+// bucket is a token bucket. Tokens are refilled lazily on access.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter holds one token bucket per caller (API key, session or IP).
+// State is in memory and resets on restart.
+type Limiter struct {
+	live *config.Live
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+// New creates a Limiter reading its limits from the rate_limit settings of
+// live, so admin config changes apply immediately.
+func New(live *config.Live) *Limiter {
+	l := &Limiter{
+		live:    live,
+		buckets: make(map[string]*bucket),
+	}
+	go l.cleanupLoop()
+	return l
+}
+
+// limit is one bucket a request has to pass.
+type limit struct {
+	key       string
+	perMinute int
+}
+
+// AllowRequest applies both limits to an API request: the client IP's
+// bucket and the bucket of the caller (an API key or session, identified by
+// caller). callerLimit overrides rate_limit.requests_per_minute when > 0.
+// A token is only taken when both buckets allow the request, so a caller
+// over its limit does not use up the budget of its IP. It returns zero or
+// the time until the request would be allowed.
+func (l *Limiter) AllowRequest(ip, caller string, callerLimit int) time.Duration {
+	cfg := &l.live.Get().RateLimit
+	limits := []limit{{"ip:" + ip, cfg.IPRequestsPerMinute}}
+	if caller != "" {
+		if callerLimit <= 0 {
+			callerLimit = cfg.RequestsPerMinute
+		}
+		limits = append(limits, limit{caller, callerLimit})
+	}
+	return l.take(cfg, limits...)
+}
+
+// Allow takes one token from the bucket named key, which is refilled at
+// perMinute tokens per minute and holds at most rate_limit.burst tokens.
+// It returns zero when the request may proceed, or how long the caller
+// has to wait for the next token.
+func (l *Limiter) Allow(key string, perMinute int) time.Duration {
+	return l.take(&l.live.Get().RateLimit, limit{key, perMinute})
+}
+
+// take takes one token from each of the buckets if all of them have one.
+// Otherwise it takes none and returns the longest wait.
+func (l *Limiter) take(cfg *config.RateLimitConfig, limits ...limit) time.Duration {
+	if !cfg.Enabled {
+		return 0
+	}
+	burst := float64(cfg.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	var wait time.Duration
+	var ready []*bucket
+	for _, lim := range limits {
+		if lim.perMinute <= 0 {
+			continue
+		}
+		rate := float64(lim.perMinute) / 60 // tokens per second
+		b, ok := l.buckets[lim.key]
+		if !ok {
+			b = &bucket{tokens: burst, last: now}
+			l.buckets[lim.key] = b
+		}
+		b.tokens += now.Sub(b.last).Seconds() * rate
+		if b.tokens > burst {
+			b.tokens = burst
+		}
+		b.last = now
+
+		if b.tokens < 1 {
+			wait = max(wait, time.Duration((1-b.tokens)/rate*float64(time.Second)))
+			continue
+		}
+		ready = append(ready, b)
+	}
+	if wait > 0 {
+		return wait
+	}
+	for _, b := range ready {
+		b.tokens--
+	}
+	return 0
+}
+
+func (l *Limiter) cleanupLoop() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		l.mu.Lock()
+		cutoff := time.Now().Add(-idleBucketTTL)
+		for key, b := range l.buckets {
+			if b.last.Before(cutoff) {
+				delete(l.buckets, key)
+			}
+		}
+		l.mu.Unlock()
+	}
+}
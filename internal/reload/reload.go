@@ -0,0 +1,244 @@
+// Package reload applies a changed config.toml to the running server.
+//
+// A reload re-reads and validates the file, prepares everything that can
+// fail (TLS certificate, database connection) and only then replaces the
+// running configuration. An invalid file is rejected and the current
+// configuration stays in effect.
+package reload
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/phil-bot/rsyslox/internal/audit"
+	"github.com/phil-bot/rsyslox/internal/cleanup"
+	"github.com/phil-bot/rsyslox/internal/config"
+	"github.com/phil-bot/rsyslox/internal/database"
+	"github.com/phil-bot/rsyslox/internal/logging"
+	"github.com/phil-bot/rsyslox/internal/tlscert"
+)
+
+// restartRequired lists the settings (dotted TOML keys or key prefixes)
+// that are only read at startup.
+var restartRequired = []string{
+	"server.host",
+	"server.port",
+	"server.use_ssl",
+	"server.listen",
+	"server.socket_mode",
+	"server.trusted_proxies",
+	"server.base_path",
+	"server.read_timeout",
+	"server.write_timeout",
+	"server.idle_timeout",
+	"server.acme",
+	"database.total_refresh",
+	"database.exact_db_total",
+	"auth.key_usage_file",
+	"auth.sessions.store",
+	"auth.sessions.file",
+	"auth.mtls.enabled",
+	"auth.mtls.client_ca",
+	"auth.mtls.required",
+	"audit.file",
+	"audit.syslog",
+	"rate_limit.heavy_query_slots",
+	"logging.format",
+}
+
+// dbSettings are the settings that need a new database connection.
+var dbSettings = []string{
+	"database.host",
+	"database.port",
+	"database.name",
+	"database.user",
+	"database.password",
+}
+
+// Result describes a successful reload.
+type Result struct {
+	Changes         []audit.Change `json:"changes"`          // secrets redacted
+	Applied         []string       `json:"applied"`          // settings now in effect
+	RestartRequired []string       `json:"restart_required"` // settings saved but not yet in effect
+}
+
+// Reloader re-reads config.toml and applies it in place.
+type Reloader struct {
+	live    *config.Live
+	db      *database.DB
+	cleaner *cleanup.Cleaner
+	certs   *tlscert.Store
+}
+
+// New creates a Reloader for the running configuration held by live.
+func New(live *config.Live, db *database.DB, cleaner *cleanup.Cleaner, certs *tlscert.Store) *Reloader {
+	return &Reloader{live: live, db: db, cleaner: cleaner, certs: certs}
+}
+
+// ErrDatabase wraps the error of a failed connection with new database
+// settings.
+var ErrDatabase = errors.New("database")
+
+// Reload loads and validates config.toml and applies the differences.
+// On error nothing has been changed.
+func (r *Reloader) Reload() (*Result, error) {
+	next, setupMode, err := config.Load()
+	if err != nil {
+		return nil, err
+	}
+	if setupMode {
+		return nil, fmt.Errorf("%s does not exist", config.ActiveConfigPath())
+	}
+	return r.apply(func(*config.Config) (*config.Config, error) { return next, nil }, nil)
+}
+
+// Rollback restores version n of the configuration history (see
+// config.Restore) and applies it like Reload. With new database settings
+// the new connection is opened before the version is saved as
+// config.toml, and only swapped in once it is saved; on error nothing has
+// been changed.
+func (r *Reloader) Rollback(n int, origin config.Origin) (*Result, error) {
+	return r.apply(func(running *config.Config) (*config.Config, error) {
+		return config.Restore(running, n)
+	}, &origin)
+}
+
+// Update applies an admin change like Rollback: change edits a copy of
+// the running configuration and is expected to validate it; its errors
+// are returned as they are. The copy is saved with origin.
+func (r *Reloader) Update(change func(next *config.Config) error, origin config.Origin) (*Result, error) {
+	return r.apply(func(running *config.Config) (*config.Config, error) {
+		next := running.Clone()
+		if err := change(next); err != nil {
+			return nil, err
+		}
+		return next, nil
+	}, &origin)
+}
+
+// apply replaces the running configuration with the one build returns
+// for it. With origin set the new configuration is saved once everything
+// that can be checked has been.
+func (r *Reloader) apply(build func(running *config.Config) (*config.Config, error), origin *config.Origin) (*Result, error) {
+	var res *Result
+	var next *config.Config
+	var cert *tls.Certificate
+	reconnected := false
+
+	// Everything up to the swap runs as one update, so reloads and admin
+	// changes are applied one at a time.
+	err := r.live.Update(func(running *config.Config) error {
+		var err error
+		if next, err = build(running); err != nil {
+			return err
+		}
+		changes := audit.Diff(audit.Snapshot(running), audit.Snapshot(next))
+		res = &Result{Changes: changes, Applied: []string{}, RestartRequired: []string{}}
+
+		// The certificate files may have been replaced without a config
+		// change, so they are re-read on every reload while TLS is being
+		// served.
+		if r.certs != nil && r.certs.Loaded() && next.Server.UseSSL {
+			cert, err = tlscert.LoadPair(next.Server.SSLCertFile, next.Server.SSLKeyFile)
+			if err != nil {
+				return err
+			}
+		}
+		if len(changes) == 0 {
+			return nil
+		}
+
+		// The new pool is opened first and swapped in last, so a failed
+		// connection or save leaves the running pool and config.toml as
+		// they were.
+		var fresh *database.Pool
+		if r.db != nil && changed(changes, dbSettings) {
+			fresh, err = database.OpenPool(next)
+			if err != nil {
+				return fmt.Errorf("%w: %w", ErrDatabase, err)
+			}
+		}
+		if origin != nil {
+			if err := config.Save(next, *origin); err != nil {
+				if fresh != nil {
+					fresh.Discard()
+				}
+				return err
+			}
+		}
+		if fresh != nil {
+			r.db.Use(fresh, next)
+			reconnected = true
+		}
+
+		*running = *next
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if cert != nil {
+		r.certs.Set(cert)
+	}
+	if len(res.Changes) == 0 {
+		slog.Info("Configuration reloaded, no changes")
+		return res, nil
+	}
+
+	if r.cleaner != nil {
+		if reconnected {
+			r.cleaner.UpdateDB(r.db.Pool().DB)
+		}
+		if changed(res.Changes, []string{"cleanup."}) {
+			r.cleaner.UpdateConfig(cleanup.Config{
+				Enabled:          next.Cleanup.Enabled,
+				DiskPath:         next.Cleanup.DiskPath,
+				ThresholdPercent: next.Cleanup.ThresholdPercent,
+				BatchSize:        next.Cleanup.BatchSize,
+				Interval:         next.Cleanup.Interval,
+			})
+		}
+	}
+
+	if changed(res.Changes, []string{"logging.level"}) {
+		logging.SetLevel(next.Logging.Level) //nolint:errcheck // validated by config.Load
+	}
+
+	for _, c := range res.Changes {
+		if matches(c.Field, restartRequired) {
+			res.RestartRequired = append(res.RestartRequired, c.Field)
+		} else {
+			res.Applied = append(res.Applied, c.Field)
+		}
+	}
+
+	slog.Info("Configuration reloaded", "applied", len(res.Applied))
+	if len(res.RestartRequired) > 0 {
+		slog.Warn("Restart required", "settings", strings.Join(res.RestartRequired, ","))
+	}
+	return res, nil
+}
+
+// changed reports whether any change affects one of the given settings.
+func changed(changes []audit.Change, settings []string) bool {
+	for _, c := range changes {
+		if matches(c.Field, settings) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether field is one of prefixes or starts with one.
+func matches(field string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(field, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"bytes"
+	"html"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// baseHrefRe matches the <base> element of the frontend's index.html.
+var baseHrefRe = regexp.MustCompile(`<base\s+href="[^"]*"\s*/?>`)
+
+// withBasePath serves h below prefix (server.base_path). The prefix is
+// stripped before routing, so handlers keep working with root paths such
+// as /api/admin/keys/. The prefix itself redirects to prefix + "/"; paths
+// outside it are not found.
+func withBasePath(prefix string, h http.Handler) http.Handler {
+	if prefix == "" {
+		return h
+	}
+	strip := http.StripPrefix(prefix, h)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == prefix:
+			target := prefix + "/"
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+		case strings.HasPrefix(r.URL.Path, prefix+"/"):
+			strip.ServeHTTP(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// withBaseHref sets the <base href> of index.html to base, so the app's
+// relative asset and API URLs resolve below server.base_path. The element
+// is added to <head> when the build does not contain one.
+func withBaseHref(index []byte, base string) []byte {
+	tag := []byte(`<base href="` + html.EscapeString(base) + `">`)
+	if baseHrefRe.Match(index) {
+		return baseHrefRe.ReplaceAllLiteral(index, tag)
+	}
+	return bytes.Replace(index, []byte("<head>"), append([]byte("<head>\n    "), tag...), 1)
+}
+
+// withServerURL lists base as the first server of the OpenAPI document,
+// so "Try it" requests from the embedded docs reach this instance.
+func withServerURL(spec []byte, base string) []byte {
+	entry := "servers:\n  - url: " + base + "\n    description: This server\n"
+	return bytes.Replace(spec, []byte("servers:\n"), []byte(entry), 1)
+}
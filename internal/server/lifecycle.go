@@ -0,0 +1,182 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrRestart is returned by Start after a restart was requested and the
+// server has drained. The caller releases its resources and calls Reexec.
+var ErrRestart = errors.New("restart requested")
+
+// Restart asks Start to drain and return ErrRestart. It does not block.
+func (s *Server) Restart() {
+	select {
+	case s.restartCh <- struct{}{}:
+	default: // already pending
+	}
+}
+
+// serve runs the HTTP server on lns until SIGTERM/SIGINT or Restart, then
+// drains in-flight requests for at most server.shutdown_timeout. SIGHUP
+// reloads the configuration.
+func (s *Server) serve(lns []listener) error {
+	cfg := s.live.Get()
+	s.httpServer = &http.Server{
+		Handler:           s.handler(),
+		ReadHeaderTimeout: cfg.Server.ReadTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
+
+	if s.certs.Loaded() {
+		// Certificates are looked up per handshake so they can be replaced
+		// at runtime (see tlscert.Store).
+		s.httpServer.TLSConfig = &tls.Config{
+			GetCertificate: s.certs.GetCertificate,
+			NextProtos:     s.certs.NextProtos(),
+		}
+		if s.clientCAs != nil {
+			s.httpServer.TLSConfig.ClientCAs = s.clientCAs
+			s.httpServer.TLSConfig.ClientAuth = tls.VerifyClientCertIfGiven
+			if cfg.Auth.MTLS.Required {
+				s.httpServer.TLSConfig.ClientAuth = tls.RequireAndVerifyClientCert
+			}
+		}
+		if s.certs.ACMEEnabled() {
+			s.startACMEHTTP()
+		}
+	}
+
+	errCh := make(chan error, len(lns))
+	for _, l := range lns {
+		var ln net.Listener = l.Listener
+		if ln.Addr().Network() == "unix" {
+			ln = unixPeers{ln}
+		}
+		if l.spec.TLS {
+			ln = tls.NewListener(ln, s.httpServer.TLSConfig)
+		}
+		go func() { errCh <- s.httpServer.Serve(ln) }()
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+	defer signal.Stop(sigCh)
+
+	stopWatch := make(chan struct{})
+	defer close(stopWatch)
+	go s.watchConfig(stopWatch)
+
+	for {
+		select {
+		case err := <-errCh:
+			// One listener failed; stop serving on the others too.
+			s.drain()
+			return err
+		case sig := <-sigCh:
+			if sig == syscall.SIGHUP {
+				s.reloadConfig("SIGHUP")
+				continue
+			}
+			slog.Info("Shutting down", "signal", sig.String())
+			s.drain()
+			return nil
+		case <-s.restartCh:
+			slog.Info("Restart requested, handing over the listening sockets")
+			s.handOver(lns)
+			s.drain()
+			return ErrRestart
+		}
+	}
+}
+
+// startACMEHTTP serves HTTP-01 challenges on server.acme.http_port.
+// Other requests on that port are redirected to HTTPS.
+func (s *Server) startACMEHTTP() {
+	cfg := s.live.Get()
+	port := cfg.Server.ACME.HTTPPort
+	if port == 0 {
+		return
+	}
+	s.acmeServer = &http.Server{
+		Addr:              net.JoinHostPort(cfg.Server.Host, strconv.Itoa(port)),
+		Handler:           s.certs.ACMEHTTPHandler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		slog.Info("ACME: answering HTTP-01 challenges", "addr", s.acmeServer.Addr)
+		if err := s.acmeServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Warn("ACME: HTTP-01 listener failed, only TLS-ALPN-01 is available", "err", err)
+		}
+	}()
+}
+
+// drain stops accepting connections and waits for in-flight requests.
+// From now on /readyz reports the server as not ready.
+func (s *Server) drain() {
+	s.draining.Store(true)
+	ctx, cancel := context.WithTimeout(context.Background(), s.live.Get().Server.ShutdownTimeout)
+	defer cancel()
+	if s.acmeServer != nil {
+		s.acmeServer.Shutdown(ctx) //nolint:errcheck
+	}
+	if err := s.httpServer.Shutdown(ctx); err != nil {
+		slog.Warn("Graceful shutdown incomplete, closing remaining connections", "err", err)
+		s.httpServer.Close() //nolint:errcheck
+		return
+	}
+	slog.Info("All connections drained")
+}
+
+// Close flushes and closes the server's own state: sessions, key usage
+// and the audit log. Call it after Start has returned.
+func (s *Server) Close() {
+	s.sessionStore.Flush()
+	s.authMgr.KeyUsage().Flush()
+	if err := s.audit.Close(); err != nil {
+		slog.Warn("Audit log", "err", err)
+	}
+}
+
+// Reexec replaces the process with a fresh instance of the same binary,
+// passing on the listening sockets kept by a restart. The PID stays the
+// same, so systemd and Docker see no change. Only returns on error.
+func (s *Server) Reexec() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("could not find executable: %w", err)
+	}
+
+	env := os.Environ()
+	var passed []string
+	for _, h := range s.handover {
+		fd := int(h.file.Fd())
+		// Dup'ed descriptors are close-on-exec; clear the flag so the new
+		// process image inherits the socket.
+		if _, _, errno := syscall.Syscall(syscall.SYS_FCNTL, uintptr(fd), syscall.F_SETFD, 0); errno != 0 {
+			slog.Warn("Cannot pass socket to new process", "socket", h.key, "err", errno)
+			continue
+		}
+		passed = append(passed, strconv.Itoa(fd)+"="+h.key)
+	}
+	if len(passed) > 0 {
+		env = append(env, envListeners+"="+strings.Join(passed, ";"))
+	}
+
+	slog.Info("Restarting", "exec", exe, "args", os.Args)
+	return syscall.Exec(exe, os.Args, env)
+}
@@ -0,0 +1,277 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/phil-bot/rsyslox/internal/config"
+	"github.com/phil-bot/rsyslox/internal/middleware"
+)
+
+// Environment variables that hand the listening sockets to the
+// re-executed process: "fd=network:address;…", keyed like
+// config.ListenSpec.Key so the new process can tell whether its
+// configuration still asks for the same sockets.
+const envListeners = "RSYSLOX_LISTENERS"
+
+// Set by versions that served a single socket. Still read so that a
+// restart into this version keeps the socket.
+const (
+	envListenFD   = "RSYSLOX_LISTEN_FD"
+	envListenAddr = "RSYSLOX_LISTEN_ADDR"
+)
+
+// listener is a socket the server accepts connections on.
+type listener struct {
+	net.Listener // the raw socket; TLS is added in serve
+	spec         config.ListenSpec
+}
+
+// String returns the address for log messages.
+func (l listener) String() string {
+	if l.spec.Network == "systemd" {
+		scheme := "http"
+		if l.spec.TLS {
+			scheme = "https"
+		}
+		return fmt.Sprintf("%s %s (systemd socket %q)", scheme, l.Addr(), l.spec.Address)
+	}
+	return l.spec.String()
+}
+
+// listen opens the sockets of server.listen. Sockets handed over by the
+// previous process or passed by systemd are reused where the
+// configuration matches; a new one is opened for every other entry.
+func (s *Server) listen() ([]listener, error) {
+	cfg := s.live.Get()
+	specs, err := cfg.Server.Listeners()
+	if err != nil {
+		return nil, err
+	}
+	inherited := inheritedSockets()
+	if len(cfg.Server.Listen) == 0 && hasSystemdSockets(inherited) {
+		// Socket activation without explicit configuration: serve on
+		// whatever the .socket unit passed instead of host:port.
+		specs = []config.ListenSpec{{Network: "systemd", TLS: cfg.Server.UseSSL}}
+	}
+
+	var lns []listener
+	fail := func(err error) ([]listener, error) {
+		for _, l := range lns {
+			l.Close()
+		}
+		closeUnused(inherited)
+		return nil, err
+	}
+
+	for _, spec := range specs {
+		if spec.Network == "systemd" {
+			found := false
+			for key, list := range inherited {
+				name, ok := strings.CutPrefix(key, "systemd:")
+				if !ok || (spec.Address != "" && name != spec.Address) {
+					continue
+				}
+				for _, ln := range list {
+					lns = append(lns, listener{ln, config.ListenSpec{Network: "systemd", Address: name, TLS: spec.TLS}})
+				}
+				delete(inherited, key)
+				found = true
+			}
+			if !found {
+				return fail(fmt.Errorf("listen %s: no matching socket passed by systemd", spec))
+			}
+			continue
+		}
+
+		if list := inherited[spec.Key()]; len(list) > 0 {
+			lns = append(lns, listener{list[0], spec})
+			inherited[spec.Key()] = list[1:]
+			slog.Info("Took over listening socket", "socket", spec.String())
+			continue
+		}
+		ln, err := s.openSocket(spec)
+		if err != nil {
+			return fail(fmt.Errorf("listen %s: %w", spec, err))
+		}
+		lns = append(lns, listener{ln, spec})
+	}
+	closeUnused(inherited)
+	return lns, nil
+}
+
+// openSocket creates a new TCP or Unix socket.
+func (s *Server) openSocket(spec config.ListenSpec) (net.Listener, error) {
+	if spec.Network != "unix" {
+		return net.Listen("tcp", spec.Address)
+	}
+	mode, err := s.live.Get().Server.UnixSocketMode()
+	if err != nil {
+		return nil, err
+	}
+	if err := removeStaleSocket(spec.Address); err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen("unix", spec.Address)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(spec.Address, mode); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// removeStaleSocket deletes a socket file left behind by a process that
+// is no longer running. A socket somebody still accepts on is an error.
+func removeStaleSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+	if c, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		c.Close()
+		return fmt.Errorf("%s is in use by another process", path)
+	}
+	return os.Remove(path)
+}
+
+// inheritedSockets collects the sockets handed over by Reexec and those
+// passed by systemd socket activation, keyed by config.ListenSpec.Key;
+// systemd sockets as "systemd:<FileDescriptorName>". The environment
+// variables are cleared so they are not passed on.
+func inheritedSockets() map[string][]net.Listener {
+	sockets := make(map[string][]net.Listener)
+	add := func(key string, fd int) {
+		f := os.NewFile(uintptr(fd), key)
+		ln, err := net.FileListener(f)
+		f.Close() // FileListener dups the descriptor
+		if err != nil {
+			slog.Warn("Cannot use inherited socket", "socket", key, "err", err)
+			return
+		}
+		sockets[key] = append(sockets[key], ln)
+	}
+
+	if v := os.Getenv(envListeners); v != "" {
+		for _, e := range strings.Split(v, ";") {
+			fdStr, key, _ := strings.Cut(e, "=")
+			if fd, err := strconv.Atoi(fdStr); err == nil && key != "" {
+				add(key, fd)
+			}
+		}
+	} else if fdStr := os.Getenv(envListenFD); fdStr != "" {
+		if fd, err := strconv.Atoi(fdStr); err == nil {
+			add("tcp:"+os.Getenv(envListenAddr), fd)
+		}
+	}
+
+	// sd_listen_fds(3): descriptors start at 3 and belong to us only if
+	// LISTEN_PID matches. After Reexec they are already in RSYSLOX_LISTENERS.
+	if pid, _ := strconv.Atoi(os.Getenv("LISTEN_PID")); pid == os.Getpid() {
+		n, _ := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+		names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+		for i := 0; i < n; i++ {
+			fd := 3 + i
+			syscall.CloseOnExec(fd)
+			name := "unknown"
+			if i < len(names) && names[i] != "" {
+				name = names[i]
+			}
+			add("systemd:"+name, fd)
+		}
+	}
+
+	for _, k := range []string{envListeners, envListenFD, envListenAddr, "LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+		os.Unsetenv(k)
+	}
+	return sockets
+}
+
+func hasSystemdSockets(sockets map[string][]net.Listener) bool {
+	for key, list := range sockets {
+		if strings.HasPrefix(key, "systemd:") && len(list) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// closeUnused closes inherited sockets the configuration no longer asks for.
+func closeUnused(sockets map[string][]net.Listener) {
+	for key, list := range sockets {
+		for _, ln := range list {
+			slog.Info("Socket is no longer configured, closing it", "socket", key)
+			ln.Close()
+			if path, ok := strings.CutPrefix(key, "unix:"); ok {
+				os.Remove(path) //nolint:errcheck
+			}
+		}
+	}
+}
+
+// handOver keeps duplicates of the listening sockets open for Reexec:
+// Shutdown closes the listeners, but the kernel keeps queueing new
+// connections on the duplicates until the new process accepts them.
+func (s *Server) handOver(lns []listener) {
+	for _, l := range lns {
+		if ul, ok := l.Listener.(*net.UnixListener); ok {
+			// The new process serves the same socket file.
+			ul.SetUnlinkOnClose(false)
+		}
+		f, err := listenerFile(l.Listener)
+		if err != nil {
+			slog.Warn("Cannot hand over socket, restart will briefly refuse connections", "socket", l.String(), "err", err)
+			continue
+		}
+		s.handover = append(s.handover, handover{f, l.spec.Key()})
+	}
+}
+
+// handover is a socket passed to the re-executed process.
+type handover struct {
+	file *os.File
+	key  string
+}
+
+// listenerFile returns a duplicate of the listener's file descriptor.
+func listenerFile(ln net.Listener) (*os.File, error) {
+	fl, ok := ln.(interface{ File() (*os.File, error) })
+	if !ok {
+		return nil, fmt.Errorf("listener %T has no file descriptor", ln)
+	}
+	return fl.File()
+}
+
+// unixPeers reports connections on a Unix socket as coming from
+// middleware.UnixPeer. The peer runs on this host but may relay requests
+// for anyone, so it must not pass LocalhostOnly; its forwarded client IP
+// is used only when trusted_proxies lists "unix".
+type unixPeers struct{ net.Listener }
+
+func (l unixPeers) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return unixConn{c}, nil
+}
+
+type unixConn struct{ net.Conn }
+
+func (unixConn) RemoteAddr() net.Addr {
+	return &net.UnixAddr{Name: middleware.UnixPeer, Net: "unix"}
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/phil-bot/rsyslox/internal/audit"
+	"github.com/phil-bot/rsyslox/internal/config"
+)
+
+// configWatchInterval is how often config.toml is checked for changes when
+// server.watch_config is enabled.
+const configWatchInterval = 2 * time.Second
+
+// reloadConfig re-reads config.toml and records the outcome in the audit
+// log. source names the trigger ("SIGHUP", "file change").
+func (s *Server) reloadConfig(source string) {
+	if s.reloader == nil {
+		slog.Warn("Configuration reload is not available in setup mode", "source", source)
+		return
+	}
+	slog.Info("Reloading configuration", "source", source)
+
+	e := audit.Entry{Action: audit.ActionConfigReload, Details: source}
+	res, err := s.reloader.Reload()
+	if err != nil {
+		slog.Warn("Config reload rejected, keeping the current configuration", "source", source, "err", err)
+		e.Outcome = audit.OutcomeFailure
+		e.Details = source + ": " + err.Error()
+		s.audit.Record(e)
+		return
+	}
+	if len(res.Changes) > 0 {
+		e.Changes = res.Changes
+		s.audit.Record(e)
+	}
+}
+
+// watchConfig polls config.toml while server.watch_config is enabled and
+// reloads it after it changed. A change is only acted on once the file has
+// stayed the same for one interval, so a file that is still being written
+// is not read half-way. Returns when stop is closed.
+func (s *Server) watchConfig(stop <-chan struct{}) {
+	if s.reloader == nil {
+		return
+	}
+	path := config.ActiveConfigPath()
+	loaded := statFile(path)
+	seen := loaded
+
+	ticker := time.NewTicker(configWatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		if !s.live.Get().Server.WatchConfig {
+			st := statFile(path)
+			loaded, seen = st, st
+			continue
+		}
+		st := statFile(path)
+		if st != seen {
+			seen = st
+			continue
+		}
+		if st != loaded {
+			loaded = st
+			s.reloadConfig("file change")
+		}
+	}
+}
+
+// fileState identifies a version of a file.
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+func statFile(path string) fileState {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return fileState{}
+	}
+	return fileState{modTime: fi.ModTime(), size: fi.Size()}
+}
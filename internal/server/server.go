@@ -3,24 +3,40 @@
 //
 //	/                  → embedded Vue frontend (or setup wizard redirect)
 //	/docs              → embedded Redoc API documentation
-//	/health            → health check (public)
+//	/health            → health check with UI defaults (public)
+//	/livez, /readyz    → liveness and readiness probes (public, not logged)
 //	/api/setup         → first-run wizard (localhost only, no config)
+//	/api/setup/test-db → database checklist for the wizard (setup mode only)
 //	/api/admin/login   → admin login (public)
 //	/api/admin/logout  → admin logout (admin token)
 //	/api/admin/config  → configuration (admin token)
+//	/api/admin/config/test-db → database checklist for new settings (admin token)
+//	/api/admin/config/reload → re-read config.toml (admin token)
+//	/api/admin/config/history, /rollback/ → saved versions, diff, rollback (admin token)
 //	/api/admin/keys    → read-only key management (admin token)
+//	/api/admin/ssl     → TLS certificate info, generate, upload (admin token)
+//	/api/admin/mtls    → client certificate mappings (admin token)
+//	/api/admin/2fa     → TOTP enrollment for the local admin (admin token)
+//	/api/admin/lockouts → failed-login lockouts (admin token)
+//	/api/admin/sessions → active admin sessions, revoke (admin token)
+//	/api/admin/audit   → audit trail of admin actions (admin token)
+//	/api/admin/diagnostics → build, database, cleanup and TLS state (admin token)
 //	/api/logs          → log entries (read-only key or admin token)
 //	/api/meta          → metadata (read-only key or admin token)
 //	/api/meta/         → metadata column values (read-only key or admin token)
 package server
 
 import (
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"io/fs"
-	"log"
+	"log/slog"
 	"net/http"
 	"strings"
+	"sync/atomic"
 
+	"github.com/phil-bot/rsyslox/internal/audit"
 	"github.com/phil-bot/rsyslox/internal/auth"
 	"github.com/phil-bot/rsyslox/internal/cleanup"
 	"github.com/phil-bot/rsyslox/internal/config"
@@ -29,43 +45,78 @@ import (
 	"github.com/phil-bot/rsyslox/internal/handlers/admin"
 	"github.com/phil-bot/rsyslox/internal/handlers/setup"
 	"github.com/phil-bot/rsyslox/internal/middleware"
+	"github.com/phil-bot/rsyslox/internal/ratelimit"
+	"github.com/phil-bot/rsyslox/internal/reload"
+	"github.com/phil-bot/rsyslox/internal/tlscert"
 )
 
 // Server represents the HTTP server.
 type Server struct {
-	cfg          *config.Config
+	live         *config.Live
 	db           *database.DB
 	router       *http.ServeMux
 	version      string
 	setupMode    bool
 	authMgr      *auth.Manager
 	sessionStore *auth.SessionStore
+	loginLimiter *auth.LoginLimiter
+	audit        *audit.Logger    // nil in setup mode
+	rateLimiter  *ratelimit.Limiter
+	queryGuard   *ratelimit.Guard
 	cleaner      *cleanup.Cleaner // may be nil in setup mode
+	certs        *tlscert.Store
+	reloader     *reload.Reloader // nil in setup mode
+	clientCAs    *x509.CertPool   // auth.mtls.client_ca; nil without mTLS
+
+	httpServer *http.Server
+	acmeServer *http.Server // HTTP-01 challenges; nil without ACME
+	restartCh  chan struct{}
+	draining   atomic.Bool // set once a shutdown or restart has begun
+	handover   []handover // listening sockets kept open for the next process
 }
 
-// New creates a new Server instance.
+// New creates a new Server instance running the configuration held by live.
 // setupMode=true means no config file was found; only the setup wizard is enabled.
 // cleaner may be nil in setup mode.
-func New(cfg *config.Config, db *database.DB, version string, setupMode bool, cleaner *cleanup.Cleaner) *Server {
+func New(live *config.Live, db *database.DB, version string, setupMode bool, cleaner *cleanup.Cleaner) *Server {
+	var auditLog *audit.Logger
+	var reloader *reload.Reloader
+	certs := tlscert.NewStore(live)
+	if !setupMode {
+		var err error
+		auditLog, err = audit.Open(live)
+		if err != nil {
+			slog.Warn("Audit log", "err", err)
+		}
+		reloader = reload.New(live, db, cleaner, certs)
+	}
 	return &Server{
-		cfg:          cfg,
+		live:         live,
 		db:           db,
 		router:       http.NewServeMux(),
 		version:      version,
 		setupMode:    setupMode,
-		authMgr:      auth.New(cfg),
-		sessionStore: auth.NewSessionStore(),
+		authMgr:      auth.New(live),
+		sessionStore: auth.NewSessionStore(live),
+		loginLimiter: auth.NewLoginLimiter(live),
+		audit:        auditLog,
+		rateLimiter:  ratelimit.New(live),
+		queryGuard:   ratelimit.NewGuard(live),
+		restartCh:    make(chan struct{}, 1),
 		cleaner:      cleaner,
+		certs:        certs,
+		reloader:     reloader,
 	}
 }
 
 // SetupRoutes configures all HTTP routes and middleware.
 func (s *Server) SetupRoutes() {
-	cors := middleware.CORS(s.cfg.Server.AllowedOrigins)
+	cors := middleware.CORS(s.live)
 	logging := middleware.Logging()
 	authRO := middleware.AuthReadOnly(s.authMgr, s.sessionStore)
-	authAdmin := middleware.AuthAdmin(s.sessionStore)
+	authAdmin := middleware.AuthAdmin(s.authMgr, s.sessionStore)
 	localhostOnly := middleware.LocalhostOnly()
+	rateLimit := middleware.RateLimit(s.rateLimiter, s.authMgr)
 
 	// --- Frontend ---
 	frontendHandler := s.frontendHandler()
@@ -76,81 +127,143 @@ func (s *Server) SetupRoutes() {
 	// /docs prefix must be removed before the FileServer looks up the file.
 	docsHandler := http.StripPrefix("/docs", s.docsHandler())
 	// Redirect /docs → /docs/ so the FileServer resolves index.html correctly
-	s.router.Handle("/docs", http.RedirectHandler("/docs/", http.StatusMovedPermanently))
+	s.router.Handle("/docs", http.RedirectHandler(s.live.Get().Server.Prefix()+"/docs/", http.StatusMovedPermanently))
 	s.router.Handle("/docs/", cors(logging(docsHandler)))
 
-	// --- Health (public) — passes cfg for server defaults ---
-	healthHandler := handlers.NewHealthHandler(s.db, s.version, s.cfg)
+	// --- Health (public) — passes the config for server defaults ---
+	healthHandler := handlers.NewHealthHandler(s.db, s.version, s.live)
 	s.router.Handle("/health", cors(logging(healthHandler)))
 
+	// --- Probes (public) — not logged, orchestrators poll them every few seconds ---
+	s.router.Handle("/livez", handlers.NewLivezHandler())
+	s.router.Handle("/readyz", handlers.NewReadyzHandler(s.db, s.draining.Load))
+
 	// --- Setup wizard ---
 	// In setup mode (no config.toml yet): accessible from any host so headless
 	// servers and Docker containers can be configured via browser.
 	// In normal mode: wrapped in LocalhostOnly as a safety net.
-	setupHandler := setup.New(s.cfg, s.sessionStore)
+	setupHandler := setup.New(s.live, s.sessionStore, s.Restart)
 	if s.setupMode {
 		s.router.Handle("/api/setup", cors(logging(setupHandler)))
-		log.Println("⚠️  Running in setup mode — open the web UI to complete setup")
+		s.router.Handle("/api/setup/test-db", cors(logging(setupHandler)))
+		slog.Warn("Running in setup mode, open the web UI to complete setup")
 		return
 	}
 	s.router.Handle("/api/setup", cors(logging(localhostOnly(setupHandler))))
 
-	// --- Admin: login / logout (public, rate-limited by bcrypt cost) ---
-	loginHandler := admin.NewLoginHandler(s.authMgr, s.sessionStore)
-	logoutHandler := admin.NewLogoutHandler(s.sessionStore)
+	// --- Admin: login / logout (public, failed attempts lock out the client IP) ---
+	loginHandler := admin.NewLoginHandler(s.live, s.authMgr, s.sessionStore, s.loginLimiter, s.audit)
+	logoutHandler := admin.NewLogoutHandler(s.sessionStore, s.audit)
 	s.router.Handle("/api/admin/login", cors(logging(loginHandler)))
 	s.router.Handle("/api/admin/logout", cors(logging(authAdmin(logoutHandler))))
 
 	// --- Admin: config and key management (admin token required) ---
-	configHandler  := admin.NewConfigHandler(s.cfg, s.cleaner)
-	keysHandler    := admin.NewKeysHandler(s.cfg)
-	sslHandler     := admin.NewSSLHandler(s.cfg)
-	restartHandler := admin.NewRestartHandler()
-	diskHandler    := admin.NewDiskHandler(s.cfg)
+	configHandler  := admin.NewConfigHandler(s.live, s.reloader, s.audit)
+	keysHandler    := admin.NewKeysHandler(s.live, s.authMgr, s.audit)
+	sslHandler     := admin.NewSSLHandler(s.live, s.certs, s.audit)
+	restartHandler := admin.NewRestartHandler(s.audit, s.Restart)
+	diskHandler    := admin.NewDiskHandler(s.live)
+	twoFAHandler   := admin.NewTwoFactorHandler(s.live, s.authMgr, s.audit)
+	lockoutHandler := admin.NewLockoutsHandler(s.loginLimiter, s.audit)
+	sessionHandler := admin.NewSessionsHandler(s.sessionStore, s.audit)
+	auditHandler   := admin.NewAuditHandler(s.audit)
+	reloadHandler  := admin.NewReloadHandler(s.reloader, s.audit)
+	mtlsHandler    := admin.NewMTLSHandler(s.live)
+	historyHandler := admin.NewHistoryHandler(s.live, s.reloader, s.audit)
+	diagHandler    := admin.NewDiagnosticsHandler(s.live, s.db, s.cleaner, s.certs, s.version)
 	s.router.Handle("/api/admin/config",  cors(logging(authAdmin(configHandler))))
+	s.router.Handle("/api/admin/config/test-db", cors(logging(authAdmin(configHandler))))
+	s.router.Handle("/api/admin/config/reload", cors(logging(authAdmin(reloadHandler))))
+	s.router.Handle("/api/admin/config/history",   cors(logging(authAdmin(historyHandler))))
+	s.router.Handle("/api/admin/config/history/",  cors(logging(authAdmin(historyHandler))))
+	s.router.Handle("/api/admin/config/rollback/", cors(logging(authAdmin(historyHandler))))
 	s.router.Handle("/api/admin/keys",    cors(logging(authAdmin(keysHandler))))
 	s.router.Handle("/api/admin/keys/",   cors(logging(authAdmin(keysHandler))))
+	s.router.Handle("/api/admin/ssl",     cors(logging(authAdmin(sslHandler))))
 	s.router.Handle("/api/admin/ssl/",    cors(logging(authAdmin(sslHandler))))
+	s.router.Handle("/api/admin/mtls",    cors(logging(authAdmin(mtlsHandler))))
 	s.router.Handle("/api/admin/restart", cors(logging(authAdmin(restartHandler))))
 	s.router.Handle("/api/admin/disk",    cors(logging(authAdmin(diskHandler))))
+	s.router.Handle("/api/admin/2fa",     cors(logging(authAdmin(twoFAHandler))))
+	s.router.Handle("/api/admin/2fa/",    cors(logging(authAdmin(twoFAHandler))))
+	s.router.Handle("/api/admin/lockouts",  cors(logging(authAdmin(lockoutHandler))))
+	s.router.Handle("/api/admin/lockouts/", cors(logging(authAdmin(lockoutHandler))))
+	s.router.Handle("/api/admin/sessions",  cors(logging(authAdmin(sessionHandler))))
+	s.router.Handle("/api/admin/sessions/", cors(logging(authAdmin(sessionHandler))))
+	s.router.Handle("/api/admin/audit",     cors(logging(authAdmin(auditHandler))))
+	s.router.Handle("/api/admin/diagnostics", cors(logging(authAdmin(diagHandler))))
 
-	// --- API: logs and meta (read-only key or admin token) ---
-	logsHandler := handlers.NewLogsHandler(s.db)
-	metaHandler := handlers.NewMetaHandler(s.db)
-	s.router.Handle("/api/logs", cors(logging(authRO(logsHandler))))
-	s.router.Handle("/api/meta", cors(logging(authRO(metaHandler))))
-	s.router.Handle("/api/meta/", cors(logging(authRO(metaHandler))))
+	// --- API: logs and meta (read-only key or admin token, rate limited) ---
+	logsHandler := handlers.NewLogsHandler(s.db, s.live, s.queryGuard)
+	metaHandler := handlers.NewMetaHandler(s.db, s.live, s.queryGuard)
+	s.router.Handle("/api/logs", cors(logging(authRO(rateLimit(logsHandler)))))
+	s.router.Handle("/api/meta", cors(logging(authRO(rateLimit(metaHandler)))))
+	s.router.Handle("/api/meta/", cors(logging(authRO(rateLimit(metaHandler)))))
 
-	log.Println("✓ Routes configured")
+	slog.Info("Routes configured")
 }
 
-// Start starts the HTTP server.
+// Start starts the HTTP server and blocks until it has shut down.
+// It returns nil after SIGTERM/SIGINT, ErrRestart after a restart request
+// (see Reexec), or the error that stopped the server.
 func (s *Server) Start() error {
-	addr := fmt.Sprintf("%s:%d", s.cfg.Server.Host, s.cfg.Server.Port)
-
-	if s.cfg.Server.UseSSL {
-		if err := config.EnsureSSLCerts(&s.cfg.Server); err != nil {
+	cfg := s.live.Get()
+	useTLS := cfg.Server.TLSEnabled()
+	if useTLS {
+		if err := config.EnsureSSLCerts(&cfg.Server); err != nil {
+			return fmt.Errorf("SSL setup failed: %w", err)
+		}
+		if err := s.certs.Load(); err != nil {
 			return fmt.Errorf("SSL setup failed: %w", err)
 		}
-		log.Printf("Starting HTTPS server on https://%s", addr)
-		return http.ListenAndServeTLS(addr,
-			s.cfg.Server.SSLCertFile,
-			s.cfg.Server.SSLKeyFile,
-			s.router)
+		if cfg.Server.ACME.Enabled && !s.setupMode {
+			if err := s.certs.StartACME(&cfg.Server.ACME); err != nil {
+				return fmt.Errorf("ACME setup failed: %w", err)
+			}
+		}
+		if m := cfg.Auth.MTLS; m.Enabled && !s.setupMode {
+			pool, err := tlscert.CAPool(m.ClientCA)
+			if err != nil {
+				return fmt.Errorf("mTLS setup failed: %w", err)
+			}
+			s.clientCAs = pool
+			slog.Info("Client certificate authentication enabled", "mappings", len(m.Mappings))
+		}
+	}
+
+	lns, err := s.listen()
+	if err != nil {
+		return err
+	}
+	if !useTLS && !s.setupMode {
+		slog.Warn("Running without SSL, enable use_ssl = true for production")
+	}
+	for _, l := range lns {
+		slog.Info("Listening", "addr", l.String())
+	}
+	if p := cfg.Server.Prefix(); p != "" {
+		slog.Info("Serving under base path", "base_path", p+"/")
 	}
 
-	if !s.setupMode {
-		log.Printf("⚠️  WARNING: Running without SSL! Enable use_ssl=true for production.")
+	err = s.serve(lns)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
 	}
-	log.Printf("Starting HTTP server on http://%s", addr)
-	return http.ListenAndServe(addr, s.router)
+	return err
+}
+
+// handler returns the router wrapped in the middleware that applies to
+// every request, regardless of route.
+func (s *Server) handler() http.Handler {
+	cfg := s.live.Get()
+	return middleware.RequestID()(middleware.RealIP(cfg.Server.TrustedProxies)(withBasePath(cfg.Server.Prefix(), s.router)))
 }
 
 // frontendHandler serves the embedded Vue app.
 func (s *Server) frontendHandler() http.Handler {
 	sub, err := fs.Sub(FrontendFS, "frontend/dist")
 	if err != nil {
-		log.Println("⚠️  No embedded frontend found. Run 'make frontend' first.")
+		slog.Warn("No embedded frontend found, run 'make frontend' first")
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Content-Type", "text/html")
 			w.WriteHeader(http.StatusOK)
@@ -164,8 +277,10 @@ func (s *Server) frontendHandler() http.Handler {
 
 	fileServer := http.FileServer(http.FS(sub))
 
-	// Read index.html once for the SPA fallback.
+	// Read index.html once for the SPA fallback, pointing its base href at
+	// server.base_path.
 	indexHTML, indexErr := fs.ReadFile(sub, "index.html")
+	indexHTML = withBaseHref(indexHTML, s.live.Get().Server.Prefix()+"/")
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		fsPath := strings.TrimPrefix(r.URL.Path, "/")
@@ -200,5 +315,25 @@ func (s *Server) docsHandler() http.Handler {
 			http.Error(w, "API documentation not available", http.StatusNotFound)
 		})
 	}
-	return http.FileServer(http.FS(sub))
+	fileServer := http.FileServer(http.FS(sub))
+
+	// The OpenAPI document names this instance, including server.base_path,
+	// as its first server.
+	spec, specErr := fs.ReadFile(sub, "openapi.yaml")
+	if specErr == nil {
+		base := s.live.Get().Server.Prefix()
+		if base == "" {
+			base = "/"
+		}
+		spec = withServerURL(spec, base)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/openapi.yaml" && specErr == nil {
+			w.Header().Set("Content-Type", "application/yaml")
+			w.Write(spec) //nolint:errcheck
+			return
+		}
+		fileServer.ServeHTTP(w, r)
+	})
 }
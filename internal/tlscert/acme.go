@@ -0,0 +1,209 @@
+package tlscert
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+
+	"github.com/phil-bot/rsyslox/internal/config"
+)
+
+// acmeRetryInterval is how long to wait before requesting a certificate
+// again after the CA refused or could not be reached.
+const acmeRetryInterval = time.Hour
+
+// DomainInfo describes the ACME certificate for one domain.
+type DomainInfo struct {
+	Domain      string `json:"domain"`
+	Certificate *Info  `json:"certificate"`     // null until one was issued
+	Error       string `json:"error,omitempty"` // last failure to obtain one
+}
+
+// acmeState is the ACME part of a Store.
+type acmeState struct {
+	cfg     *config.ACMEConfig
+	manager *autocert.Manager
+	domains map[string]bool
+
+	errs map[string]string // last error per domain, guarded by Store.mu
+}
+
+// StartACME switches the Store to certificates from an ACME CA for the
+// configured domains. The certificate loaded by Load remains the fallback
+// for connections without a matching server name. Certificates are
+// requested in the background; the autocert manager renews them once they
+// are loaded.
+func (s *Store) StartACME(cfg *config.ACMEConfig) error {
+	client := &acme.Client{DirectoryURL: cfg.DirectoryURL, UserAgent: "rsyslox"}
+	if cfg.CAFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		pemData, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return fmt.Errorf("acme: read ca_file: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(pemData) {
+			return fmt.Errorf("acme: no certificates in %s", cfg.CAFile)
+		}
+		client.HTTPClient = &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		}
+	}
+
+	domains := make(map[string]bool, len(cfg.Domains))
+	for _, d := range cfg.Domains {
+		domains[strings.ToLower(d)] = true
+	}
+
+	a := &acmeState{
+		cfg: cfg,
+		manager: &autocert.Manager{
+			// Enabling ACME in the configuration accepts the CA's terms.
+			Prompt:      autocert.AcceptTOS,
+			Cache:       autocert.DirCache(cfg.CacheDir),
+			HostPolicy:  autocert.HostWhitelist(cfg.Domains...),
+			RenewBefore: cfg.RenewBefore,
+			Client:      client,
+			Email:       cfg.Email,
+		},
+		domains: domains,
+		errs:    make(map[string]string),
+	}
+
+	s.mu.Lock()
+	s.acme = a
+	s.mu.Unlock()
+
+	slog.Info("ACME: managing certificates", "domains", strings.Join(cfg.Domains, ","), "directory", cfg.DirectoryURL)
+	for _, d := range cfg.Domains {
+		go s.obtain(d)
+	}
+	return nil
+}
+
+// ACMEEnabled reports whether StartACME was called.
+func (s *Store) ACMEEnabled() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.acme != nil
+}
+
+// ACMEHTTPHandler answers HTTP-01 challenges and redirects every other
+// request to HTTPS. Serve it on port 80 (server.acme.http_port).
+func (s *Store) ACMEHTTPHandler() http.Handler {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.acme.manager.HTTPHandler(nil)
+}
+
+// NextProtos returns the ALPN protocols for the TLS config. With ACME it
+// includes acme-tls/1 so TLS-ALPN-01 challenges reach the manager.
+func (s *Store) NextProtos() []string {
+	protos := []string{"h2", "http/1.1"}
+	if s.ACMEEnabled() {
+		protos = append(protos, acme.ALPNProto)
+	}
+	return protos
+}
+
+// ACMEStatus reports the certificate stored for each ACME domain.
+func (s *Store) ACMEStatus(ctx context.Context) []DomainInfo {
+	s.mu.RLock()
+	a := s.acme
+	s.mu.RUnlock()
+	if a == nil {
+		return nil
+	}
+
+	list := make([]DomainInfo, 0, len(a.cfg.Domains))
+	for _, d := range a.cfg.Domains {
+		di := DomainInfo{Domain: d}
+		if leaf, err := cachedLeaf(ctx, a.manager.Cache, d); err == nil {
+			di.Certificate = NewInfo(leaf)
+		}
+		s.mu.RLock()
+		di.Error = a.errs[d]
+		s.mu.RUnlock()
+		list = append(list, di)
+	}
+	return list
+}
+
+// acmeCertificate returns the ACME certificate for hello, or ok=false
+// when hello is not for one of the managed domains.
+func (s *Store) acmeCertificate(hello *tls.ClientHelloInfo) (cert *tls.Certificate, ok bool, err error) {
+	s.mu.RLock()
+	a := s.acme
+	s.mu.RUnlock()
+	if a == nil || hello == nil {
+		return nil, false, nil
+	}
+	name := strings.TrimSuffix(strings.ToLower(hello.ServerName), ".")
+	if !a.domains[name] {
+		return nil, false, nil
+	}
+	cert, err = a.manager.GetCertificate(hello)
+	return cert, true, err
+}
+
+// obtain requests the certificate for domain until it succeeds. Once the
+// manager holds a certificate it schedules the renewal itself.
+func (s *Store) obtain(domain string) {
+	for {
+		s.mu.RLock()
+		a := s.acme
+		s.mu.RUnlock()
+
+		_, err := a.manager.GetCertificate(&tls.ClientHelloInfo{
+			ServerName:   domain,
+			CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+		})
+		s.mu.Lock()
+		if err != nil {
+			a.errs[domain] = err.Error()
+		} else {
+			delete(a.errs, domain)
+		}
+		s.mu.Unlock()
+
+		if err == nil {
+			slog.Info("ACME: certificate ready", "domain", domain)
+			return
+		}
+		slog.Warn("ACME: could not obtain certificate", "domain", domain, "retry_in", acmeRetryInterval.String(), "err", err)
+		time.Sleep(acmeRetryInterval)
+	}
+}
+
+// cachedLeaf reads the certificate autocert stored for domain.
+// Cache entries hold the private key followed by the certificate chain.
+func cachedLeaf(ctx context.Context, cache autocert.Cache, domain string) (*x509.Certificate, error) {
+	data, err := cache.Get(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("no certificate in cache entry")
+		}
+		if block.Type == "CERTIFICATE" {
+			return x509.ParseCertificate(block.Bytes)
+		}
+	}
+}
@@ -0,0 +1,311 @@
+// Package tlscert holds the server's TLS certificate and swaps it at
+// runtime, so a new certificate takes effect without a restart.
+package tlscert
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/phil-bot/rsyslox/internal/config"
+)
+
+// checkInterval bounds how often the certificate files are checked for
+// changes during TLS handshakes.
+const checkInterval = 10 * time.Second
+
+// Store serves the certificate configured in server.ssl_cert / ssl_key
+// through tls.Config.GetCertificate. When the files change on disk — e.g.
+// renewed by certbot — the new pair is validated and swapped in on the next
+// handshake; a broken pair is logged and the current one stays in use.
+type Store struct {
+	live *config.Live
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	files     filesState // state of the files cert was loaded from
+	lastCheck time.Time
+	acme      *acmeState // nil unless server.acme is enabled
+}
+
+// filesState identifies one version of the cert and key files.
+type filesState struct {
+	certPath, keyPath string
+	certMod, keyMod   time.Time
+	certSize, keySize int64
+}
+
+// Info describes a certificate for GET /api/admin/ssl.
+type Info struct {
+	Subject     string    `json:"subject"`
+	Issuer      string    `json:"issuer"`
+	DNSNames    []string  `json:"dns_names"`
+	IPAddresses []string  `json:"ip_addresses"`
+	NotBefore   time.Time `json:"not_before"`
+	NotAfter    time.Time `json:"not_after"`
+	SelfSigned  bool      `json:"self_signed"`
+	SerialHex   string    `json:"serial"`
+	SHA256      string    `json:"sha256_fingerprint"`
+}
+
+// NewStore creates an empty Store. Call Load before serving.
+// The certificate paths are read from live, so Load always uses the
+// current ones.
+func NewStore(live *config.Live) *Store {
+	return &Store{live: live}
+}
+
+// paths returns the configured certificate and key file.
+func (s *Store) paths() (certFile, keyFile string) {
+	cfg := s.live.Get()
+	return cfg.Server.SSLCertFile, cfg.Server.SSLKeyFile
+}
+
+// Load reads the configured certificate and key and swaps them in.
+// On error the previous certificate stays active.
+func (s *Store) Load() error {
+	certFile, keyFile := s.paths()
+	st := stat(certFile, keyFile)
+	cert, err := LoadPair(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.cert, s.files, s.lastCheck = cert, st, time.Now()
+	s.mu.Unlock()
+	return nil
+}
+
+// Reload is Load for callers that changed the files, such as the SSL
+// handler. It does nothing while the server does not serve TLS.
+func (s *Store) Reload() error {
+	if !s.Loaded() {
+		return nil
+	}
+	if err := s.Load(); err != nil {
+		return err
+	}
+	certFile, _ := s.paths()
+	slog.Info("TLS certificate reloaded", "path", certFile)
+	return nil
+}
+
+// Set replaces the served certificate with one loaded from the currently
+// configured paths.
+func (s *Store) Set(cert *tls.Certificate) {
+	st := stat(s.paths())
+	s.mu.Lock()
+	s.cert = cert
+	s.files = st
+	s.mu.Unlock()
+}
+
+// Loaded reports whether a certificate is being served, i.e. whether the
+// server runs with TLS.
+func (s *Store) Loaded() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.cert != nil
+}
+
+// Info returns the metadata of the served certificate, or nil.
+func (s *Store) Info() *Info {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.cert == nil || s.cert.Leaf == nil {
+		return nil
+	}
+	return NewInfo(s.cert.Leaf)
+}
+
+// GetCertificate implements tls.Config.GetCertificate. With ACME, names
+// of the managed domains get the ACME certificate; everything else — and
+// a managed domain whose certificate is not issued yet — gets the file one.
+func (s *Store) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if cert, ok, err := s.acmeCertificate(hello); ok && err == nil {
+		return cert, nil
+	}
+	s.checkFiles()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.cert == nil {
+		return nil, fmt.Errorf("no TLS certificate loaded")
+	}
+	return s.cert, nil
+}
+
+// checkFiles reloads the pair when the files changed since they were
+// loaded. It runs at most once per checkInterval.
+func (s *Store) checkFiles() {
+	s.mu.Lock()
+	if time.Since(s.lastCheck) < checkInterval {
+		s.mu.Unlock()
+		return
+	}
+	s.lastCheck = time.Now()
+	loaded := s.files
+	s.mu.Unlock()
+
+	st := stat(s.paths())
+	if st == loaded {
+		return
+	}
+	cert, err := LoadPair(st.certPath, st.keyPath)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Remember the state either way, so a broken pair is reported once
+	// and not re-read on every handshake.
+	s.files = st
+	if err != nil {
+		slog.Warn("TLS certificate changed on disk but cannot be used, keeping the current one", "err", err)
+		return
+	}
+	s.cert = cert
+	slog.Info("TLS certificate reloaded", "path", st.certPath)
+}
+
+// LoadPair reads a PEM certificate and key, checking that they belong
+// together. The parsed leaf certificate is kept for Info.
+func LoadPair(certFile, keyFile string) (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load TLS certificate: %w", err)
+	}
+	if err := parseLeaf(&cert); err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
+
+// ParsePair validates a PEM certificate and key held in memory, as
+// uploaded through the admin API.
+func ParsePair(certPEM, keyPEM []byte) (*tls.Certificate, error) {
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate or key: %w", err)
+	}
+	if err := parseLeaf(&cert); err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
+
+// ReadInfo returns the metadata of the first certificate in a PEM file.
+func ReadInfo(certFile string) (*Info, error) {
+	data, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("%s: no PEM certificate found", certFile)
+	}
+	leaf, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", certFile, err)
+	}
+	return NewInfo(leaf), nil
+}
+
+// ReadCAs returns all certificates of a PEM bundle, such as the client CA
+// file of auth.mtls.
+func ReadCAs(file string) ([]*x509.Certificate, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var cas []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		c, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		cas = append(cas, c)
+	}
+	if len(cas) == 0 {
+		return nil, fmt.Errorf("%s: no PEM certificates found", file)
+	}
+	return cas, nil
+}
+
+// CAPool returns a pool of the certificates in a PEM bundle.
+func CAPool(file string) (*x509.CertPool, error) {
+	cas, err := ReadCAs(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	for _, c := range cas {
+		pool.AddCert(c)
+	}
+	return pool, nil
+}
+
+func parseLeaf(cert *tls.Certificate) error {
+	if cert.Leaf != nil {
+		return nil
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("parse certificate: %w", err)
+	}
+	cert.Leaf = leaf
+	return nil
+}
+
+// NewInfo returns the metadata of c.
+func NewInfo(c *x509.Certificate) *Info {
+	ips := make([]string, 0, len(c.IPAddresses))
+	for _, ip := range c.IPAddresses {
+		ips = append(ips, ip.String())
+	}
+	dns := c.DNSNames
+	if dns == nil {
+		dns = []string{}
+	}
+	sum := sha256.Sum256(c.Raw)
+	return &Info{
+		Subject:     c.Subject.String(),
+		Issuer:      c.Issuer.String(),
+		DNSNames:    dns,
+		IPAddresses: ips,
+		NotBefore:   c.NotBefore,
+		NotAfter:    c.NotAfter,
+		SelfSigned:  selfSigned(c),
+		SerialHex:   c.SerialNumber.Text(16),
+		SHA256:      hex.EncodeToString(sum[:]),
+	}
+}
+
+// selfSigned reports whether c is signed by its own key.
+func selfSigned(c *x509.Certificate) bool {
+	return bytes.Equal(c.RawSubject, c.RawIssuer) &&
+		c.CheckSignature(c.SignatureAlgorithm, c.RawTBSCertificate, c.Signature) == nil
+}
+
+func stat(certPath, keyPath string) filesState {
+	st := filesState{certPath: certPath, keyPath: keyPath}
+	if fi, err := os.Stat(certPath); err == nil {
+		st.certMod, st.certSize = fi.ModTime(), fi.Size()
+	}
+	if fi, err := os.Stat(keyPath); err == nil {
+		st.keyMod, st.keySize = fi.ModTime(), fi.Size()
+	}
+	return st
+}
@@ -1,14 +1,17 @@
 package main
 
 import (
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
+	"strings"
 
-	"github.com/phil-bot/rsyslox/internal/auth"
 	"github.com/phil-bot/rsyslox/internal/cleanup"
+	"github.com/phil-bot/rsyslox/internal/cli"
 	"github.com/phil-bot/rsyslox/internal/config"
 	"github.com/phil-bot/rsyslox/internal/database"
+	"github.com/phil-bot/rsyslox/internal/logging"
 	"github.com/phil-bot/rsyslox/internal/server"
 )
 
@@ -16,22 +19,12 @@ import (
 var Version = "dev"
 
 func main() {
-	// Subcommand: rsyslox hash-password <plaintext>
-	// Prints the bcrypt hash of the given password to stdout.
-	if len(os.Args) == 3 && os.Args[1] == "hash-password" {
-		hash, err := auth.HashAdminPassword(os.Args[2])
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
-		}
-		fmt.Println(hash)
-		return
+	// Subcommands (rsyslox hash-password, query, tail, …); see internal/cli.
+	cli.Version = Version
+	if code, ok := cli.Run(os.Args[1:]); ok {
+		os.Exit(code)
 	}
 
-	log.Println("========================================")
-	log.Println("rsyslox", Version)
-	log.Println("========================================")
-
 	// Inject embedded filesystems into the server package.
 	server.FrontendFS = frontendFS
 	server.DocsFS = docsFS
@@ -39,47 +32,89 @@ func main() {
 	// Load configuration.
 	cfg, setupMode, err := config.Load()
 	if err != nil {
-		log.Fatalf("❌ Failed to load configuration: %v", err)
+		fatal("Failed to load configuration", err)
+	}
+	if err := logging.Setup(cfg.Logging.Format, cfg.Logging.Level); err != nil {
+		slog.Warn("Invalid logging settings, using the defaults", "err", err)
+	}
+	slog.Info("Starting rsyslox", "version", Version)
+	if env := cfg.EnvOverrides(); len(env) > 0 {
+		slog.Info("Settings from the environment", "settings", strings.Join(env, ","))
 	}
 
 	if setupMode {
-		log.Println("⚠️  No configuration found — starting in setup mode")
-		log.Printf("   Setup wizard available at http://<this-host>:%d", cfg.Server.Port)
-		srv := server.New(cfg, nil, Version, true, nil)
+		slog.Warn("No configuration found, starting in setup mode",
+			"wizard", fmt.Sprintf("http://<this-host>:%d", cfg.Server.Port))
+		srv := server.New(config.NewLive(cfg), nil, Version, true, nil)
 		srv.SetupRoutes()
-		if err := srv.Start(); err != nil {
-			log.Fatalf("❌ Server error: %v", err)
-		}
+		err := srv.Start()
+		srv.Close()
+		exit(srv, err)
 		return
 	}
 
-	// Connect to database.
-	db, err := database.Connect(cfg)
-	if err != nil {
-		log.Fatalf("❌ Failed to connect to database: %v", err)
-	}
-	defer db.Close()
-
-	// Start cleanup service.
-	cleaner := cleanup.New(db.DB, cleanup.Config{
+	// The cleanup service gets the connection pool once there is one.
+	cleaner := cleanup.New(nil, cleanup.Config{
 		Enabled:          cfg.Cleanup.Enabled,
 		DiskPath:         cfg.Cleanup.DiskPath,
 		ThresholdPercent: cfg.Cleanup.ThresholdPercent,
 		BatchSize:        cfg.Cleanup.BatchSize,
 		Interval:         cfg.Cleanup.Interval,
 	})
+
+	// From here on the configuration is only changed by swapping in a new
+	// one, see config.Live.
+	live := config.NewLive(cfg)
+
+	// Connect to database. If it is down, start anyway so the admin panel
+	// is available to fix the settings, and keep connecting in the background.
+	db, err := database.Connect(cfg)
+	if err != nil {
+		slog.Error("Failed to connect to database", "err", err)
+		slog.Warn("Starting in degraded mode, log endpoints return 503 until the database is reachable")
+		db = database.ConnectInBackground(live, err, func(db *database.DB) {
+			cleaner.UpdateDB(db.Pool().DB)
+		})
+	} else {
+		cleaner.UpdateDB(db.Pool().DB)
+	}
+
+	// Start cleanup service.
 	cleaner.Start()
-	defer cleaner.Stop()
 
 	// Start server — pass cleaner so admin config changes propagate at runtime.
-	srv := server.New(cfg, db, Version, false, cleaner)
+	srv := server.New(live, db, Version, false, cleaner)
 	srv.SetupRoutes()
 
-	log.Println("========================================")
-	log.Println("✓ Ready to accept connections")
-	log.Println("========================================")
+	slog.Info("Ready to accept connections")
+
+	err = srv.Start()
 
-	if err := srv.Start(); err != nil {
-		log.Fatalf("❌ Server error: %v", err)
+	// The server has drained all requests; release everything else before
+	// the process exits or re-executes itself.
+	cleaner.Stop()
+	srv.Close()
+	if cerr := db.Close(); cerr != nil {
+		slog.Warn("Closing database", "err", cerr)
 	}
+	exit(srv, err)
+}
+
+// exit ends the process after the server has stopped: it re-executes the
+// binary when a restart was requested and reports any other error.
+func exit(srv *server.Server, err error) {
+	switch {
+	case errors.Is(err, server.ErrRestart):
+		err = srv.Reexec() // only returns on failure
+		fatal("Restart failed, please restart manually", err)
+	case err != nil:
+		fatal("Server error", err)
+	}
+	slog.Info("Shutdown complete")
+}
+
+// fatal logs err and ends the process with exit code 1.
+func fatal(msg string, err error) {
+	slog.Error(msg, "err", err)
+	os.Exit(1)
 }
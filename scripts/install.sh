@@ -159,6 +159,7 @@ Type=simple
 User=$SERVICE_USER
 Group=$SERVICE_GROUP
 ExecStart=$INSTALL_DIR/$BINARY_NAME
+ExecReload=/bin/kill -HUP \$MAINPID
 Restart=on-failure
 RestartSec=5s
 Environment=RSYSLOX_PORT=$CONFIGURED_PORT
@@ -169,6 +170,8 @@ ProtectSystem=strict
 ProtectHome=true
 ReadWritePaths=$CONFIG_DIR
 PrivateTmp=true
+RuntimeDirectory=rsyslox
+RuntimeDirectoryPreserve=restart
 
 [Install]
 WantedBy=multi-user.target